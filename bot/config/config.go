@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hernanrocha/fin-chat/bot/httpclient"
+	"github.com/hernanrocha/fin-chat/bot/quote"
+	"github.com/hernanrocha/fin-chat/bot/stooq"
+)
+
+// Config of the stock bot
+type Config struct {
+	// Username of the bot user posting the responses on the chat
+	Name string
+	// Queue of the command requests handled by the bot (RabbitMQ and
+	// Postgres backends), when commands are routed to separate bots
+	RequestQueue string
+
+	// Market data providers in priority order (stooq, file)
+	Providers []string
+	StooqURL  string
+	QuoteFile string
+
+	HTTP  httpclient.Config
+	Cache quote.CacheConfig
+
+	// Requests processed at the same time and deadline of each one
+	WorkerConcurrency int
+	WorkerTimeout     time.Duration
+	// Address serving the cache stats on /stats in worker mode, empty to
+	// disable it
+	StatsAddr string
+}
+
+// FromEnv reads the bot configuration from BOT_* environment variables
+func FromEnv() (Config, error) {
+	e := &env{}
+	d := httpclient.DefaultConfig
+
+	config := Config{
+		Name:         e.get("BOT_NAME", "Bot"),
+		RequestQueue: e.get("BOT_REQUEST_QUEUE", ""),
+		Providers:    strings.Split(e.get("BOT_QUOTE_PROVIDERS", "stooq"), ","),
+		StooqURL:     e.get("BOT_STOOQ_URL", stooq.DefaultURL),
+		QuoteFile:    e.get("BOT_QUOTE_FILE", "quotes.json"),
+		HTTP: httpclient.Config{
+			Timeout:          e.duration("BOT_HTTP_TIMEOUT", d.Timeout),
+			MaxRetries:       e.int("BOT_HTTP_RETRIES", d.MaxRetries),
+			BaseBackoff:      e.duration("BOT_HTTP_BACKOFF", d.BaseBackoff),
+			MaxBackoff:       e.duration("BOT_HTTP_MAX_BACKOFF", d.MaxBackoff),
+			BreakerThreshold: e.int("BOT_BREAKER_THRESHOLD", d.BreakerThreshold),
+			BreakerCooldown:  e.duration("BOT_BREAKER_COOLDOWN", d.BreakerCooldown),
+		},
+		Cache: quote.CacheConfig{
+			MarketHoursTTL: e.duration("BOT_CACHE_TTL", time.Minute),
+			AfterHoursTTL:  e.duration("BOT_CACHE_TTL_AFTER_HOURS", 15*time.Minute),
+		},
+		WorkerConcurrency: e.int("BOT_WORKER_CONCURRENCY", 4),
+		WorkerTimeout:     e.duration("BOT_WORKER_TIMEOUT", 30*time.Second),
+		StatsAddr:         e.get("BOT_STATS_ADDR", ""),
+	}
+
+	return config, e.err
+}
+
+// NewProvider builds the cached chain of configured providers
+func (c Config) NewProvider() (*quote.Cache, error) {
+	var providers []quote.Provider
+	for _, name := range c.Providers {
+		switch strings.TrimSpace(name) {
+		case "stooq":
+			providers = append(providers, stooq.NewProvider(c.StooqURL, httpclient.New(c.HTTP)))
+		case "file":
+			p, err := quote.NewFileProvider(c.QuoteFile)
+			if err != nil {
+				return nil, fmt.Errorf("loading quotes file: %s", err)
+			}
+			providers = append(providers, p)
+		default:
+			return nil, fmt.Errorf("unknown quote provider %q", name)
+		}
+	}
+
+	return quote.NewCache(quote.NewChain(providers...), c.Cache), nil
+}
+
+// env reads environment variables keeping the first parsing error
+type env struct {
+	err error
+}
+
+func (e *env) get(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+func (e *env) duration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil && e.err == nil {
+		e.err = fmt.Errorf("invalid duration %s=%q", key, value)
+	}
+	return d
+}
+
+func (e *env) int(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil && e.err == nil {
+		e.err = fmt.Errorf("invalid number %s=%q", key, value)
+	}
+	return n
+}
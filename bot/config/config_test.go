@@ -0,0 +1,65 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromEnvDefaults(t *testing.T) {
+	config, err := FromEnv()
+	require.Nil(t, err)
+
+	assert.Equal(t, "Bot", config.Name)
+	assert.Equal(t, "", config.RequestQueue)
+	assert.Equal(t, []string{"stooq"}, config.Providers)
+	assert.Equal(t, time.Minute, config.Cache.MarketHoursTTL)
+	assert.Equal(t, 4, config.WorkerConcurrency)
+}
+
+func TestFromEnv(t *testing.T) {
+	os.Setenv("BOT_QUOTE_PROVIDERS", "stooq,file")
+	os.Setenv("BOT_CACHE_TTL", "30s")
+	os.Setenv("BOT_HTTP_RETRIES", "5")
+	os.Setenv("BOT_NAME", "StockBot")
+	defer os.Unsetenv("BOT_QUOTE_PROVIDERS")
+	defer os.Unsetenv("BOT_CACHE_TTL")
+	defer os.Unsetenv("BOT_HTTP_RETRIES")
+	defer os.Unsetenv("BOT_NAME")
+
+	config, err := FromEnv()
+	require.Nil(t, err)
+
+	assert.Equal(t, []string{"stooq", "file"}, config.Providers)
+	assert.Equal(t, 30*time.Second, config.Cache.MarketHoursTTL)
+	assert.Equal(t, 5, config.HTTP.MaxRetries)
+	assert.Equal(t, "StockBot", config.Name)
+}
+
+func TestFromEnvInvalid(t *testing.T) {
+	os.Setenv("BOT_WORKER_TIMEOUT", "soon")
+	defer os.Unsetenv("BOT_WORKER_TIMEOUT")
+
+	_, err := FromEnv()
+	assert.EqualError(t, err, `invalid duration BOT_WORKER_TIMEOUT="soon"`)
+}
+
+func TestNewProvider(t *testing.T) {
+	config, err := FromEnv()
+	require.Nil(t, err)
+
+	_, err = config.NewProvider()
+	assert.Nil(t, err)
+
+	config.Providers = []string{"unknown"}
+	_, err = config.NewProvider()
+	assert.EqualError(t, err, `unknown quote provider "unknown"`)
+
+	config.Providers = []string{"file"}
+	config.QuoteFile = "missing.json"
+	_, err = config.NewProvider()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,60 @@
+package httpclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	assert.Nil(t, b.Allow())
+	b.Failure()
+	assert.Nil(t, b.Allow())
+	assert.False(t, b.Open())
+
+	// Second consecutive failure opens the circuit
+	b.Failure()
+	assert.True(t, b.Open())
+	assert.Equal(t, ErrCircuitOpen, b.Allow())
+
+	// A single trial is allowed after the cooldown
+	now = now.Add(time.Minute)
+	assert.Nil(t, b.Allow())
+	assert.Equal(t, ErrCircuitOpen, b.Allow())
+
+	// Failed trial keeps the circuit open for another cooldown
+	b.Failure()
+	assert.Equal(t, ErrCircuitOpen, b.Allow())
+	now = now.Add(time.Minute)
+	assert.Nil(t, b.Allow())
+
+	// Successful trial closes it
+	b.Success()
+	assert.False(t, b.Open())
+	assert.Nil(t, b.Allow())
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	b := NewBreaker(2, time.Minute)
+
+	b.Failure()
+	b.Success()
+	b.Failure()
+	assert.False(t, b.Open())
+	assert.Nil(t, b.Allow())
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := NewBreaker(0, time.Minute)
+
+	for i := 0; i < 10; i++ {
+		b.Failure()
+	}
+	assert.False(t, b.Open())
+	assert.Nil(t, b.Allow())
+}
@@ -0,0 +1,123 @@
+package httpclient
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Config of the outbound HTTP client
+type Config struct {
+	// Deadline of every attempt, including reading the body
+	Timeout time.Duration
+	// Attempts after the first one on retryable errors
+	MaxRetries int
+	// Backoff grows exponentially from BaseBackoff up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Consecutive failed requests opening the circuit (zero disables it)
+	BreakerThreshold int
+	// Time the circuit stays open before a trial request
+	BreakerCooldown time.Duration
+}
+
+// DefaultConfig is used when no configuration is provided
+var DefaultConfig = Config{
+	Timeout:          5 * time.Second,
+	MaxRetries:       2,
+	BaseBackoff:      200 * time.Millisecond,
+	MaxBackoff:       2 * time.Second,
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
+}
+
+// Client is an HTTP client with per-attempt timeouts, retries with
+// exponential backoff and jitter, and a circuit breaker
+type Client struct {
+	config  Config
+	http    *http.Client
+	breaker *Breaker
+}
+
+// New returns a client with the given configuration
+func New(config Config) *Client {
+	return &Client{
+		config: config,
+		http: &http.Client{
+			Timeout: config.Timeout,
+		},
+		breaker: NewBreaker(config.BreakerThreshold, config.BreakerCooldown),
+	}
+}
+
+// Breaker returns the circuit breaker of the client
+func (c *Client) Breaker() *Breaker {
+	return c.breaker
+}
+
+// Do sends the request, retrying network errors and 429/5xx responses until
+// MaxRetries is reached or the request context is done. The last response
+// is returned even when its status is retryable. Requests must not have a
+// body, so they can be sent again.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		resp, err := c.http.Do(req)
+		if !retryable(ctx, resp, err) {
+			if err != nil || resp.StatusCode >= 500 {
+				c.breaker.Failure()
+			} else {
+				c.breaker.Success()
+			}
+			return resp, err
+		}
+
+		if attempt >= c.config.MaxRetries {
+			c.breaker.Failure()
+			return resp, err
+		}
+
+		if err != nil {
+			log.Printf("Request to %s failed (attempt %d): %s\n", req.URL.Host, attempt+1, err)
+		} else {
+			log.Printf("Request to %s failed (attempt %d): status %d\n", req.URL.Host, attempt+1, resp.StatusCode)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(c.backoff(attempt)):
+		case <-ctx.Done():
+			c.breaker.Failure()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// backoff returns a random delay up to BaseBackoff * 2^attempt (full jitter)
+func (c *Client) backoff(attempt int) time.Duration {
+	max := c.config.BaseBackoff << uint(attempt)
+	if max <= 0 || max > c.config.MaxBackoff {
+		max = c.config.MaxBackoff
+	}
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// retryable reports whether the request should be sent again
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
@@ -0,0 +1,129 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testConfig = Config{
+	Timeout:          100 * time.Millisecond,
+	MaxRetries:       2,
+	BaseBackoff:      time.Millisecond,
+	MaxBackoff:       5 * time.Millisecond,
+	BreakerThreshold: 2,
+	BreakerCooldown:  time.Minute,
+}
+
+// serveStatuses starts a server answering the given statuses in order,
+// repeating the last one
+func serveStatuses(statuses ...int) (*httptest.Server, *int64) {
+	var calls int64
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&calls, 1)
+		if int(n) > len(statuses) {
+			n = int64(len(statuses))
+		}
+		w.WriteHeader(statuses[n-1])
+	}))
+	return s, &calls
+}
+
+func get(t *testing.T, c *Client, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.Nil(t, err)
+	return c.Do(req)
+}
+
+func TestClientRetry(t *testing.T) {
+	s, calls := serveStatuses(http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+	defer s.Close()
+
+	resp, err := get(t, New(testConfig), s.URL)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.EqualValues(t, 3, atomic.LoadInt64(calls))
+}
+
+func TestClientMaxRetries(t *testing.T) {
+	s, calls := serveStatuses(http.StatusBadGateway)
+	defer s.Close()
+
+	resp, err := get(t, New(testConfig), s.URL)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.EqualValues(t, 3, atomic.LoadInt64(calls))
+}
+
+func TestClientNotRetryable(t *testing.T) {
+	s, calls := serveStatuses(http.StatusNotFound)
+	defer s.Close()
+
+	c := New(testConfig)
+	resp, err := get(t, c, s.URL)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.EqualValues(t, 1, atomic.LoadInt64(calls))
+	assert.False(t, c.Breaker().Open())
+}
+
+func TestClientTimeout(t *testing.T) {
+	var calls int64
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	resp, err := get(t, New(testConfig), s.URL)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.EqualValues(t, 2, atomic.LoadInt64(&calls))
+}
+
+func TestClientContextDeadline(t *testing.T) {
+	s, calls := serveStatuses(http.StatusServiceUnavailable)
+	defer s.Close()
+
+	config := testConfig
+	config.MaxRetries = 10
+	config.BaseBackoff = 100 * time.Millisecond
+	config.MaxBackoff = 100 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, s.URL, nil)
+	require.Nil(t, err)
+
+	_, err = New(config).Do(req.WithContext(ctx))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, atomic.LoadInt64(calls) < 10)
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	s, calls := serveStatuses(http.StatusInternalServerError)
+	defer s.Close()
+
+	c := New(testConfig)
+	for i := 0; i < testConfig.BreakerThreshold; i++ {
+		resp, err := get(t, c, s.URL)
+		require.Nil(t, err)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	}
+	assert.True(t, c.Breaker().Open())
+	assert.EqualValues(t, 6, atomic.LoadInt64(calls))
+
+	// Fail fast without calling the server
+	_, err := get(t, c, s.URL)
+	assert.Equal(t, ErrCircuitOpen, err)
+	assert.EqualValues(t, 6, atomic.LoadInt64(calls))
+}
@@ -1,11 +1,106 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	
-	"github.com/hernanrocha/fin-chat/bot/stooq"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	_ "github.com/lib/pq"
+
+	"github.com/hernanrocha/fin-chat/bot/config"
+	"github.com/hernanrocha/fin-chat/bot/quote"
+	"github.com/hernanrocha/fin-chat/bot/stock"
+	"github.com/hernanrocha/fin-chat/bot/worker"
+	"github.com/hernanrocha/fin-chat/messenger"
 )
 
+func failOnError(err error, msg string) {
+	if err != nil {
+		log.Fatalf("%s: %s", msg, err)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// consumer connects to the messenger backend delivering command requests
+func consumer(cfg config.Config) messenger.BotCommandConsumer {
+	if getEnv("MESSENGER", "") == "postgres" {
+		dbconn := getEnv("DB_CONNECTION", "host=localhost port=15432 user=postgres password=postgres dbname=finchat sslmode=disable")
+		db, err := sql.Open("postgres", dbconn)
+		failOnError(err, "Error conecting to database")
+		return messenger.NewPostgresMessenger(db, dbconn, messenger.PostgresConfig{RequestQueue: cfg.RequestQueue})
+	}
+
+	if conn, ok := os.LookupEnv("RABBIT_CONNECTION"); ok {
+		return messenger.NewRabbitMessenger(conn, messenger.RabbitConfig{RequestQueue: cfg.RequestQueue})
+	}
+
+	awsSession := session.New()
+	return messenger.NewSQSMessenger(sns.New(awsSession), sqs.New(awsSession), messenger.SQSConfigFromEnv())
+}
+
+// runWorker processes command requests until SIGINT or SIGTERM
+func runWorker(cfg config.Config, bot *stock.Bot, cache *quote.Cache) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-signals
+		log.Printf("Received %s, shutting down...\n", sig)
+		cancel()
+	}()
+
+	if cfg.StatsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/stats", cache.StatsHandler())
+		srv := &http.Server{Addr: cfg.StatsAddr, Handler: mux}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("Stats server failed: %s\n", err)
+			}
+		}()
+		defer srv.Close()
+	}
+
+	w := worker.New(consumer(cfg), bot, cfg.WorkerConcurrency, cfg.WorkerTimeout)
+	failOnError(w.Run(ctx), "Bot worker failed")
+	log.Printf("Quote cache stats: %+v\n", cache.Stats())
+}
+
 func main() {
-	lambda.Start(stooq.StooqHandler)
-}
\ No newline at end of file
+	cfg, err := config.FromEnv()
+	failOnError(err, "Invalid bot configuration")
+
+	cache, err := cfg.NewProvider()
+	failOnError(err, "Error setting up quote providers")
+	bot := stock.NewBot(cfg.Name, cache)
+
+	switch mode := getEnv("BOT_MODE", "lambda"); mode {
+	case "worker":
+		runWorker(cfg, bot, cache)
+	case "lambda":
+		lambda.Start(func(ctx context.Context, snsEvent events.SNSEvent) error {
+			err := bot.LambdaHandler(ctx, snsEvent)
+			log.Printf("Quote cache stats: %+v\n", cache.Stats())
+			return err
+		})
+	default:
+		log.Fatalf("Unknown bot mode %q", mode)
+	}
+}
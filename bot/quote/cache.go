@@ -0,0 +1,221 @@
+package quote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Expired entries are pruned when the cache grows over this size
+const maxCacheEntries = 1000
+
+// Time allowed for a request to the wrapped provider. Requests are shared by
+// the coalesced lookups, so they do not run with the context of any of them.
+const fetchTimeout = 30 * time.Second
+
+// CacheConfig sets how long quotes are kept
+type CacheConfig struct {
+	// TTL while the market is open
+	MarketHoursTTL time.Duration
+	// TTL after the market closes and during weekends
+	AfterHoursTTL time.Duration
+}
+
+// CacheStats are the cache counters since it was created
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Coalesced int64 `json:"coalesced"`
+	Entries   int   `json:"entries"`
+}
+
+type cacheEntry struct {
+	quote   Quote
+	expires time.Time
+}
+
+// Cache is a provider keeping quotes for a TTL. Concurrent lookups of the
+// same symbols are coalesced into a single request to the wrapped provider.
+type Cache struct {
+	provider Provider
+	config   CacheConfig
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	group   singleflight.Group
+
+	hits      int64
+	misses    int64
+	coalesced int64
+}
+
+// NewCache returns a cache in front of the given provider
+func NewCache(provider Provider, config CacheConfig) *Cache {
+	return &Cache{
+		provider: provider,
+		config:   config,
+		now:      time.Now,
+		entries:  make(map[string]cacheEntry),
+	}
+}
+
+// Name of the wrapped provider
+func (c *Cache) Name() string {
+	return c.provider.Name()
+}
+
+// Quotes returns the cached quotes and gets the missing ones from the
+// wrapped provider
+func (c *Cache) Quotes(ctx context.Context, symbols []string) ([]Quote, error) {
+	found := make(map[string]Quote, len(symbols))
+	var missing []string
+
+	now := c.now()
+	c.mu.Lock()
+	for _, s := range symbols {
+		s = Normalize(s)
+		if e, ok := c.entries[s]; ok && now.Before(e.expires) {
+			found[s] = e.quote
+		} else {
+			missing = append(missing, s)
+		}
+	}
+	c.mu.Unlock()
+
+	atomic.AddInt64(&c.hits, int64(len(found)))
+	atomic.AddInt64(&c.misses, int64(len(missing)))
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		leader := false
+		results := c.group.DoChan(strings.Join(missing, ","), func() (interface{}, error) {
+			leader = true
+			ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+			defer cancel()
+			return c.fetch(ctx, missing)
+		})
+
+		var result singleflight.Result
+		select {
+		case result = <-results:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// Only the lookups joining the request of another are coalesced
+		if !leader {
+			atomic.AddInt64(&c.coalesced, 1)
+		}
+		if result.Err != nil && result.Err != ErrSymbolNotFound {
+			return nil, result.Err
+		}
+		if result.Val != nil {
+			for _, q := range result.Val.([]Quote) {
+				found[q.Symbol] = q
+			}
+		}
+	}
+
+	if len(found) == 0 {
+		return nil, ErrSymbolNotFound
+	}
+
+	// Keep the requested order
+	quotes := make([]Quote, 0, len(found))
+	for _, s := range symbols {
+		if q, ok := found[Normalize(s)]; ok {
+			quotes = append(quotes, q)
+			delete(found, Normalize(s))
+		}
+	}
+
+	return quotes, nil
+}
+
+// Stats returns the cache counters
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return CacheStats{
+		Hits:      atomic.LoadInt64(&c.hits),
+		Misses:    atomic.LoadInt64(&c.misses),
+		Coalesced: atomic.LoadInt64(&c.coalesced),
+		Entries:   entries,
+	}
+}
+
+// StatsHandler serves the cache counters as JSON
+func (c *Cache) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.Stats())
+	})
+}
+
+// TTL returns how long a quote fetched at t is kept
+func (c *Cache) TTL(t time.Time) time.Duration {
+	if MarketOpen(t) {
+		return c.config.MarketHoursTTL
+	}
+	return c.config.AfterHoursTTL
+}
+
+func (c *Cache) fetch(ctx context.Context, symbols []string) ([]Quote, error) {
+	quotes, err := c.provider.Quotes(ctx, symbols)
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.now()
+	expires := now.Add(c.TTL(now))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= maxCacheEntries {
+		for s, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, s)
+			}
+		}
+	}
+
+	for _, q := range quotes {
+		c.entries[Normalize(q.Symbol)] = cacheEntry{quote: q, expires: expires}
+	}
+
+	return quotes, nil
+}
+
+// US markets (NYSE and Nasdaq) timezone
+var marketLocation = loadLocation("America/New_York", -5*60*60)
+
+func loadLocation(name string, offset int) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		// Timezone database is not available (e.g. minimal containers)
+		return time.FixedZone(name, offset)
+	}
+	return loc
+}
+
+// MarketOpen reports whether US markets are open at t (9:30 to 16:00 New
+// York time, Monday to Friday). Holidays are not taken into account.
+func MarketOpen(t time.Time) bool {
+	t = t.In(marketLocation)
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return false
+	}
+
+	minutes := t.Hour()*60 + t.Minute()
+	return minutes >= 9*60+30 && minutes < 16*60
+}
@@ -0,0 +1,173 @@
+package quote
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Wednesday 18 Dec 2019 12:00 in New York
+var marketTime = time.Date(2019, 12, 18, 17, 0, 0, 0, time.UTC)
+
+func newTestCache(p Provider) *Cache {
+	c := NewCache(p, CacheConfig{MarketHoursTTL: time.Minute, AfterHoursTTL: time.Hour})
+	c.now = func() time.Time { return marketTime }
+	return c
+}
+
+func TestCacheHitMiss(t *testing.T) {
+	p := NewMockProvider("primary")
+	p.On("Quotes", []string{"AAPL"}).Return([]Quote{{Symbol: "AAPL", Close: 1}}, nil).Once()
+	p.On("Quotes", []string{"MSFT"}).Return([]Quote{{Symbol: "MSFT", Close: 2}}, nil).Once()
+
+	c := newTestCache(p)
+	quotes, err := c.Quotes(context.Background(), []string{"aapl"})
+	require.Nil(t, err)
+	assert.Equal(t, []Quote{{Symbol: "AAPL", Close: 1}}, quotes)
+
+	quotes, err = c.Quotes(context.Background(), []string{"MSFT", "AAPL"})
+	require.Nil(t, err)
+	assert.Equal(t, []Quote{{Symbol: "MSFT", Close: 2}, {Symbol: "AAPL", Close: 1}}, quotes)
+
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 2, Entries: 2}, c.Stats())
+	p.AssertExpectations(t)
+
+	w := httptest.NewRecorder()
+	c.StatsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/stats", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"hits":1,"misses":2,"coalesced":0,"entries":2}`, w.Body.String())
+}
+
+func TestCacheExpiration(t *testing.T) {
+	p := NewMockProvider("primary")
+	p.On("Quotes", []string{"AAPL"}).Return([]Quote{{Symbol: "AAPL", Close: 1}}, nil).Twice()
+
+	c := newTestCache(p)
+	_, err := c.Quotes(context.Background(), []string{"AAPL"})
+	require.Nil(t, err)
+
+	c.now = func() time.Time { return marketTime.Add(30 * time.Second) }
+	_, err = c.Quotes(context.Background(), []string{"AAPL"})
+	require.Nil(t, err)
+
+	c.now = func() time.Time { return marketTime.Add(2 * time.Minute) }
+	_, err = c.Quotes(context.Background(), []string{"AAPL"})
+	require.Nil(t, err)
+
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 2, Entries: 1}, c.Stats())
+	p.AssertExpectations(t)
+}
+
+func TestCacheNotFound(t *testing.T) {
+	p := NewMockProvider("primary")
+	p.On("Quotes", []string{"XYZQ"}).Return(nil, ErrSymbolNotFound).Twice()
+
+	c := newTestCache(p)
+	_, err := c.Quotes(context.Background(), []string{"XYZQ"})
+	assert.Equal(t, ErrSymbolNotFound, err)
+	_, err = c.Quotes(context.Background(), []string{"XYZQ"})
+	assert.Equal(t, ErrSymbolNotFound, err)
+
+	p.AssertExpectations(t)
+}
+
+// blockingProvider counts calls and answers once released
+type blockingProvider struct {
+	calls   int64
+	release chan struct{}
+}
+
+func (p *blockingProvider) Name() string {
+	return "blocking"
+}
+
+func (p *blockingProvider) Quotes(ctx context.Context, symbols []string) ([]Quote, error) {
+	atomic.AddInt64(&p.calls, 1)
+	<-p.release
+	return []Quote{{Symbol: symbols[0]}}, nil
+}
+
+func TestCacheCoalescing(t *testing.T) {
+	p := &blockingProvider{release: make(chan struct{})}
+	c := newTestCache(p)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			quotes, err := c.Quotes(context.Background(), []string{"AAPL"})
+			assert.Nil(t, err)
+			assert.Len(t, quotes, 1)
+		}()
+	}
+
+	// Give every lookup time to join the in-flight request
+	time.Sleep(50 * time.Millisecond)
+	close(p.release)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, atomic.LoadInt64(&p.calls))
+	// The first lookup makes the request, the other 4 wait for it
+	assert.Equal(t, CacheStats{Misses: 5, Coalesced: 4, Entries: 1}, c.Stats())
+}
+
+func TestCacheCoalescingCancel(t *testing.T) {
+	p := &blockingProvider{release: make(chan struct{})}
+	c := newTestCache(p)
+
+	// The lookup making the request is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := c.Quotes(ctx, []string{"AAPL"})
+		first <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	second := make(chan error)
+	go func() {
+		_, err := c.Quotes(context.Background(), []string{"AAPL"})
+		second <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-first)
+
+	// The request goes on for the others
+	close(p.release)
+	assert.Nil(t, <-second)
+	assert.EqualValues(t, 1, atomic.LoadInt64(&p.calls))
+	assert.Equal(t, 1, c.Stats().Entries)
+}
+
+func TestCacheTTL(t *testing.T) {
+	c := NewCache(nil, CacheConfig{MarketHoursTTL: time.Minute, AfterHoursTTL: time.Hour})
+
+	assert.Equal(t, time.Minute, c.TTL(marketTime))
+	assert.Equal(t, time.Hour, c.TTL(marketTime.Add(6*time.Hour)))
+}
+
+func TestMarketOpen(t *testing.T) {
+	ny := marketLocation
+	cases := map[time.Time]bool{
+		time.Date(2019, 12, 18, 9, 29, 0, 0, ny):  false,
+		time.Date(2019, 12, 18, 9, 30, 0, 0, ny):  true,
+		time.Date(2019, 12, 18, 15, 59, 0, 0, ny): true,
+		time.Date(2019, 12, 18, 16, 0, 0, 0, ny):  false,
+		time.Date(2019, 12, 21, 12, 0, 0, 0, ny):  false,
+		time.Date(2019, 12, 22, 12, 0, 0, 0, ny):  false,
+	}
+
+	for ts, open := range cases {
+		assert.Equal(t, open, MarketOpen(ts), ts.String())
+	}
+}
@@ -0,0 +1,73 @@
+package quote
+
+import (
+	"context"
+	"log"
+)
+
+// Chain queries providers in priority order, falling back to the next one
+// for the symbols the previous providers failed to answer
+type Chain struct {
+	providers []Provider
+}
+
+// NewChain returns a provider backed by the given providers in priority order
+func NewChain(providers ...Provider) *Chain {
+	return &Chain{
+		providers: providers,
+	}
+}
+
+// Name of the chain
+func (c *Chain) Name() string {
+	return "chain"
+}
+
+// Quotes returns the quotes of the given symbols. Every quote records the
+// provider that answered it.
+func (c *Chain) Quotes(ctx context.Context, symbols []string) ([]Quote, error) {
+	pending := symbols
+	found := make(map[string]Quote, len(symbols))
+
+	var lastErr error = ErrSymbolNotFound
+	for _, p := range c.providers {
+		if len(pending) == 0 {
+			break
+		}
+
+		quotes, err := p.Quotes(ctx, pending)
+		if err != nil && err != ErrSymbolNotFound {
+			log.Printf("Error getting quotes from %s: %s\n", p.Name(), err)
+			lastErr = err
+			continue
+		}
+
+		for _, q := range quotes {
+			if q.Provider == "" {
+				q.Provider = p.Name()
+			}
+			found[q.Symbol] = q
+		}
+
+		pending = pending[:0:0]
+		for _, s := range symbols {
+			if _, ok := found[s]; !ok {
+				pending = append(pending, s)
+			}
+		}
+	}
+
+	if len(found) == 0 {
+		return nil, lastErr
+	}
+
+	// Keep the requested order
+	quotes := make([]Quote, 0, len(found))
+	for _, s := range symbols {
+		if q, ok := found[s]; ok {
+			quotes = append(quotes, q)
+		}
+	}
+
+	return quotes, nil
+}
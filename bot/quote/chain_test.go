@@ -0,0 +1,88 @@
+package quote
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockProvider struct {
+	mock.Mock
+	name string
+}
+
+func NewMockProvider(name string) *MockProvider {
+	return &MockProvider{name: name}
+}
+
+func (p *MockProvider) Name() string {
+	return p.name
+}
+
+func (p *MockProvider) Quotes(ctx context.Context, symbols []string) ([]Quote, error) {
+	args := p.Called(symbols)
+	quotes, _ := args.Get(0).([]Quote)
+	return quotes, args.Error(1)
+}
+
+func TestChainFirstProvider(t *testing.T) {
+	primary := NewMockProvider("primary")
+	secondary := NewMockProvider("secondary")
+	primary.On("Quotes", []string{"AAPL"}).Return([]Quote{{Symbol: "AAPL", Close: 1}}, nil).Once()
+
+	quotes, err := NewChain(primary, secondary).Quotes(context.Background(), []string{"AAPL"})
+	require.Nil(t, err)
+	assert.Equal(t, []Quote{{Symbol: "AAPL", Close: 1, Provider: "primary"}}, quotes)
+
+	primary.AssertExpectations(t)
+	secondary.AssertExpectations(t)
+}
+
+func TestChainFallback(t *testing.T) {
+	primary := NewMockProvider("primary")
+	secondary := NewMockProvider("secondary")
+	third := NewMockProvider("third")
+	primary.On("Quotes", []string{"AAPL", "VOD.UK", "XYZQ"}).Return(nil, errors.New("timeout")).Once()
+	secondary.On("Quotes", []string{"AAPL", "VOD.UK", "XYZQ"}).Return([]Quote{{Symbol: "VOD.UK"}}, nil).Once()
+	third.On("Quotes", []string{"AAPL", "XYZQ"}).Return([]Quote{{Symbol: "AAPL"}}, nil).Once()
+
+	chain := NewChain(primary, secondary, third)
+	quotes, err := chain.Quotes(context.Background(), []string{"AAPL", "VOD.UK", "XYZQ"})
+	require.Nil(t, err)
+	assert.Equal(t, []Quote{
+		{Symbol: "AAPL", Provider: "third"},
+		{Symbol: "VOD.UK", Provider: "secondary"},
+	}, quotes)
+
+	primary.AssertExpectations(t)
+	secondary.AssertExpectations(t)
+	third.AssertExpectations(t)
+}
+
+func TestChainNotFound(t *testing.T) {
+	primary := NewMockProvider("primary")
+	primary.On("Quotes", []string{"XYZQ"}).Return(nil, ErrSymbolNotFound).Once()
+
+	_, err := NewChain(primary).Quotes(context.Background(), []string{"XYZQ"})
+	assert.Equal(t, ErrSymbolNotFound, err)
+
+	primary.AssertExpectations(t)
+}
+
+func TestChainError(t *testing.T) {
+	timeout := errors.New("timeout")
+	primary := NewMockProvider("primary")
+	secondary := NewMockProvider("secondary")
+	primary.On("Quotes", []string{"AAPL"}).Return(nil, ErrSymbolNotFound).Once()
+	secondary.On("Quotes", []string{"AAPL"}).Return(nil, timeout).Once()
+
+	_, err := NewChain(primary, secondary).Quotes(context.Background(), []string{"AAPL"})
+	assert.Equal(t, timeout, err)
+
+	primary.AssertExpectations(t)
+	secondary.AssertExpectations(t)
+}
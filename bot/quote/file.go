@@ -0,0 +1,59 @@
+package quote
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+)
+
+// FileProvider answers quotes from a JSON fixture file, useful for offline
+// development and tests
+type FileProvider struct {
+	quotes map[string]Quote
+}
+
+// NewFileProvider loads the quotes stored as a JSON array in path
+func NewFileProvider(path string) (*FileProvider, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var quotes []Quote
+	if err := json.NewDecoder(f).Decode(&quotes); err != nil {
+		return nil, err
+	}
+
+	p := &FileProvider{
+		quotes: make(map[string]Quote, len(quotes)),
+	}
+	for _, q := range quotes {
+		q.Symbol = Normalize(q.Symbol)
+		p.quotes[q.Symbol] = q
+	}
+
+	return p, nil
+}
+
+// Name of the provider
+func (p *FileProvider) Name() string {
+	return "file"
+}
+
+// Quotes returns the stored quotes of the given symbols
+func (p *FileProvider) Quotes(ctx context.Context, symbols []string) ([]Quote, error) {
+	var quotes []Quote
+	for _, s := range symbols {
+		if q, ok := p.quotes[s]; ok {
+			q.Provider = p.Name()
+			quotes = append(quotes, q)
+		}
+	}
+
+	if len(quotes) == 0 {
+		return nil, ErrSymbolNotFound
+	}
+
+	return quotes, nil
+}
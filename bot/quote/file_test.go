@@ -0,0 +1,31 @@
+package quote
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileProvider(t *testing.T) {
+	p, err := NewFileProvider("testdata/quotes.json")
+	require.Nil(t, err)
+	assert.Equal(t, "file", p.Name())
+
+	quotes, err := p.Quotes(context.Background(), []string{"MSFT", "XYZQ", "AAPL"})
+	require.Nil(t, err)
+	require.Len(t, quotes, 2)
+	assert.Equal(t, "MSFT", quotes[0].Symbol)
+	assert.Equal(t, 155.12, quotes[0].Close)
+	assert.Equal(t, "file", quotes[0].Provider)
+	assert.Equal(t, "AAPL", quotes[1].Symbol)
+
+	_, err = p.Quotes(context.Background(), []string{"XYZQ"})
+	assert.Equal(t, ErrSymbolNotFound, err)
+}
+
+func TestFileProviderMissingFile(t *testing.T) {
+	_, err := NewFileProvider("testdata/missing.json")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,45 @@
+package quote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrSymbolNotFound is returned when a provider has no data for the requested symbols
+var ErrSymbolNotFound = errors.New("quote: symbol not found")
+
+// Quote is the last known quote of a symbol
+type Quote struct {
+	Symbol string  `json:"symbol"`
+	Date   string  `json:"date"`
+	Time   string  `json:"time"`
+	Open   float64 `json:"open"`
+	High   float64 `json:"high"`
+	Low    float64 `json:"low"`
+	Close  float64 `json:"close"`
+	Volume int64   `json:"volume"`
+	// Name of the provider that answered the quote
+	Provider string `json:"provider,omitempty"`
+}
+
+// String returns the quote as a chat message
+func (q *Quote) String() string {
+	return fmt.Sprintf("%s quote is $%.2f per share", q.Symbol, q.Close)
+}
+
+// Provider is a source of market data
+type Provider interface {
+	// Name identifies the provider on the quotes it answers
+	Name() string
+	// Quotes returns the quotes of the given normalized symbols. Symbols
+	// without data are left out of the result and ErrSymbolNotFound is
+	// returned when there is no data at all.
+	Quotes(ctx context.Context, symbols []string) ([]Quote, error)
+}
+
+// Normalize returns the symbol in the format expected by providers
+func Normalize(symbol string) string {
+	return strings.ToUpper(strings.TrimSpace(symbol))
+}
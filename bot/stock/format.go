@@ -0,0 +1,66 @@
+package stock
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hernanrocha/fin-chat/bot/quote"
+)
+
+// ParseSymbols splits a comma or space separated list of symbols,
+// normalizing them and removing duplicates
+func ParseSymbols(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+
+	symbols := make([]string, 0, len(fields))
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		symbol := quote.Normalize(f)
+		if symbol == "" || seen[symbol] {
+			continue
+		}
+		seen[symbol] = true
+		symbols = append(symbols, symbol)
+	}
+
+	return symbols
+}
+
+// MissingSymbols returns the requested symbols without quote
+func MissingSymbols(symbols []string, quotes []quote.Quote) []string {
+	found := make(map[string]bool, len(quotes))
+	for _, q := range quotes {
+		found[q.Symbol] = true
+	}
+
+	var missing []string
+	for _, symbol := range symbols {
+		if !found[symbol] {
+			missing = append(missing, symbol)
+		}
+	}
+
+	return missing
+}
+
+// FormatQuotes returns the quotes as a chat message. Several quotes are
+// rendered as a compact table.
+func FormatQuotes(quotes []quote.Quote) string {
+	if len(quotes) == 1 {
+		return quotes[0].String()
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SYMBOL\tCLOSE\tOPEN\tHIGH\tLOW\tVOLUME")
+	for _, q := range quotes {
+		fmt.Fprintf(w, "%s\t%.2f\t%.2f\t%.2f\t%.2f\t%d\n", q.Symbol, q.Close, q.Open, q.High, q.Low, q.Volume)
+	}
+	w.Flush()
+
+	return strings.TrimRight(buf.String(), "\n")
+}
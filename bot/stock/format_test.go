@@ -0,0 +1,33 @@
+package stock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hernanrocha/fin-chat/bot/quote"
+)
+
+func TestParseSymbols(t *testing.T) {
+	assert.Equal(t, []string{"AAPL", "MSFT", "TSLA"}, ParseSymbols("AAPL,MSFT,TSLA"))
+	assert.Equal(t, []string{"AAPL", "VOD.UK", "^SPX", "EURUSD"}, ParseSymbols("aapl, vod.uk ^spx,,eurusd,AAPL"))
+	assert.Empty(t, ParseSymbols(" , "))
+}
+
+func TestMissingSymbols(t *testing.T) {
+	quotes := []quote.Quote{{Symbol: "AAPL"}, {Symbol: "^SPX"}}
+	assert.Equal(t, []string{"XYZQ", "EURUSD"}, MissingSymbols([]string{"AAPL", "XYZQ", "^SPX", "EURUSD"}, quotes))
+	assert.Empty(t, MissingSymbols([]string{"AAPL"}, quotes))
+}
+
+func TestFormatQuotes(t *testing.T) {
+	aapl := quote.Quote{Symbol: "AAPL", Open: 279.8, High: 281.9, Low: 279.12, Close: 279.74, Volume: 29024687}
+	msft := quote.Quote{Symbol: "MSFT", Open: 154, High: 155.48, Low: 154, Close: 155.12, Volume: 23979601}
+
+	assert.Equal(t, "AAPL quote is $279.74 per share", FormatQuotes([]quote.Quote{aapl}))
+
+	expected := "SYMBOL  CLOSE   OPEN    HIGH    LOW     VOLUME\n" +
+		"AAPL    279.74  279.80  281.90  279.12  29024687\n" +
+		"MSFT    155.12  154.00  155.48  154.00  23979601"
+	assert.Equal(t, expected, FormatQuotes([]quote.Quote{aapl, msft}))
+}
@@ -0,0 +1,115 @@
+package stock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"github.com/hernanrocha/fin-chat/bot/quote"
+	"github.com/hernanrocha/fin-chat/contract"
+)
+
+// Command answered by the bot
+const Command = "stock"
+
+// UnavailableMessage is the reply when market data cannot be obtained
+const UnavailableMessage = "Market data temporarily unavailable, please try again later"
+
+// Bot answers stock commands with quotes from a market data provider
+type Bot struct {
+	name     string
+	provider quote.Provider
+}
+
+// NewBot returns a stock bot using the given provider. Its responses are
+// posted on the chat by the bot user with the given name.
+func NewBot(name string, provider quote.Provider) *Bot {
+	return &Bot{
+		name:     name,
+		provider: provider,
+	}
+}
+
+// Handle answers a stock command with the quotes of the requested symbols.
+// Successful responses carry the quotes as result.
+func (b *Bot) Handle(ctx context.Context, req contract.Request) (*contract.Response, error) {
+	res := b.handle(ctx, req)
+	res.Bot = b.name
+	log.Println(res.Text)
+	return &res, nil
+}
+
+func (b *Bot) handle(ctx context.Context, req contract.Request) contract.Response {
+	if req.Command != Command {
+		return req.Fail(contract.ErrorUnknownCommand, fmt.Sprintf("Unknown command /%s", req.Command))
+	}
+
+	symbols := ParseSymbols(strings.Join(req.Args, ","))
+	if len(symbols) == 0 {
+		return req.Fail(contract.ErrorInvalidArgs, "Usage: /stock=AAPL or /stock AAPL,MSFT")
+	}
+
+	quotes, err := b.provider.Quotes(ctx, symbols)
+	if err == quote.ErrSymbolNotFound {
+		return req.Fail(contract.ErrorNotFound, fmt.Sprintf("No data found for %s", strings.Join(symbols, ", ")))
+	}
+	if err != nil {
+		// Providers already retried, so fail fast with a friendly reply
+		log.Printf("Error getting quotes for %v: %s\n", symbols, err)
+		return req.Fail(contract.ErrorUnavailable, UnavailableMessage)
+	}
+
+	text := FormatQuotes(quotes)
+	if missing := MissingSymbols(symbols, quotes); len(missing) > 0 {
+		text += fmt.Sprintf("\nNo data found for %s", strings.Join(missing, ", "))
+	}
+
+	res := req.Reply(text)
+	res.Result, _ = json.Marshal(quotes)
+	return res
+}
+
+// LambdaHandler handles command requests published on SNS and sends the
+// responses to the SQS_COMMANDS_RESPONSE_URL queue
+func (b *Bot) LambdaHandler(ctx context.Context, snsEvent events.SNSEvent) error {
+	if len(snsEvent.Records) == 0 {
+		return errors.New("No SQS message passed to function")
+	}
+
+	mySession := session.New()
+	svc := sqs.New(mySession)
+
+	for _, msg := range snsEvent.Records {
+		fmt.Printf("Got SQS message %q with body %q\n", msg.SNS.MessageID, msg.SNS.Message)
+		req, err := contract.DecodeRequest([]byte(msg.SNS.Message))
+		if err != nil {
+			return err
+		}
+
+		res, err := b.Handle(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		resStr, _ := json.Marshal(res)
+		_, err = svc.SendMessage(&sqs.SendMessageInput{
+			MessageBody: aws.String(string(resStr)),
+			QueueUrl:    aws.String(os.Getenv("SQS_COMMANDS_RESPONSE_URL")),
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package stock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/bot/httpclient"
+	"github.com/hernanrocha/fin-chat/bot/quote"
+	"github.com/hernanrocha/fin-chat/contract"
+)
+
+// fakeProvider answers the stored quotes or fails with err
+type fakeProvider struct {
+	quotes map[string]quote.Quote
+	err    error
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakeProvider) Quotes(ctx context.Context, symbols []string) ([]quote.Quote, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	var quotes []quote.Quote
+	for _, s := range symbols {
+		if q, ok := p.quotes[s]; ok {
+			quotes = append(quotes, q)
+		}
+	}
+	if len(quotes) == 0 {
+		return nil, quote.ErrSymbolNotFound
+	}
+	return quotes, nil
+}
+
+var aapl = quote.Quote{Symbol: "AAPL", Close: 279.74, Provider: "fake"}
+
+func stockRequest(args ...string) contract.Request {
+	return contract.Request{Version: 1, CorrelationID: "c1", Command: "stock", Args: args, RoomID: 10}
+}
+
+func TestHandle(t *testing.T) {
+	bot := NewBot("StockBot", &fakeProvider{quotes: map[string]quote.Quote{"AAPL": aapl}})
+
+	res, err := bot.Handle(context.Background(), stockRequest("aapl"))
+	require.Nil(t, err)
+	assert.Equal(t, "c1", res.CorrelationID)
+	assert.Equal(t, uint(10), res.RoomID)
+	assert.Equal(t, "StockBot", res.Bot)
+	assert.Equal(t, "AAPL quote is $279.74 per share", res.Text)
+	assert.Nil(t, res.Error)
+
+	var quotes []quote.Quote
+	require.Nil(t, json.Unmarshal(res.Result, &quotes))
+	assert.Equal(t, []quote.Quote{aapl}, quotes)
+}
+
+func TestHandlePartial(t *testing.T) {
+	bot := NewBot("StockBot", &fakeProvider{quotes: map[string]quote.Quote{"AAPL": aapl}})
+
+	res, err := bot.Handle(context.Background(), stockRequest("AAPL", "XYZQ"))
+	require.Nil(t, err)
+	assert.Equal(t, "AAPL quote is $279.74 per share\nNo data found for XYZQ", res.Text)
+	assert.Nil(t, res.Error)
+}
+
+func TestHandleFailures(t *testing.T) {
+	cases := []struct {
+		name     string
+		provider *fakeProvider
+		req      contract.Request
+		code     string
+		text     string
+	}{
+		{name: "not found", provider: &fakeProvider{}, req: stockRequest("XYZQ"), code: contract.ErrorNotFound, text: "No data found for XYZQ"},
+		{name: "usage", provider: &fakeProvider{}, req: stockRequest(" "), code: contract.ErrorInvalidArgs, text: "Usage: /stock=AAPL or /stock AAPL,MSFT"},
+		{name: "timeout", provider: &fakeProvider{err: errors.New("timeout")}, req: stockRequest("AAPL"), code: contract.ErrorUnavailable, text: UnavailableMessage},
+		{name: "circuit open", provider: &fakeProvider{err: httpclient.ErrCircuitOpen}, req: stockRequest("AAPL"), code: contract.ErrorUnavailable, text: UnavailableMessage},
+		{name: "unknown command", provider: &fakeProvider{}, req: contract.Request{Command: "weather", RoomID: 10}, code: contract.ErrorUnknownCommand, text: "Unknown command /weather"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := NewBot("StockBot", c.provider).Handle(context.Background(), c.req)
+			require.Nil(t, err)
+			assert.Equal(t, uint(10), res.RoomID)
+			assert.Equal(t, c.text, res.Text)
+			assert.Equal(t, &contract.Error{Code: c.code, Message: c.text}, res.Error)
+			assert.Nil(t, res.Result)
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package stooq
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/hernanrocha/fin-chat/bot/quote"
+)
+
+// StatusError is returned when stooq answers with an unexpected HTTP status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("stooq: unexpected status code %d", e.StatusCode)
+}
+
+// MalformedCSVError is returned when the response is not a valid quotes CSV
+type MalformedCSVError struct {
+	Line   int
+	Reason string
+}
+
+func (e *MalformedCSVError) Error() string {
+	return fmt.Sprintf("stooq: malformed csv on line %d: %s", e.Line, e.Reason)
+}
+
+// Value used by stooq for missing fields
+const noData = "N/D"
+
+// Columns requested by f=sd2t2ohlcv
+var columns = []string{"symbol", "date", "time", "open", "high", "low", "close", "volume"}
+
+// ParseCSV parses a stooq quotes CSV with header. Columns are matched by
+// name, so their order does not matter. Rows without data (N/D or empty
+// fields) are skipped and quote.ErrSymbolNotFound is returned if no row
+// has data.
+func ParseCSV(r io.Reader) ([]quote.Quote, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, &MalformedCSVError{Line: 1, Reason: "missing header"}
+	}
+	if err != nil {
+		return nil, &MalformedCSVError{Line: 1, Reason: err.Error()}
+	}
+
+	index, err := headerIndex(header)
+	if err != nil {
+		return nil, err
+	}
+
+	var quotes []quote.Quote
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &MalformedCSVError{Line: line, Reason: err.Error()}
+		}
+
+		q, err := parseRow(index, row)
+		if err == quote.ErrSymbolNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, &MalformedCSVError{Line: line, Reason: err.Error()}
+		}
+		quotes = append(quotes, *q)
+	}
+
+	if len(quotes) == 0 {
+		return nil, quote.ErrSymbolNotFound
+	}
+
+	return quotes, nil
+}
+
+// headerIndex maps every required column to its position in the header
+func headerIndex(header []string) (map[string]int, error) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, c := range columns {
+		if _, ok := index[c]; !ok {
+			return nil, &MalformedCSVError{Line: 1, Reason: fmt.Sprintf("missing column %q", c)}
+		}
+	}
+
+	return index, nil
+}
+
+// parseRow parses a data row. quote.ErrSymbolNotFound is returned when
+// stooq has no quote for the symbol.
+func parseRow(index map[string]int, row []string) (*quote.Quote, error) {
+	field := func(name string) string {
+		return strings.TrimSpace(row[index[name]])
+	}
+
+	if isEmpty(field("date")) || isEmpty(field("close")) {
+		return nil, quote.ErrSymbolNotFound
+	}
+
+	prices := make(map[string]float64, 4)
+	for _, c := range []string{"open", "high", "low", "close"} {
+		if isEmpty(field(c)) {
+			continue
+		}
+		price, err := strconv.ParseFloat(field(c), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", c, field(c))
+		}
+		prices[c] = price
+	}
+
+	// Indices and FX pairs may not report volume
+	var volume int64
+	if v := field("volume"); !isEmpty(v) {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid volume %q", v)
+		}
+		volume = int64(parsed)
+	}
+
+	return &quote.Quote{
+		Symbol: field("symbol"),
+		Date:   field("date"),
+		Time:   field("time"),
+		Open:   prices["open"],
+		High:   prices["high"],
+		Low:    prices["low"],
+		Close:  prices["close"],
+		Volume: volume,
+	}, nil
+}
+
+func isEmpty(v string) bool {
+	return v == "" || v == noData
+}
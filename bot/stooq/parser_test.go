@@ -0,0 +1,73 @@
+package stooq
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/bot/quote"
+)
+
+var aapl = quote.Quote{
+	Symbol: "AAPL.US",
+	Date:   "2019-12-18",
+	Time:   "22:00:08",
+	Open:   279.8,
+	High:   281.9,
+	Low:    279.12,
+	Close:  279.74,
+	Volume: 29024687,
+}
+
+func TestParseCSV(t *testing.T) {
+	cases := []struct {
+		fixture string
+		quotes  []quote.Quote
+		err     error
+	}{
+		{fixture: "single.csv", quotes: []quote.Quote{aapl}},
+		{fixture: "reordered.csv", quotes: []quote.Quote{aapl}},
+		{fixture: "partial.csv", quotes: []quote.Quote{aapl}},
+		{fixture: "not_found.csv", err: quote.ErrSymbolNotFound},
+		{fixture: "empty_row.csv", err: quote.ErrSymbolNotFound},
+		{fixture: "header_only.csv", err: quote.ErrSymbolNotFound},
+		{fixture: "empty.csv", err: &MalformedCSVError{Line: 1, Reason: "missing header"}},
+		{fixture: "limit_exceeded.csv", err: &MalformedCSVError{Line: 1, Reason: `missing column "symbol"`}},
+		{fixture: "missing_column.csv", err: &MalformedCSVError{Line: 1, Reason: `missing column "close"`}},
+		{fixture: "invalid_number.csv", err: &MalformedCSVError{Line: 2, Reason: `invalid close "abc"`}},
+		{fixture: "short_row.csv", err: &MalformedCSVError{Line: 2, Reason: "record on line 2: wrong number of fields"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.fixture, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", c.fixture))
+			require.Nil(t, err)
+			defer f.Close()
+
+			quotes, err := ParseCSV(f)
+			assert.Equal(t, c.err, err)
+			assert.Equal(t, c.quotes, quotes)
+		})
+	}
+}
+
+func TestParseCSVMultiple(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "multiple.csv"))
+	require.Nil(t, err)
+	defer f.Close()
+
+	quotes, err := ParseCSV(f)
+	require.Nil(t, err)
+	require.Len(t, quotes, 4)
+
+	assert.Equal(t, aapl, quotes[0])
+	assert.Equal(t, "MSFT.US", quotes[1].Symbol)
+	assert.Equal(t, "^SPX", quotes[2].Symbol)
+	assert.Equal(t, 3191.14, quotes[2].Close)
+	assert.Zero(t, quotes[2].Volume)
+	assert.Equal(t, "EURUSD", quotes[3].Symbol)
+	assert.Equal(t, 1.11127, quotes[3].Close)
+}
@@ -1,78 +1,90 @@
 package stooq
 
 import (
-	"bufio"
 	"context"
-	"encoding/csv"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"net/url"
+	"strings"
 
-	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/hernanrocha/fin-chat/bot/quote"
 )
 
-type BotMessage struct {
-	RoomID  uint
-	Message string
+// DefaultURL is the stooq endpoint for last quotes in CSV format
+const DefaultURL = "http://stooq.com/q/l/"
+
+// Doer sends HTTP requests (e.g. *http.Client)
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
 }
 
-func StooqHandler(ctx context.Context, snsEvent events.SNSEvent) error {
-	if len(snsEvent.Records) == 0 {
-		return errors.New("No SQS message passed to function")
-	}
+// Provider gets quotes from stooq.com
+type Provider struct {
+	url    string
+	client Doer
+}
 
-	mySession := session.New()
-	svc := sqs.New(mySession)
+// NewProvider returns a stooq provider using the given endpoint and client
+func NewProvider(url string, client Doer) *Provider {
+	return &Provider{
+		url:    url,
+		client: client,
+	}
+}
 
-	for _, msg := range snsEvent.Records {
-		fmt.Printf("Got SQS message %q with body %q\n", msg.SNS.MessageID, msg.SNS.Message)
-		var req BotMessage
-		if err := json.Unmarshal([]byte(msg.SNS.Message), &req); err != nil {
-			return err
-		}
+// Name of the provider
+func (p *Provider) Name() string {
+	return "stooq"
+}
 
-		res, err := Handle(req.Message)
-		if err != nil {
-			return err
+// Quotes gets the quotes of all symbols with a single stooq request
+func (p *Provider) Quotes(ctx context.Context, symbols []string) ([]quote.Quote, error) {
+	// Map stooq symbols back to the requested ones
+	requested := make(map[string]string, len(symbols))
+	params := make([]string, 0, len(symbols))
+	for _, s := range symbols {
+		symbol := NormalizeSymbol(s)
+		if symbol == "" {
+			continue
 		}
+		requested[strings.ToUpper(symbol)] = s
+		params = append(params, url.QueryEscape(symbol))
+	}
 
-		resStr, _ := json.Marshal(&BotMessage{RoomID: req.RoomID, Message: res})
-		_, err = svc.SendMessage(&sqs.SendMessageInput{
-			MessageBody: aws.String(string(resStr)),
-			QueueUrl:    aws.String(os.Getenv("SQS_COMMANDS_RESPONSE_URL")),
-		})
-
-		if err != nil {
-			return err
-		}
+	if len(params) == 0 {
+		return nil, quote.ErrSymbolNotFound
 	}
 
-	return nil
-}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s?s=%s&f=sd2t2ohlcv&h&e=csv", p.url, strings.Join(params, "+")), nil)
+	if err != nil {
+		return nil, err
+	}
 
-func Handle(s string) (string, error) {
-	resp, err := http.Get(fmt.Sprintf("http://stooq.com/q/l/?s=%s.us&f=sd2t2ohlcv&h&e=csv", s))
+	resp, err := p.client.Do(req.WithContext(ctx))
 	if err != nil {
-		return fmt.Sprintf("Error getting HTTP response for %s", s), err
+		log.Printf("Error getting HTTP response for %v: %s \n", symbols, err)
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	reader := csv.NewReader(bufio.NewReader(resp.Body))
-	_, err = reader.Read()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Error getting quotes for %v: status %d \n", symbols, resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	quotes, err := ParseCSV(resp.Body)
 	if err != nil {
-		log.Printf("Error reading header: %s \n", err)
-		return fmt.Sprintf("Error obtaining info for %s", s), err
+		log.Printf("Error parsing quotes for %v: %s \n", symbols, err)
+		return nil, err
 	}
-	row, err := reader.Read()
-	if err != nil || len(row) <= 4 {
-		log.Printf("Error reading row: %s \n", err)
-		return fmt.Sprintf("Error obtaining info for %s", s), err
+
+	for i := range quotes {
+		if s, ok := requested[strings.ToUpper(quotes[i].Symbol)]; ok {
+			quotes[i].Symbol = s
+		}
+		quotes[i].Provider = p.Name()
 	}
-	log.Printf("%s quote is $%s per share \n", s, row[3])
-	return fmt.Sprintf("%s quote is $%s per share", s, row[3]), nil
+
+	return quotes, nil
 }
@@ -1,14 +1,86 @@
 package stooq
 
 import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/bot/quote"
 )
 
-func TestStooqHandler(t *testing.T) {
-	t.Skip("This test fails in CircleCI")
-	res, err := Handle("AAPL")
-	assert.Nil(t, err)
-	assert.Contains(t, res, "per share")
+// serveFixture starts a stooq stand-in answering every request with a fixture
+func serveFixture(t *testing.T, status int, fixture string) *httptest.Server {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", fixture))
+	require.Nil(t, err)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "sd2t2ohlcv", r.URL.Query().Get("f"))
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+}
+
+func TestProviderQuotes(t *testing.T) {
+	expected := aapl
+	expected.Symbol = "AAPL"
+	expected.Provider = "stooq"
+
+	cases := []struct {
+		name    string
+		status  int
+		fixture string
+		quotes  []quote.Quote
+		err     error
+	}{
+		{name: "quote", status: http.StatusOK, fixture: "single.csv", quotes: []quote.Quote{expected}},
+		{name: "partial", status: http.StatusOK, fixture: "partial.csv", quotes: []quote.Quote{expected}},
+		{name: "not found", status: http.StatusOK, fixture: "not_found.csv", err: quote.ErrSymbolNotFound},
+		{name: "status", status: http.StatusServiceUnavailable, fixture: "single.csv", err: &StatusError{StatusCode: 503}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := serveFixture(t, c.status, c.fixture)
+			defer s.Close()
+
+			p := NewProvider(s.URL, s.Client())
+			quotes, err := p.Quotes(context.Background(), []string{"AAPL", "XYZQ"})
+			assert.Equal(t, c.err, err)
+			assert.Equal(t, c.quotes, quotes)
+		})
+	}
+}
+
+func TestProviderRequest(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "aapl.us vod.uk ^spx eurusd", r.URL.Query().Get("s"))
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer s.Close()
+
+	p := NewProvider(s.URL, s.Client())
+	_, err := p.Quotes(context.Background(), []string{"AAPL", "VOD.UK", "^SPX", "EURUSD"})
+	assert.Equal(t, &StatusError{StatusCode: 404}, err)
+}
+
+func TestProviderMalformed(t *testing.T) {
+	s := serveFixture(t, http.StatusOK, "limit_exceeded.csv")
+	defer s.Close()
+
+	p := NewProvider(s.URL, s.Client())
+	_, err := p.Quotes(context.Background(), []string{"AAPL"})
+	_, ok := err.(*MalformedCSVError)
+	assert.True(t, ok)
+}
+
+func TestProviderNoSymbols(t *testing.T) {
+	p := NewProvider("http://localhost", http.DefaultClient)
+	_, err := p.Quotes(context.Background(), []string{" "})
+	assert.Equal(t, quote.ErrSymbolNotFound, err)
 }
@@ -0,0 +1,41 @@
+package stooq
+
+import (
+	"strings"
+)
+
+// Default market for symbols without exchange suffix
+const defaultMarket = ".us"
+
+// Currencies recognized on FX pairs (e.g. eurusd)
+var currencies = map[string]bool{
+	"usd": true, "eur": true, "gbp": true, "jpy": true, "chf": true,
+	"cad": true, "aud": true, "nzd": true, "sek": true, "nok": true,
+	"dkk": true, "pln": true, "czk": true, "huf": true, "try": true,
+	"mxn": true, "brl": true, "cny": true, "hkd": true, "sgd": true,
+	"zar": true, "inr": true, "krw": true, "rub": true, "ars": true,
+}
+
+// NormalizeSymbol converts a user symbol to the stooq format. Symbols with
+// an explicit exchange suffix (vod.uk, sap.de), indices (^spx) and FX pairs
+// (eurusd) are kept as they are, other tickers are looked up on US markets.
+func NormalizeSymbol(s string) string {
+	symbol := strings.ToLower(strings.TrimSpace(s))
+
+	switch {
+	case symbol == "":
+		return ""
+	case strings.Contains(symbol, "."):
+		return symbol
+	case strings.HasPrefix(symbol, "^"):
+		return symbol
+	case isFXPair(symbol):
+		return symbol
+	}
+
+	return symbol + defaultMarket
+}
+
+func isFXPair(symbol string) bool {
+	return len(symbol) == 6 && currencies[symbol[:3]] && currencies[symbol[3:]]
+}
@@ -0,0 +1,26 @@
+package stooq
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeSymbol(t *testing.T) {
+	cases := map[string]string{
+		"AAPL":    "aapl.us",
+		" msft ":  "msft.us",
+		"VOD.UK":  "vod.uk",
+		"sap.de":  "sap.de",
+		"7203.JP": "7203.jp",
+		"^SPX":    "^spx",
+		"EURUSD":  "eurusd",
+		"usdjpy":  "usdjpy",
+		"GOOGLE":  "google.us",
+		"":        "",
+	}
+
+	for input, expected := range cases {
+		assert.Equal(t, expected, NormalizeSymbol(input), input)
+	}
+}
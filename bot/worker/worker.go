@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hernanrocha/fin-chat/bot/stock"
+	"github.com/hernanrocha/fin-chat/contract"
+	"github.com/hernanrocha/fin-chat/messenger"
+)
+
+// Worker is a long-running bot answering command requests delivered by a
+// messenger backend
+type Worker struct {
+	consumer    messenger.BotCommandConsumer
+	bot         *stock.Bot
+	concurrency int
+	timeout     time.Duration
+}
+
+// New returns a worker processing up to concurrency requests at the same
+// time, each one with the given timeout
+func New(consumer messenger.BotCommandConsumer, bot *stock.Bot, concurrency int, timeout time.Duration) *Worker {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &Worker{
+		consumer:    consumer,
+		bot:         bot,
+		concurrency: concurrency,
+		timeout:     timeout,
+	}
+}
+
+// Run processes command requests until ctx is done. Requests being
+// processed are finished before it returns.
+func (w *Worker) Run(ctx context.Context) error {
+	log.Printf("Starting bot worker with %d handlers\n", w.concurrency)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, w.concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.consumer.StartHandler(ctx, w.Handle); err != nil {
+				errs <- err
+				// Stop the other handlers
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	log.Println("Bot worker stopped")
+	return <-errs
+}
+
+// Handle answers a single command request
+func (w *Worker) Handle(req contract.Request) (contract.Response, error) {
+	// Requests are not bound to the worker context, so they are finished on shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+
+	res, err := w.bot.Handle(ctx, req)
+	if err != nil {
+		return contract.Response{}, err
+	}
+
+	return *res, nil
+}
@@ -0,0 +1,142 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/bot/quote"
+	"github.com/hernanrocha/fin-chat/bot/stock"
+	"github.com/hernanrocha/fin-chat/contract"
+	"github.com/hernanrocha/fin-chat/messenger"
+)
+
+// fakeConsumer delivers the requests sent on its channel and collects the responses
+type fakeConsumer struct {
+	requests chan contract.Request
+
+	mu        sync.Mutex
+	responses []contract.Response
+}
+
+func (c *fakeConsumer) StartHandler(ctx context.Context, fn func(contract.Request) (contract.Response, error)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case req := <-c.requests:
+			resp, err := fn(req)
+			if err != nil {
+				return err
+			}
+			c.mu.Lock()
+			c.responses = append(c.responses, resp)
+			c.mu.Unlock()
+		}
+	}
+}
+
+// slowProvider answers every symbol after a delay, tracking concurrent calls
+type slowProvider struct {
+	active int64
+	max    int64
+}
+
+func (p *slowProvider) Name() string {
+	return "slow"
+}
+
+func (p *slowProvider) Quotes(ctx context.Context, symbols []string) ([]quote.Quote, error) {
+	active := atomic.AddInt64(&p.active, 1)
+	defer atomic.AddInt64(&p.active, -1)
+	for {
+		max := atomic.LoadInt64(&p.max)
+		if active <= max || atomic.CompareAndSwapInt64(&p.max, max, active) {
+			break
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	return []quote.Quote{{Symbol: symbols[0], Close: 10}}, nil
+}
+
+func TestWorkerRun(t *testing.T) {
+	consumer := &fakeConsumer{requests: make(chan contract.Request)}
+	provider := &slowProvider{}
+	w := New(consumer, stock.NewBot("Bot", provider), 2, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx)
+	}()
+
+	for i := 0; i < 6; i++ {
+		consumer.requests <- contract.NewRequest("stock", []string{"AAPL"}, contract.Requester{}, uint(i))
+	}
+	cancel()
+	require.Nil(t, <-done)
+
+	// Every request was answered, with at most two at the same time
+	assert.Len(t, consumer.responses, 6)
+	assert.EqualValues(t, 2, atomic.LoadInt64(&provider.max))
+}
+
+type failingConsumer struct{}
+
+func (c *failingConsumer) StartHandler(ctx context.Context, fn func(contract.Request) (contract.Response, error)) error {
+	return errors.New("connection closed")
+}
+
+func TestWorkerRunError(t *testing.T) {
+	w := New(&failingConsumer{}, stock.NewBot("Bot", &slowProvider{}), 3, time.Second)
+	assert.EqualError(t, w.Run(context.Background()), "connection closed")
+}
+
+func TestWorkerHandle(t *testing.T) {
+	w := New(&fakeConsumer{}, stock.NewBot("Bot", &slowProvider{}), 1, time.Second)
+
+	req := contract.NewRequest("stock", []string{"AAPL"}, contract.Requester{Username: "jdoe"}, 10)
+	resp, err := w.Handle(req)
+	require.Nil(t, err)
+	assert.Equal(t, req.CorrelationID, resp.CorrelationID)
+	assert.Equal(t, uint(10), resp.RoomID)
+	assert.Equal(t, "AAPL quote is $10.00 per share", resp.Text)
+	assert.Nil(t, resp.Error)
+
+	var quotes []quote.Quote
+	require.Nil(t, json.Unmarshal(resp.Result, &quotes))
+	assert.Equal(t, []quote.Quote{{Symbol: "AAPL", Close: 10}}, quotes)
+}
+
+func TestWorkerMemoryMessenger(t *testing.T) {
+	m := messenger.NewMemoryMessenger(10)
+	w := New(m, stock.NewBot("Bot", &slowProvider{}), 2, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	responses := make(chan contract.Response, 1)
+	go m.StartConsumer(ctx, func(resp contract.Response) error {
+		responses <- resp
+		return nil
+	})
+
+	require.Nil(t, m.Publish(contract.NewRequest("stock", []string{"aapl"}, contract.Requester{}, 3)))
+
+	select {
+	case resp := <-responses:
+		assert.Equal(t, uint(3), resp.RoomID)
+		assert.Equal(t, "AAPL quote is $10.00 per share", resp.Text)
+	case <-time.After(time.Second):
+		t.Fatal("response not received")
+	}
+}
@@ -0,0 +1,198 @@
+// Package contract defines the wire format of bot command requests and
+// responses shared by the chat service and the bots.
+//
+// Messages carry a schema version. Decoders ignore unknown fields, so
+// producers can add fields without breaking older consumers, and still
+// accept the legacy unversioned {RoomID, Message} messages.
+package contract
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Version of the schema written by this package
+const Version = 1
+
+// Error codes of failed commands
+const (
+	// The command arguments are missing or invalid
+	ErrorInvalidArgs = "invalid_args"
+	// The requested data does not exist (e.g. unknown stock symbol)
+	ErrorNotFound = "not_found"
+	// A dependency of the bot failed, the command can be retried later
+	ErrorUnavailable = "unavailable"
+	// No bot handles the command
+	ErrorUnknownCommand = "unknown_command"
+	// Unexpected bot failure
+	ErrorInternal = "internal"
+)
+
+// Requester is the chat user sending a command
+type Requester struct {
+	UserID   uint   `json:"user_id,omitempty"`
+	Username string `json:"username"`
+}
+
+// Request is a command sent to a bot (e.g. "/stock AAPL,MSFT")
+type Request struct {
+	Version int `json:"version"`
+	// Identifies the request, copied to its response
+	CorrelationID string    `json:"correlation_id"`
+	Command       string    `json:"command"`
+	Args          []string  `json:"args"`
+	Requester     Requester `json:"requester"`
+	RoomID        uint      `json:"room_id"`
+}
+
+// Error of a failed command
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Response is the answer of a bot to a command request
+type Response struct {
+	Version       int    `json:"version"`
+	CorrelationID string `json:"correlation_id"`
+	Command       string `json:"command"`
+	RoomID        uint   `json:"room_id"`
+	// Username of the bot answering, which posts the message on the room.
+	// Responses without it are posted by the default bot user.
+	Bot string `json:"bot,omitempty"`
+	// Message posted on the room
+	Text string `json:"text"`
+	// Structured result of the command (e.g. stock quotes)
+	Result json.RawMessage `json:"result,omitempty"`
+	// Set when the command failed. Text still holds a message for the room.
+	Error *Error `json:"error,omitempty"`
+}
+
+// NewRequest returns a request of the current version with a new
+// correlation ID
+func NewRequest(command string, args []string, requester Requester, roomID uint) Request {
+	return Request{
+		Version:       Version,
+		CorrelationID: NewCorrelationID(),
+		Command:       command,
+		Args:          args,
+		Requester:     requester,
+		RoomID:        roomID,
+	}
+}
+
+// Reply returns a response of the current version to the request
+func (r Request) Reply(text string) Response {
+	return Response{
+		Version:       Version,
+		CorrelationID: r.CorrelationID,
+		Command:       r.Command,
+		RoomID:        r.RoomID,
+		Text:          text,
+	}
+}
+
+// Fail returns an error response to the request. The message is also
+// posted on the room.
+func (r Request) Fail(code, message string) Response {
+	res := r.Reply(message)
+	res.Error = &Error{Code: code, Message: message}
+	return res
+}
+
+// NewCorrelationID returns a random ID
+func NewCorrelationID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ErrInvalidLegacy is returned when decoding a legacy message without a
+// room or a message
+var ErrInvalidLegacy = errors.New("contract: legacy message without RoomID or Message")
+
+// UnsupportedVersionError is returned when decoding a message of a newer
+// version than this package, which cannot be handled reliably
+type UnsupportedVersionError struct {
+	Version int
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("contract: unsupported version %d (current version is %d)", e.Version, Version)
+}
+
+// Unversioned message used before the contract was introduced, for both
+// requests and responses
+type legacyMessage struct {
+	RoomID  uint
+	Message string
+	Quotes  json.RawMessage
+}
+
+// DecodeRequest decodes a request of any version, including legacy
+// {RoomID, Message} stock requests
+func DecodeRequest(data []byte) (Request, error) {
+	var req Request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return Request{}, err
+	}
+	if req.Version > Version {
+		return Request{}, &UnsupportedVersionError{req.Version}
+	}
+	if req.Version > 0 || req.Command != "" {
+		return req, nil
+	}
+
+	legacy, err := decodeLegacy(data)
+	if err != nil {
+		return Request{}, err
+	}
+
+	return Request{
+		Command: "stock",
+		Args:    []string{legacy.Message},
+		RoomID:  legacy.RoomID,
+	}, nil
+}
+
+// DecodeResponse decodes a response of any version, including legacy
+// {RoomID, Message, Quotes} responses
+func DecodeResponse(data []byte) (Response, error) {
+	var res Response
+	if err := json.Unmarshal(data, &res); err != nil {
+		return Response{}, err
+	}
+	if res.Version > Version {
+		return Response{}, &UnsupportedVersionError{res.Version}
+	}
+	if res.Version > 0 || res.Command != "" {
+		return res, nil
+	}
+
+	legacy, err := decodeLegacy(data)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return Response{
+		Command: "stock",
+		RoomID:  legacy.RoomID,
+		Text:    legacy.Message,
+		Result:  legacy.Quotes,
+	}, nil
+}
+
+// decodeLegacy decodes a legacy message, which must have a room and a message
+func decodeLegacy(data []byte) (legacyMessage, error) {
+	var legacy legacyMessage
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return legacyMessage{}, err
+	}
+	if legacy.RoomID == 0 || legacy.Message == "" {
+		return legacyMessage{}, ErrInvalidLegacy
+	}
+	return legacy, nil
+}
@@ -0,0 +1,162 @@
+package contract
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run "go test ./contract -update" after an intended change of the wire format
+var update = flag.Bool("update", false, "update golden files")
+
+var request = Request{
+	Version:       1,
+	CorrelationID: "4f1c2a9b8e7d6c5b4a39281706f5e4d3",
+	Command:       "stock",
+	Args:          []string{"AAPL", "MSFT"},
+	Requester:     Requester{UserID: 7, Username: "jdoe"},
+	RoomID:        3,
+}
+
+var response = Response{
+	Version:       1,
+	CorrelationID: "4f1c2a9b8e7d6c5b4a39281706f5e4d3",
+	Command:       "stock",
+	RoomID:        3,
+	Bot:           "StockBot",
+	Text:          "AAPL quote is $93.50 per share",
+	Result:        json.RawMessage(`[{"symbol":"AAPL","close":93.5}]`),
+}
+
+var errorResponse = Response{
+	Version:       1,
+	CorrelationID: "4f1c2a9b8e7d6c5b4a39281706f5e4d3",
+	Command:       "stock",
+	RoomID:        3,
+	Text:          "No data found for XYZQ",
+	Error:         &Error{Code: ErrorNotFound, Message: "No data found for XYZQ"},
+}
+
+func golden(t *testing.T, name string, v interface{}) {
+	path := filepath.Join("testdata", name)
+	data, err := json.MarshalIndent(v, "", "  ")
+	require.Nil(t, err)
+	data = append(data, '\n')
+
+	if *update {
+		require.Nil(t, ioutil.WriteFile(path, data, 0644))
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, string(expected), string(data))
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	require.Nil(t, err)
+	return data
+}
+
+func TestGolden(t *testing.T) {
+	golden(t, "request_v1.json", request)
+	golden(t, "response_v1.json", response)
+	golden(t, "response_error_v1.json", errorResponse)
+}
+
+func TestDecodeRequest(t *testing.T) {
+	cases := []struct {
+		name     string
+		fixture  string
+		expected Request
+	}{
+		{name: "v1", fixture: "request_v1.json", expected: request},
+		{name: "unknown fields", fixture: "request_unknown_fields.json", expected: request},
+		{name: "legacy", fixture: "request_legacy.json", expected: Request{Command: "stock", Args: []string{"AAPL,MSFT"}, RoomID: 3}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, err := DecodeRequest(readFixture(t, c.fixture))
+			require.Nil(t, err)
+			assert.Equal(t, c.expected, req)
+		})
+	}
+
+	_, err := DecodeRequest([]byte(`"AAPL"`))
+	assert.NotNil(t, err)
+
+	// Legacy requests need a room and a message
+	_, err = DecodeRequest([]byte(`{"RoomID":3}`))
+	assert.Equal(t, ErrInvalidLegacy, err)
+	_, err = DecodeRequest([]byte(`{}`))
+	assert.Equal(t, ErrInvalidLegacy, err)
+
+	// Newer versions are rejected
+	_, err = DecodeRequest([]byte(`{"version":2,"command":"stock","room_id":3}`))
+	assert.Equal(t, &UnsupportedVersionError{Version: 2}, err)
+}
+
+func TestDecodeResponse(t *testing.T) {
+	legacy := Response{
+		Command: "stock",
+		RoomID:  3,
+		Text:    "AAPL quote is $93.50 per share",
+		Result:  json.RawMessage(`[{"symbol":"AAPL","close":93.5}]`),
+	}
+
+	cases := []struct {
+		name     string
+		fixture  string
+		expected Response
+	}{
+		{name: "v1", fixture: "response_v1.json", expected: response},
+		{name: "error", fixture: "response_error_v1.json", expected: errorResponse},
+		{name: "unknown fields", fixture: "response_unknown_fields.json", expected: response},
+		{name: "legacy", fixture: "response_legacy.json", expected: legacy},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := DecodeResponse(readFixture(t, c.fixture))
+			require.Nil(t, err)
+
+			// Compare results as values, their formatting may differ
+			if c.expected.Result != nil {
+				assert.JSONEq(t, string(c.expected.Result), string(res.Result))
+			}
+			c.expected.Result, res.Result = nil, nil
+			assert.Equal(t, c.expected, res)
+		})
+	}
+
+	_, err := DecodeResponse([]byte(`{"Message":"AAPL quote is $93.50 per share"}`))
+	assert.Equal(t, ErrInvalidLegacy, err)
+	_, err = DecodeResponse([]byte(`{"version":2,"command":"stock","room_id":3,"text":"Hi"}`))
+	assert.Equal(t, &UnsupportedVersionError{Version: 2}, err)
+}
+
+func TestReply(t *testing.T) {
+	req := NewRequest("stock", []string{"AAPL"}, Requester{Username: "jdoe"}, 3)
+	assert.Equal(t, Version, req.Version)
+	assert.Len(t, req.CorrelationID, 32)
+	assert.NotEqual(t, req.CorrelationID, NewCorrelationID())
+
+	res := req.Reply("AAPL quote is $93.50 per share")
+	assert.Equal(t, Response{
+		Version:       Version,
+		CorrelationID: req.CorrelationID,
+		Command:       "stock",
+		RoomID:        3,
+		Text:          "AAPL quote is $93.50 per share",
+	}, res)
+
+	res = req.Fail(ErrorInvalidArgs, "Usage: /stock=AAPL")
+	assert.Equal(t, &Error{Code: ErrorInvalidArgs, Message: "Usage: /stock=AAPL"}, res.Error)
+	assert.Equal(t, "Usage: /stock=AAPL", res.Text)
+}
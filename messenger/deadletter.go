@@ -0,0 +1,43 @@
+package messenger
+
+import (
+	"fmt"
+	"time"
+)
+
+// Reasons for dead-lettering a message
+const (
+	// The message body cannot be decoded
+	ReasonMalformed = "malformed"
+	// The handler failed on every delivery attempt
+	ReasonHandlerFailed = "handler_failed"
+)
+
+// DeadLetter is a command response that could not be processed
+type DeadLetter struct {
+	ID       string
+	Body     string
+	Reason   string
+	Error    string
+	Attempts int
+	FailedAt time.Time
+}
+
+// InvalidDeadLetterIDError is returned when redriving an ID that is not
+// valid for the backend
+type InvalidDeadLetterIDError struct {
+	ID string
+}
+
+func (e *InvalidDeadLetterIDError) Error() string {
+	return fmt.Sprintf("invalid dead letter id %q", e.ID)
+}
+
+// DeadLetterQueue lists and redrives dead-lettered command responses
+type DeadLetterQueue interface {
+	// List up to max dead letters
+	ListDeadLetters(max int) ([]DeadLetter, error)
+	// Send the given dead letters (all of them if ids is empty) back to the
+	// command response queue. It returns the number of redriven messages.
+	RedriveDeadLetters(ids []string) (int, error)
+}
@@ -0,0 +1,76 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/hernanrocha/fin-chat/contract"
+)
+
+// ErrQueueFull is returned by the in-memory messenger when no handler keeps
+// up with the published requests
+var ErrQueueFull = errors.New("messenger: command request queue is full")
+
+// MemoryMessenger dispatches command requests to in-process handlers
+// through channels. It needs no broker, so it is meant for local
+// development and tests.
+type MemoryMessenger struct {
+	requests  chan contract.Request
+	responses chan contract.Response
+}
+
+// NewMemoryMessenger returns an in-memory messenger buffering up to size
+// requests and responses
+func NewMemoryMessenger(size int) *MemoryMessenger {
+	return &MemoryMessenger{
+		requests:  make(chan contract.Request, size),
+		responses: make(chan contract.Response, size),
+	}
+}
+
+// Publish queues a command request without blocking
+func (m *MemoryMessenger) Publish(req contract.Request) error {
+	select {
+	case m.requests <- req:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// StartConsumer calls fn with every command response until ctx is done
+func (m *MemoryMessenger) StartConsumer(ctx context.Context, fn func(contract.Response) error) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case resp := <-m.responses:
+			if err := fn(resp); err != nil {
+				log.Printf("Error handling command response: %s\n", err)
+			}
+		}
+	}
+}
+
+// StartHandler calls fn with every command request until ctx is done
+func (m *MemoryMessenger) StartHandler(ctx context.Context, fn func(contract.Request) (contract.Response, error)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case req := <-m.requests:
+			resp, err := fn(req)
+			if err != nil {
+				log.Printf("Error handling command request: %s\n", err)
+				continue
+			}
+
+			select {
+			case m.responses <- resp:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
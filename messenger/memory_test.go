@@ -0,0 +1,68 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hernanrocha/fin-chat/contract"
+)
+
+var (
+	_ BotCommandMessenger = (*MemoryMessenger)(nil)
+	_ BotCommandConsumer  = (*MemoryMessenger)(nil)
+)
+
+func TestMemoryMessenger(t *testing.T) {
+	m := NewMemoryMessenger(10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.StartHandler(ctx, func(req contract.Request) (contract.Response, error) {
+		if req.Args[0] == "fail" {
+			return contract.Response{}, errors.New("failed")
+		}
+		return req.Reply("re: " + req.Args[0]), nil
+	})
+
+	responses := make(chan contract.Response, 10)
+	go m.StartConsumer(ctx, func(resp contract.Response) error {
+		responses <- resp
+		return nil
+	})
+
+	failing := contract.NewRequest("echo", []string{"fail"}, contract.Requester{}, 1)
+	req := contract.NewRequest("echo", []string{"hello"}, contract.Requester{}, 2)
+	assert.Nil(t, m.Publish(failing))
+	assert.Nil(t, m.Publish(req))
+
+	select {
+	case resp := <-responses:
+		assert.Equal(t, req.Reply("re: hello"), resp)
+	case <-time.After(time.Second):
+		t.Fatal("response not received")
+	}
+}
+
+func TestMemoryMessengerQueueFull(t *testing.T) {
+	m := NewMemoryMessenger(1)
+
+	req := contract.NewRequest("stock", []string{"AAPL"}, contract.Requester{}, 1)
+	assert.Nil(t, m.Publish(req))
+	assert.Equal(t, ErrQueueFull, m.Publish(req))
+}
+
+func TestMemoryMessengerHandlerStops(t *testing.T) {
+	m := NewMemoryMessenger(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := m.StartHandler(ctx, func(req contract.Request) (contract.Response, error) {
+		return req.Reply(""), nil
+	})
+	assert.Nil(t, err)
+}
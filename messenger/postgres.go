@@ -0,0 +1,404 @@
+package messenger
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/hernanrocha/fin-chat/contract"
+)
+
+const (
+	// Queues stored on the jobs table
+	postgresRequestQueue  = "requests"
+	postgresResponseQueue = "responses"
+
+	// Channel notified when a job is enqueued. The payload is the queue name.
+	postgresChannel = "fin_chat_command_jobs"
+)
+
+// Jobs are stored on the command_jobs table, created by the service
+// migrations
+const enqueueJob = `INSERT INTO command_jobs (queue, payload) VALUES ($1, $2)`
+
+const notifyJob = `SELECT pg_notify($1, $2)`
+
+// claimJob takes the oldest visible job of a queue. Jobs still processing
+// after the visibility timeout are claimed again, as their worker is
+// assumed dead.
+const claimJob = `
+UPDATE command_jobs
+SET status = 'processing', attempts = attempts + 1, visible_at = now() + $2 * interval '1 millisecond', updated_at = now()
+WHERE id = (
+	SELECT id FROM command_jobs
+	WHERE queue = $1 AND status IN ('pending', 'processing') AND visible_at <= now()
+	ORDER BY id
+	FOR UPDATE SKIP LOCKED
+	LIMIT 1
+)
+RETURNING id, payload, attempts`
+
+// The jobs are only completed, retried or killed by the worker holding the
+// claim: once its visibility timeout expires, the job may be claimed again,
+// increasing its attempts.
+const deleteJob = `DELETE FROM command_jobs WHERE id = $1 AND status = 'processing' AND attempts = $2`
+
+const retryJob = `
+UPDATE command_jobs
+SET status = 'pending', last_error = $2, visible_at = now() + $3 * interval '1 millisecond', updated_at = now()
+WHERE id = $1 AND status = 'processing' AND attempts = $4`
+
+const killJob = `
+UPDATE command_jobs
+SET status = 'dead', last_error = $2, reason = $3, updated_at = now()
+WHERE id = $1 AND status = 'processing' AND attempts = $4`
+
+const listDeadJobs = `
+SELECT id, payload, reason, last_error, attempts, updated_at FROM command_jobs
+WHERE queue = $1 AND status = 'dead'
+ORDER BY id
+LIMIT $2`
+
+const redriveJobs = `
+UPDATE command_jobs
+SET status = 'pending', attempts = 0, last_error = NULL, reason = NULL, visible_at = now(), updated_at = now()
+WHERE queue = $1 AND status = 'dead' AND (cardinality($2::bigint[]) = 0 OR id = ANY($2))`
+
+// PostgresConfig of the Postgres job queue
+type PostgresConfig struct {
+	// Queue of the command requests handled by the bot
+	RequestQueue string
+	// Queues of the commands served by other bots
+	Routes Routes
+
+	// Time a claimed job stays hidden from other workers
+	VisibilityTimeout time.Duration
+	// Attempts before a job is moved to the dead-letter state
+	MaxAttempts int
+	// Delay before a failed job is retried
+	RetryDelay time.Duration
+	// Interval between polls when no notification arrives
+	PollInterval time.Duration
+}
+
+// DefaultPostgresConfig is used for zero values of PostgresConfig
+var DefaultPostgresConfig = PostgresConfig{
+	RequestQueue:      postgresRequestQueue,
+	VisibilityTimeout: 30 * time.Second,
+	MaxAttempts:       3,
+	RetryDelay:        5 * time.Second,
+	PollInterval:      5 * time.Second,
+}
+
+// NewPostgresMessenger returns a durable job queue backend stored on the
+// command_jobs table. dsn is used to LISTEN for new jobs; without it the
+// queue is polled.
+func NewPostgresMessenger(db *sql.DB, dsn string, config PostgresConfig) *postgresCommandMessenger {
+	d := DefaultPostgresConfig
+	if config.RequestQueue == "" {
+		config.RequestQueue = d.RequestQueue
+	}
+	if config.VisibilityTimeout <= 0 {
+		config.VisibilityTimeout = d.VisibilityTimeout
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = d.MaxAttempts
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = d.RetryDelay
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = d.PollInterval
+	}
+
+	return &postgresCommandMessenger{
+		db:     db,
+		dsn:    dsn,
+		config: config,
+	}
+}
+
+type postgresCommandMessenger struct {
+	db     *sql.DB
+	dsn    string
+	config PostgresConfig
+}
+
+// postgresJob is a claimed job
+type postgresJob struct {
+	ID       int64
+	Payload  []byte
+	Attempts int
+}
+
+// malformedError wraps payload decoding errors, which retrying cannot fix
+type malformedError struct {
+	error
+}
+
+// errClaimLost is returned when a job was claimed by another worker after
+// the visibility timeout of its claim expired
+var errClaimLost = errors.New("messenger: job claimed by another worker")
+
+// claimed checks that a job update was made by the worker holding the claim
+func claimed(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errClaimLost
+	}
+	return nil
+}
+
+// enqueue stores a job and notifies the listeners of the queue
+func (p *postgresCommandMessenger) enqueue(tx *sql.Tx, queue string, msg interface{}) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(enqueueJob, queue, payload); err != nil {
+		return err
+	}
+
+	// Delivered on commit
+	_, err = tx.Exec(notifyJob, postgresChannel, queue)
+	return err
+}
+
+// claim takes the next visible job of a queue. It returns nil if there is none.
+func (p *postgresCommandMessenger) claim(queue string) (*postgresJob, error) {
+	job := &postgresJob{}
+	err := p.db.QueryRow(claimJob, queue, milliseconds(p.config.VisibilityTimeout)).Scan(&job.ID, &job.Payload, &job.Attempts)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// fail schedules a retry of a job, or moves it to the dead-letter state
+// once it runs out of attempts
+func (p *postgresCommandMessenger) fail(job *postgresJob, cause error) error {
+	if job.Attempts >= p.config.MaxAttempts {
+		log.Printf("Job %d failed %d times, moving it to dead letters: %s\n", job.ID, job.Attempts, cause)
+		return claimed(p.db.Exec(killJob, job.ID, cause.Error(), ReasonHandlerFailed, job.Attempts))
+	}
+
+	log.Printf("Job %d failed (attempt %d), retrying in %s: %s\n", job.ID, job.Attempts, p.config.RetryDelay, cause)
+	return claimed(p.db.Exec(retryJob, job.ID, cause.Error(), milliseconds(p.config.RetryDelay), job.Attempts))
+}
+
+// jobHandler handles the payload of a job outside of any transaction, so
+// slow handlers do not hold a connection. It returns the writes to commit
+// along with the job completion, if any.
+type jobHandler func(payload []byte) (func(*sql.Tx) error, error)
+
+// process runs fn on the payload of a claimed job, and completes the job in
+// a transaction with the writes fn returns. Those writes are rolled back if
+// the job was claimed again, but the other effects of fn are not: a job may
+// be handled more than once. Jobs failing with a malformedError are dead at
+// once.
+func (p *postgresCommandMessenger) process(job *postgresJob, fn jobHandler) error {
+	if job.Attempts > p.config.MaxAttempts {
+		// Its worker died after the last attempt
+		return p.fail(job, fmt.Errorf("visibility timeout expired"))
+	}
+
+	complete, err := fn(job.Payload)
+	if err != nil {
+		if _, ok := err.(*malformedError); ok {
+			return claimed(p.db.Exec(killJob, job.ID, err.Error(), ReasonMalformed, job.Attempts))
+		}
+		return p.fail(job, err)
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if complete != nil {
+		if err := complete(tx); err != nil {
+			tx.Rollback()
+			return p.fail(job, err)
+		}
+	}
+
+	if err := claimed(tx.Exec(deleteJob, job.ID, job.Attempts)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// consume processes the jobs of a queue until ctx is done. Workers are
+// woken up by notifications and poll the queue as a fallback.
+func (p *postgresCommandMessenger) consume(ctx context.Context, queue string, fn jobHandler) error {
+	var notifications <-chan *pq.Notification
+	if p.dsn != "" {
+		listener := pq.NewListener(p.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Printf("Postgres listener error: %s\n", err)
+			}
+		})
+		defer listener.Close()
+
+		if err := listener.Listen(postgresChannel); err != nil {
+			return err
+		}
+		notifications = listener.Notify
+	}
+
+	log.Printf("Waiting for jobs from %s...\n", queue)
+	for ctx.Err() == nil {
+		job, err := p.claim(queue)
+		if err != nil {
+			log.Printf("Error claiming job from %s: %s\n", queue, err)
+		}
+
+		if job != nil {
+			if err := p.process(job, fn); err != nil {
+				log.Printf("Error processing job %d: %s\n", job.ID, err)
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-notifications:
+		case <-time.After(p.config.PollInterval):
+		}
+	}
+
+	return nil
+}
+
+// Publish a command request message
+func (p *postgresCommandMessenger) Publish(req contract.Request) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	queue := p.config.Routes.destination(req.Command, postgresRequestQueue)
+	if err := p.enqueue(tx, queue, req); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Start command request message handler. The response is enqueued in the
+// same transaction that completes the request.
+func (p *postgresCommandMessenger) StartHandler(ctx context.Context, fn func(contract.Request) (contract.Response, error)) error {
+	return p.consume(ctx, p.config.RequestQueue, func(payload []byte) (func(*sql.Tx) error, error) {
+		log.Printf("Received command request: %s\n", payload)
+
+		req, err := contract.DecodeRequest(payload)
+		if err != nil {
+			return nil, &malformedError{err}
+		}
+
+		resp, err := fn(req)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(tx *sql.Tx) error {
+			return p.enqueue(tx, postgresResponseQueue, resp)
+		}, nil
+	})
+}
+
+// Start command response message consumer. A response claimed again after
+// its visibility timeout is handled twice, so fn must be idempotent (e.g.
+// by correlation ID).
+func (p *postgresCommandMessenger) StartConsumer(ctx context.Context, fn func(contract.Response) error) error {
+	return p.consume(ctx, postgresResponseQueue, func(payload []byte) (func(*sql.Tx) error, error) {
+		log.Printf("Received command response: %s\n", payload)
+
+		res, err := contract.DecodeResponse(payload)
+		if err != nil {
+			return nil, &malformedError{err}
+		}
+		return nil, fn(res)
+	})
+}
+
+// ListDeadLetters lists up to max dead command responses
+func (p *postgresCommandMessenger) ListDeadLetters(max int) ([]DeadLetter, error) {
+	rows, err := p.db.Query(listDeadJobs, postgresResponseQueue, max)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	letters := []DeadLetter{}
+	for rows.Next() {
+		var id int64
+		var reason, lastError sql.NullString
+		letter := DeadLetter{}
+		if err := rows.Scan(&id, &letter.Body, &reason, &lastError, &letter.Attempts, &letter.FailedAt); err != nil {
+			return nil, err
+		}
+		letter.ID = strconv.FormatInt(id, 10)
+		letter.Reason = reason.String
+		letter.Error = lastError.String
+		letters = append(letters, letter)
+	}
+
+	return letters, rows.Err()
+}
+
+// RedriveDeadLetters makes dead command responses pending again
+func (p *postgresCommandMessenger) RedriveDeadLetters(ids []string) (int, error) {
+	jobIDs := make(pq.Int64Array, 0, len(ids))
+	for _, id := range ids {
+		jobID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return 0, &InvalidDeadLetterIDError{ID: id}
+		}
+		jobIDs = append(jobIDs, jobID)
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(redriveJobs, postgresResponseQueue, jobIDs)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if _, err := tx.Exec(notifyJob, postgresChannel, postgresResponseQueue); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	count, _ := result.RowsAffected()
+	return int(count), tx.Commit()
+}
+
+func milliseconds(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
@@ -0,0 +1,242 @@
+package messenger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/contract"
+)
+
+var (
+	_ BotCommandMessenger = (*postgresCommandMessenger)(nil)
+	_ BotCommandConsumer  = (*postgresCommandMessenger)(nil)
+	_ DeadLetterQueue     = (*postgresCommandMessenger)(nil)
+)
+
+func newMockPostgres(t *testing.T) (*postgresCommandMessenger, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	return NewPostgresMessenger(db, "", PostgresConfig{MaxAttempts: 2}), mock
+}
+
+var testRequest = contract.Request{
+	Version:       1,
+	CorrelationID: "c1",
+	Command:       "stock",
+	Args:          []string{"AAPL"},
+	Requester:     contract.Requester{Username: "jdoe"},
+	RoomID:        1,
+}
+
+const testRequestJSON = `{"version":1,"correlation_id":"c1","command":"stock","args":["AAPL"],"requester":{"username":"jdoe"},"room_id":1}`
+
+func TestPostgresPublish(t *testing.T) {
+	p, mock := newMockPostgres(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO command_jobs").
+		WithArgs("requests", []byte(testRequestJSON)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("SELECT pg_notify").
+		WithArgs("fin_chat_command_jobs", "requests").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	assert.Nil(t, p.Publish(testRequest))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresPublishRouted(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	p := NewPostgresMessenger(db, "", PostgresConfig{Routes: Routes{"fx": "fx-requests"}})
+
+	req := testRequest
+	req.Command = "fx"
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO command_jobs").
+		WithArgs("fx-requests", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("SELECT pg_notify").
+		WithArgs("fin_chat_command_jobs", "fx-requests").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	assert.Nil(t, p.Publish(req))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresClaimEmpty(t *testing.T) {
+	p, mock := newMockPostgres(t)
+
+	mock.ExpectQuery("FOR UPDATE SKIP LOCKED").
+		WithArgs("requests", int64(30000)).
+		WillReturnError(sql.ErrNoRows)
+
+	job, err := p.claim("requests")
+	assert.Nil(t, err)
+	assert.Nil(t, job)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresProcess(t *testing.T) {
+	p, mock := newMockPostgres(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM command_jobs").WithArgs(int64(7), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var received []byte
+	job := &postgresJob{ID: 7, Payload: []byte(testRequestJSON), Attempts: 1}
+	err := p.process(job, func(payload []byte) (func(*sql.Tx) error, error) {
+		received = payload
+		return nil, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, testRequestJSON, string(received))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresProcessRetry(t *testing.T) {
+	p, mock := newMockPostgres(t)
+
+	// Failed jobs open no transaction
+	mock.ExpectExec("SET status = 'pending'").
+		WithArgs(int64(7), "failed", int64(5000), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	job := &postgresJob{ID: 7, Payload: []byte(testRequestJSON), Attempts: 1}
+	err := p.process(job, func(payload []byte) (func(*sql.Tx) error, error) {
+		return nil, errors.New("failed")
+	})
+	assert.Nil(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresProcessClaimLost(t *testing.T) {
+	p, mock := newMockPostgres(t)
+
+	// Claimed again by another worker while processing
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM command_jobs").WithArgs(int64(7), 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	mock.ExpectExec("SET status = 'pending'").
+		WithArgs(int64(7), "failed", int64(5000), 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	job := &postgresJob{ID: 7, Payload: []byte(testRequestJSON), Attempts: 1}
+	err := p.process(job, func(payload []byte) (func(*sql.Tx) error, error) {
+		return nil, nil
+	})
+	assert.Equal(t, errClaimLost, err)
+
+	err = p.process(job, func(payload []byte) (func(*sql.Tx) error, error) {
+		return nil, errors.New("failed")
+	})
+	assert.Equal(t, errClaimLost, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresProcessDeadLetter(t *testing.T) {
+	cases := []struct {
+		name   string
+		job    *postgresJob
+		err    string
+		reason string
+	}{
+		{name: "attempts exhausted", job: &postgresJob{ID: 7, Payload: []byte(`{"RoomID":1,"Message":"Hi"}`), Attempts: 2}, err: "failed", reason: ReasonHandlerFailed},
+		{name: "visibility timeout", job: &postgresJob{ID: 7, Payload: []byte(`{"RoomID":1,"Message":"Hi"}`), Attempts: 3}, err: "visibility timeout expired", reason: ReasonHandlerFailed},
+		{name: "invalid payload", job: &postgresJob{ID: 7, Payload: []byte(`"text"`), Attempts: 1}, err: "json: cannot unmarshal string into Go value of type contract.Response", reason: ReasonMalformed},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, mock := newMockPostgres(t)
+
+			mock.ExpectExec("SET status = 'dead'").
+				WithArgs(int64(7), c.err, c.reason, c.job.Attempts).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			err := p.process(c.job, func(payload []byte) (func(*sql.Tx) error, error) {
+				if _, err := contract.DecodeResponse(payload); err != nil {
+					return nil, &malformedError{err}
+				}
+				return nil, errors.New("failed")
+			})
+			assert.Nil(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPostgresStartHandler(t *testing.T) {
+	p, mock := newMockPostgres(t)
+
+	mock.ExpectQuery("FOR UPDATE SKIP LOCKED").
+		WithArgs("requests", int64(30000)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payload", "attempts"}).AddRow(7, []byte(testRequestJSON), 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO command_jobs").
+		WithArgs("responses", []byte(`{"version":1,"correlation_id":"c1","command":"stock","room_id":1,"text":"AAPL quote"}`)).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec("SELECT pg_notify").
+		WithArgs("fin_chat_command_jobs", "responses").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM command_jobs").WithArgs(int64(7), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("FOR UPDATE SKIP LOCKED").WillReturnError(sql.ErrNoRows)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := p.StartHandler(ctx, func(req contract.Request) (contract.Response, error) {
+		return req.Reply(req.Args[0] + " quote"), nil
+	})
+	assert.Nil(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresListDeadLetters(t *testing.T) {
+	p, mock := newMockPostgres(t)
+
+	failedAt := time.Date(2019, 12, 1, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("status = 'dead'").
+		WithArgs("responses", 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payload", "reason", "last_error", "attempts", "updated_at"}).
+			AddRow(7, `{"RoomID":1}`, ReasonHandlerFailed, "failed", 3, failedAt))
+
+	letters, err := p.ListDeadLetters(10)
+	assert.Nil(t, err)
+	assert.Equal(t, []DeadLetter{{ID: "7", Body: `{"RoomID":1}`, Reason: ReasonHandlerFailed, Error: "failed", Attempts: 3, FailedAt: failedAt}}, letters)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRedriveDeadLetters(t *testing.T) {
+	p, mock := newMockPostgres(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SET status = 'pending', attempts = 0").
+		WithArgs("responses", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("SELECT pg_notify").
+		WithArgs("fin_chat_command_jobs", "responses").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	count, err := p.RedriveDeadLetters([]string{"7", "8"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = p.RedriveDeadLetters([]string{"abc"})
+	assert.Equal(t, &InvalidDeadLetterIDError{ID: "abc"}, err)
+	assert.EqualError(t, err, `invalid dead letter id "abc"`)
+}
@@ -0,0 +1,342 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+
+	"github.com/hernanrocha/fin-chat/contract"
+)
+
+const (
+	// Durable queues for command requests and responses
+	rabbitRequestQueue  = "fin-chat.commands.requests"
+	rabbitResponseQueue = "fin-chat.commands.responses"
+
+	// Reconnection backoff
+	rabbitMinBackoff = time.Second
+	rabbitMaxBackoff = 30 * time.Second
+
+	// Time allowed to connect and handshake, like amqp.Dial
+	rabbitDialTimeout = 30 * time.Second
+	// Time allowed to publish a message, reconnecting if needed. Requests
+	// are published by the hub, which must not wait for a broker down.
+	rabbitPublishTimeout = 5 * time.Second
+	// Heartbeat and locale of amqp.Dial
+	rabbitHeartbeat = 10 * time.Second
+	rabbitLocale    = "en_US"
+)
+
+// RabbitConfig of the RabbitMQ backend
+type RabbitConfig struct {
+	// Queue of the command requests handled by the bot
+	RequestQueue string
+	// Queues of the commands served by other bots
+	Routes Routes
+}
+
+// NewRabbitMessenger returns a RabbitMQ backend. The connection is opened
+// on first use and recovered automatically when it is lost.
+func NewRabbitMessenger(url string, config RabbitConfig) *rabbitCommandMessenger {
+	if config.RequestQueue == "" {
+		config.RequestQueue = rabbitRequestQueue
+	}
+
+	return &rabbitCommandMessenger{
+		url:            url,
+		config:         config,
+		publishTimeout: rabbitPublishTimeout,
+	}
+}
+
+type rabbitCommandMessenger struct {
+	url            string
+	config         RabbitConfig
+	publishTimeout time.Duration
+
+	mu   sync.Mutex
+	conn *amqp.Connection
+	// Channel used for publishing
+	ch *amqp.Channel
+}
+
+// connection returns the current connection, dialing until it succeeds or
+// ctx is done. The lock is only held to read and swap the connection, so
+// callers reconnecting do not block each other.
+func (r *rabbitCommandMessenger) connection(ctx context.Context) (*amqp.Connection, error) {
+	backoff := rabbitMinBackoff
+	for {
+		r.mu.Lock()
+		current := r.conn
+		r.mu.Unlock()
+		if current != nil && !current.IsClosed() {
+			return current, nil
+		}
+
+		conn, err := r.dial(ctx)
+		if err == nil {
+			r.mu.Lock()
+			if r.conn != nil && !r.conn.IsClosed() {
+				// Connected by another caller meanwhile
+				current = r.conn
+				r.mu.Unlock()
+				conn.Close()
+				return current, nil
+			}
+			log.Println("Connected to RabbitMQ")
+			r.conn = conn
+			r.ch = nil
+			r.mu.Unlock()
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		log.Printf("Error connecting to RabbitMQ, retrying in %s: %s\n", backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if backoff *= 2; backoff > rabbitMaxBackoff {
+			backoff = rabbitMaxBackoff
+		}
+	}
+}
+
+// dial connects to RabbitMQ, giving up when ctx is done
+func (r *rabbitCommandMessenger) dial(ctx context.Context) (*amqp.Connection, error) {
+	return amqp.DialConfig(r.url, amqp.Config{
+		Heartbeat: rabbitHeartbeat,
+		Locale:    rabbitLocale,
+		Dial: func(network, addr string) (net.Conn, error) {
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+
+			// Deadline of the handshake, cleared by amqp once connected
+			deadline := time.Now().Add(rabbitDialTimeout)
+			if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+				deadline = d
+			}
+			if err := conn.SetDeadline(deadline); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return conn, nil
+		},
+	})
+}
+
+// queues returns the command queues used by the backend. Routed queues are
+// declared as well, so requests are kept until their bot starts.
+func (r *rabbitCommandMessenger) queues() []string {
+	queues := []string{rabbitRequestQueue, rabbitResponseQueue}
+	seen := map[string]bool{rabbitRequestQueue: true, rabbitResponseQueue: true}
+	for _, queue := range append(r.config.Routes.destinations(), r.config.RequestQueue) {
+		if !seen[queue] {
+			seen[queue] = true
+			queues = append(queues, queue)
+		}
+	}
+	return queues
+}
+
+// channel opens a new channel with the command queues declared
+func (r *rabbitCommandMessenger) channel(ctx context.Context) (*amqp.Channel, error) {
+	conn, err := r.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range r.queues() {
+		_, err := ch.QueueDeclare(
+			name,  // name
+			true,  // durable
+			false, // delete when unused
+			false, // exclusive
+			false, // no-wait
+			nil,   // arguments
+		)
+		if err != nil {
+			ch.Close()
+			return nil, err
+		}
+	}
+
+	return ch, nil
+}
+
+// publish sends a JSON message to a queue, re-creating the publishing
+// channel once if it was closed. It gives up after the publish timeout when
+// RabbitMQ cannot be reached.
+func (r *rabbitCommandMessenger) publish(queue, replyTo string, msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.publishTimeout)
+	defer cancel()
+
+	for attempt := 0; ; attempt++ {
+		r.mu.Lock()
+		ch := r.ch
+		r.mu.Unlock()
+
+		if ch == nil {
+			if ch, err = r.channel(ctx); err != nil {
+				return err
+			}
+			r.mu.Lock()
+			r.ch = ch
+			r.mu.Unlock()
+		}
+
+		err = ch.Publish(
+			"",    // exchange
+			queue, // routing key
+			false, // mandatory
+			false, // immediate
+			amqp.Publishing{
+				ContentType:  "application/json",
+				DeliveryMode: amqp.Persistent,
+				Body:         body,
+				ReplyTo:      replyTo,
+			})
+		if err == nil || attempt > 0 {
+			return err
+		}
+
+		log.Printf("Error publishing to RabbitMQ, retrying: %s\n", err)
+		r.mu.Lock()
+		if r.ch == ch {
+			r.ch = nil
+		}
+		r.mu.Unlock()
+		ch.Close()
+	}
+}
+
+// consume delivers the messages of a queue to fn until ctx is done,
+// consuming again after connection failures. Messages are acknowledged
+// after fn succeeds.
+func (r *rabbitCommandMessenger) consume(ctx context.Context, queue string, fn func(amqp.Delivery) error) error {
+	for ctx.Err() == nil {
+		ch, err := r.channel(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("Error opening RabbitMQ channel: %s\n", err)
+			time.Sleep(rabbitMinBackoff)
+			continue
+		}
+
+		if err := r.consumeChannel(ctx, ch, queue, fn); err != nil {
+			log.Printf("Error consuming from %s: %s\n", queue, err)
+			time.Sleep(rabbitMinBackoff)
+		}
+		ch.Close()
+	}
+
+	return nil
+}
+
+func (r *rabbitCommandMessenger) consumeChannel(ctx context.Context, ch *amqp.Channel, queue string, fn func(amqp.Delivery) error) error {
+	// Deliver one message at a time, so unacknowledged messages are not
+	// held by a busy consumer
+	if err := ch.Qos(1, 0, false); err != nil {
+		return err
+	}
+
+	msgs, err := ch.Consume(
+		queue, // queue
+		"",    // consumer
+		false, // auto-ack
+		false, // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,   // args
+	)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Waiting for messages from %s...\n", queue)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case d, ok := <-msgs:
+			if !ok {
+				log.Printf("RabbitMQ channel closed, reconnecting...\n")
+				return nil
+			}
+
+			if err := fn(d); err != nil {
+				// Retry once, then drop it (or dead-letter it if the queue has a DLX)
+				log.Printf("Error processing message: %s\n", err)
+				d.Nack(false, !d.Redelivered)
+				continue
+			}
+			d.Ack(false)
+		}
+	}
+}
+
+// Publish a command request message
+func (r *rabbitCommandMessenger) Publish(req contract.Request) error {
+	queue := r.config.Routes.destination(req.Command, rabbitRequestQueue)
+	return r.publish(queue, rabbitResponseQueue, req)
+}
+
+// Start command request message handler
+func (r *rabbitCommandMessenger) StartHandler(ctx context.Context, fn func(contract.Request) (contract.Response, error)) error {
+	return r.consume(ctx, r.config.RequestQueue, func(d amqp.Delivery) error {
+		log.Printf("Received command request: %s", d.Body)
+
+		req, err := contract.DecodeRequest(d.Body)
+		if err != nil {
+			return err
+		}
+
+		resp, err := fn(req)
+		if err != nil {
+			return err
+		}
+
+		replyTo := d.ReplyTo
+		if replyTo == "" {
+			replyTo = rabbitResponseQueue
+		}
+		return r.publish(replyTo, "", resp)
+	})
+}
+
+// Start command response message consumer
+func (r *rabbitCommandMessenger) StartConsumer(ctx context.Context, fn func(contract.Response) error) error {
+	return r.consume(ctx, rabbitResponseQueue, func(d amqp.Delivery) error {
+		log.Printf("Received command response: %s\n", d.Body)
+
+		res, err := contract.DecodeResponse(d.Body)
+		if err != nil {
+			return err
+		}
+
+		return fn(res)
+	})
+}
@@ -0,0 +1,68 @@
+package messenger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Routes maps command names to the destination of their requests: an SNS
+// topic ARN, a RabbitMQ queue or a Postgres queue, depending on the
+// backend. Commands without a route go to the default request destination.
+type Routes map[string]string
+
+// ParseRoutes parses a comma separated list of command=destination pairs
+// (e.g. "fx=fin-chat.commands.fx,news=fin-chat.commands.news")
+func ParseRoutes(s string) (Routes, error) {
+	routes := Routes{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		command := strings.TrimPrefix(strings.TrimSpace(parts[0]), "/")
+		if len(parts) != 2 || command == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid command route %q", pair)
+		}
+		if _, ok := routes[command]; ok {
+			return nil, fmt.Errorf("duplicated command route %q", command)
+		}
+		routes[command] = strings.TrimSpace(parts[1])
+	}
+
+	return routes, nil
+}
+
+// Commands returns the routed command names, sorted
+func (r Routes) Commands() []string {
+	commands := make([]string, 0, len(r))
+	for command := range r {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// destination returns the destination of a command, or fallback if it has
+// no route
+func (r Routes) destination(command, fallback string) string {
+	if dest, ok := r[command]; ok {
+		return dest
+	}
+	return fallback
+}
+
+// destinations returns the distinct routed destinations, sorted
+func (r Routes) destinations() []string {
+	seen := map[string]bool{}
+	var dests []string
+	for _, dest := range r {
+		if !seen[dest] {
+			seen[dest] = true
+			dests = append(dests, dest)
+		}
+	}
+	sort.Strings(dests)
+	return dests
+}
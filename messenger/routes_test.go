@@ -0,0 +1,44 @@
+package messenger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRoutes(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    string
+		expected Routes
+		err      string
+	}{
+		{name: "empty", value: "", expected: Routes{}},
+		{name: "routes", value: "fx=fx-queue, /news = news-queue,", expected: Routes{"fx": "fx-queue", "news": "news-queue"}},
+		{name: "topic arn", value: "fx=arn:aws:sns:us-east-2:123456789012:fx", expected: Routes{"fx": "arn:aws:sns:us-east-2:123456789012:fx"}},
+		{name: "missing destination", value: "fx=", err: `invalid command route "fx="`},
+		{name: "missing command", value: "fx-queue", err: `invalid command route "fx-queue"`},
+		{name: "duplicated", value: "fx=a,fx=b", err: `duplicated command route "fx"`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			routes, err := ParseRoutes(c.value)
+			if c.err != "" {
+				assert.EqualError(t, err, c.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, c.expected, routes)
+		})
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	routes := Routes{"news": "news-queue", "fx": "fx-queue", "forex": "fx-queue"}
+
+	assert.Equal(t, []string{"forex", "fx", "news"}, routes.Commands())
+	assert.Equal(t, []string{"fx-queue", "news-queue"}, routes.destinations())
+	assert.Equal(t, "fx-queue", routes.destination("fx", "requests"))
+	assert.Equal(t, "requests", routes.destination("stock", "requests"))
+}
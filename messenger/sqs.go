@@ -0,0 +1,517 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+
+	"github.com/hernanrocha/fin-chat/contract"
+)
+
+// Delay before receiving again after a failed receive
+var sqsErrorBackoff = 5 * time.Second
+
+const (
+	// Time dead letters being redriven are hidden from other readers
+	sqsRedriveVisibility = 30
+	// Dead-letter message attributes
+	sqsReasonAttribute   = "DeadLetterReason"
+	sqsErrorAttribute    = "DeadLetterError"
+	sqsAttemptsAttribute = "DeadLetterAttempts"
+	sqsFailedAtAttribute = "DeadLetterFailedAt"
+)
+
+// ErrNoDeadLetterQueue is returned when no dead-letter queue is configured
+var ErrNoDeadLetterQueue = errors.New("messenger: dead-letter queue not configured")
+
+// SQSConfig of the SNS/SQS backend
+type SQSConfig struct {
+	// SNS topic receiving command requests
+	RequestTopicARN string
+	// SNS topics of the commands served by other bots
+	Routes Routes
+	// SQS queue subscribed to the requests topic, read by the bot
+	RequestQueueURL string
+	// SQS queue receiving command responses
+	ResponseQueueURL string
+	// Optional SQS queue for command responses that cannot be processed
+	DeadLetterQueueURL string
+
+	// Receive attempts of a command response before it is dead-lettered
+	MaxReceives int
+	// Messages per receive (up to 10)
+	BatchSize int
+	// Command responses processed at the same time
+	Workers int
+	// Long-poll wait of each receive (up to 20s)
+	WaitTime time.Duration
+	// Time a received response stays hidden, extended until it is processed
+	VisibilityTimeout time.Duration
+	// Maximum delay before deleting processed responses in batch
+	DeleteInterval time.Duration
+}
+
+// DefaultSQSConfig is used for zero values of SQSConfig
+var DefaultSQSConfig = SQSConfig{
+	MaxReceives:       3,
+	BatchSize:         10,
+	Workers:           4,
+	WaitTime:          20 * time.Second,
+	VisibilityTimeout: 30 * time.Second,
+	DeleteInterval:    100 * time.Millisecond,
+}
+
+// SQSConfigFromEnv reads the SNS/SQS configuration from SQS_COMMANDS_*
+// environment variables
+func SQSConfigFromEnv() SQSConfig {
+	atoi := func(key string) int {
+		n, _ := strconv.Atoi(os.Getenv(key))
+		return n
+	}
+	duration := func(key string) time.Duration {
+		d, _ := time.ParseDuration(os.Getenv(key))
+		return d
+	}
+
+	return SQSConfig{
+		RequestTopicARN:    os.Getenv("SQS_COMMANDS_REQUEST_URL"),
+		RequestQueueURL:    os.Getenv("SQS_COMMANDS_REQUEST_QUEUE_URL"),
+		ResponseQueueURL:   os.Getenv("SQS_COMMANDS_RESPONSE_URL"),
+		DeadLetterQueueURL: os.Getenv("SQS_COMMANDS_RESPONSE_DLQ_URL"),
+		MaxReceives:        atoi("SQS_COMMANDS_MAX_RECEIVES"),
+		BatchSize:          atoi("SQS_COMMANDS_BATCH_SIZE"),
+		Workers:            atoi("SQS_COMMANDS_WORKERS"),
+		WaitTime:           duration("SQS_COMMANDS_WAIT_TIME"),
+		VisibilityTimeout:  duration("SQS_COMMANDS_VISIBILITY_TIMEOUT"),
+	}
+}
+
+func NewSQSMessenger(snsSvc snsiface.SNSAPI, sqsSvc sqsiface.SQSAPI, config SQSConfig) *sqsCommandMessenger {
+	d := DefaultSQSConfig
+	if config.MaxReceives < 1 {
+		config.MaxReceives = d.MaxReceives
+	}
+	if config.BatchSize < 1 || config.BatchSize > 10 {
+		config.BatchSize = d.BatchSize
+	}
+	if config.Workers < 1 {
+		config.Workers = d.Workers
+	}
+	if config.WaitTime <= 0 || config.WaitTime > 20*time.Second {
+		config.WaitTime = d.WaitTime
+	}
+	if config.VisibilityTimeout < time.Second {
+		config.VisibilityTimeout = d.VisibilityTimeout
+	}
+	if config.DeleteInterval <= 0 {
+		config.DeleteInterval = d.DeleteInterval
+	}
+
+	return &sqsCommandMessenger{
+		sqsSvc: sqsSvc,
+		snsSvc: snsSvc,
+		config: config,
+	}
+}
+
+type sqsCommandMessenger struct {
+	snsSvc snsiface.SNSAPI
+	sqsSvc sqsiface.SQSAPI
+	config SQSConfig
+}
+
+// Publish a command request message
+func (s *sqsCommandMessenger) Publish(req contract.Request) error {
+	resStr, _ := json.Marshal(req)
+	_, err := s.snsSvc.Publish(&sns.PublishInput{
+		Message:  aws.String(string(resStr)),
+		TopicArn: aws.String(s.config.Routes.destination(req.Command, s.config.RequestTopicARN)),
+	})
+	return err
+}
+
+// Start command response message consumer. Responses are received in
+// batches and processed by a pool of workers. Malformed responses and
+// responses failing on every attempt are moved to the dead-letter queue.
+func (s *sqsCommandMessenger) StartConsumer(ctx context.Context, fn func(contract.Response) error) error {
+	log.Printf("Starting command message response consumer with %d workers\n", s.config.Workers)
+	queueURL := s.config.ResponseQueueURL
+
+	deleter := newSQSDeleter(s.sqsSvc, queueURL, s.config.DeleteInterval)
+	defer deleter.Close()
+
+	// Received messages are always processed, so they are drained on shutdown
+	messages := make(chan sqsReceivedMessage)
+	var wg sync.WaitGroup
+	for i := 0; i < s.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for received := range messages {
+				done := s.handleResponse(received.msg, fn)
+				received.stop()
+				if done {
+					deleter.Delete(received.msg.ReceiptHandle)
+				}
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(messages)
+
+	for ctx.Err() == nil {
+		output, err := s.sqsSvc.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueURL),
+			MaxNumberOfMessages: aws.Int64(int64(s.config.BatchSize)),
+			WaitTimeSeconds:     aws.Int64(int64(s.config.WaitTime / time.Second)),
+			VisibilityTimeout:   aws.Int64(int64(s.config.VisibilityTimeout / time.Second)),
+			AttributeNames:      []*string{aws.String(sqs.MessageSystemAttributeNameApproximateReceiveCount)},
+		})
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Failed to fetch sqs message, retrying in %s: %v\n", sqsErrorBackoff, err)
+			select {
+			case <-time.After(sqsErrorBackoff):
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		// Messages of a batch wait for a free worker, so they are kept
+		// hidden from the time they are received
+		received := make([]sqsReceivedMessage, len(output.Messages))
+		for i, msg := range output.Messages {
+			received[i] = sqsReceivedMessage{msg: msg, stop: s.extendVisibility(queueURL, msg)}
+		}
+		for _, r := range received {
+			messages <- r
+		}
+	}
+
+	return nil
+}
+
+// sqsReceivedMessage is a message waiting for or being processed by a
+// worker, with the function stopping its visibility extension
+type sqsReceivedMessage struct {
+	msg  *sqs.Message
+	stop func()
+}
+
+// handleResponse processes a command response. It returns true when the
+// message is done and can be deleted. Failed responses are left on the
+// queue to be received again until they run out of attempts.
+func (s *sqsCommandMessenger) handleResponse(msg *sqs.Message, fn func(contract.Response) error) bool {
+	res, err := contract.DecodeResponse([]byte(aws.StringValue(msg.Body)))
+	if err != nil {
+		log.Printf("Error parsing command response: %s\n", err)
+		return s.deadLetter(msg, ReasonMalformed, err)
+	}
+
+	if err := fn(res); err != nil {
+		if attempts := receiveCount(msg); attempts < s.config.MaxReceives {
+			log.Printf("Error processing message (attempt %d of %d): %s\n", attempts, s.config.MaxReceives, err)
+			return false
+		}
+		log.Printf("Error processing message: %s\n", err)
+		return s.deadLetter(msg, ReasonHandlerFailed, err)
+	}
+
+	return true
+}
+
+// extendVisibility keeps a message hidden from other consumers until the
+// returned stop function is called
+func (s *sqsCommandMessenger) extendVisibility(queueURL string, msg *sqs.Message) func() {
+	timeout := s.config.VisibilityTimeout
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(timeout / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_, err := s.sqsSvc.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+					QueueUrl:          aws.String(queueURL),
+					ReceiptHandle:     msg.ReceiptHandle,
+					VisibilityTimeout: aws.Int64(int64(timeout / time.Second)),
+				})
+				if err != nil {
+					log.Printf("Error extending visibility of message %s: %s\n", aws.StringValue(msg.MessageId), err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
+
+// deadLetter moves a message to the dead-letter queue, or drops it if
+// there is none. It returns true when the message can be deleted.
+func (s *sqsCommandMessenger) deadLetter(msg *sqs.Message, reason string, cause error) bool {
+	if s.config.DeadLetterQueueURL == "" {
+		log.Printf("Dropping message %s (%s), no dead-letter queue configured\n", aws.StringValue(msg.MessageId), reason)
+		return true
+	}
+
+	_, err := s.sqsSvc.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:    aws.String(s.config.DeadLetterQueueURL),
+		MessageBody: msg.Body,
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			sqsReasonAttribute:   stringAttribute(reason),
+			sqsErrorAttribute:    stringAttribute(cause.Error()),
+			sqsAttemptsAttribute: {DataType: aws.String("Number"), StringValue: aws.String(strconv.Itoa(receiveCount(msg)))},
+			sqsFailedAtAttribute: stringAttribute(time.Now().UTC().Format(time.RFC3339)),
+		},
+	})
+	if err != nil {
+		// It will be received and dead-lettered again
+		log.Printf("Error sending message to dead-letter queue: %s\n", err)
+		return false
+	}
+
+	log.Printf("Message %s moved to dead-letter queue (%s)\n", aws.StringValue(msg.MessageId), reason)
+	return true
+}
+
+func (s *sqsCommandMessenger) deleteMessage(queueURL string, receiptHandle *string) {
+	dmr := &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(queueURL),
+		ReceiptHandle: receiptHandle,
+	}
+	if _, err := s.sqsSvc.DeleteMessage(dmr); err != nil {
+		log.Printf("Error deleting message from queue: %s\n", err.Error())
+	}
+}
+
+// ListDeadLetters lists up to max dead-lettered command responses. Messages
+// are left visible, so listing does not get in the way of a redrive.
+func (s *sqsCommandMessenger) ListDeadLetters(max int) ([]DeadLetter, error) {
+	dlqURL := s.config.DeadLetterQueueURL
+	if dlqURL == "" {
+		return nil, ErrNoDeadLetterQueue
+	}
+
+	letters := []DeadLetter{}
+	seen := make(map[string]bool)
+	// The same messages may be received several times
+	for attempt := 0; attempt < 3 && len(letters) < max; attempt++ {
+		output, err := s.sqsSvc.ReceiveMessage(&sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(dlqURL),
+			MaxNumberOfMessages:   aws.Int64(int64(minInt(max-len(letters), 10))),
+			VisibilityTimeout:     aws.Int64(0),
+			MessageAttributeNames: []*string{aws.String("All")},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(output.Messages) == 0 {
+			break
+		}
+
+		for _, msg := range output.Messages {
+			if id := aws.StringValue(msg.MessageId); !seen[id] && len(letters) < max {
+				seen[id] = true
+				letters = append(letters, deadLetterFromMessage(msg))
+			}
+		}
+	}
+
+	return letters, nil
+}
+
+// RedriveDeadLetters sends dead letters back to the command response queue
+func (s *sqsCommandMessenger) RedriveDeadLetters(ids []string) (int, error) {
+	dlqURL := s.config.DeadLetterQueueURL
+	if dlqURL == "" {
+		return 0, ErrNoDeadLetterQueue
+	}
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	// Messages received but not redriven are made visible again
+	var skipped []*sqs.Message
+	defer func() {
+		for _, msg := range skipped {
+			s.sqsSvc.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+				QueueUrl:          aws.String(dlqURL),
+				ReceiptHandle:     msg.ReceiptHandle,
+				VisibilityTimeout: aws.Int64(0),
+			})
+		}
+	}()
+
+	count := 0
+	for len(ids) == 0 || count < len(ids) {
+		// Received messages stay hidden, so every receive gets new ones
+		output, err := s.sqsSvc.ReceiveMessage(&sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(dlqURL),
+			MaxNumberOfMessages: aws.Int64(10),
+			VisibilityTimeout:   aws.Int64(sqsRedriveVisibility),
+		})
+		if err != nil {
+			return count, err
+		}
+		if len(output.Messages) == 0 {
+			break
+		}
+
+		for _, msg := range output.Messages {
+			if len(ids) > 0 && !wanted[aws.StringValue(msg.MessageId)] {
+				skipped = append(skipped, msg)
+				continue
+			}
+
+			_, err := s.sqsSvc.SendMessage(&sqs.SendMessageInput{
+				QueueUrl:    aws.String(s.config.ResponseQueueURL),
+				MessageBody: msg.Body,
+			})
+			if err != nil {
+				return count, err
+			}
+			s.deleteMessage(dlqURL, msg.ReceiptHandle)
+			count++
+		}
+	}
+
+	log.Printf("Redrove %d dead-lettered command responses\n", count)
+	return count, nil
+}
+
+func deadLetterFromMessage(msg *sqs.Message) DeadLetter {
+	attribute := func(name string) string {
+		if v, ok := msg.MessageAttributes[name]; ok {
+			return aws.StringValue(v.StringValue)
+		}
+		return ""
+	}
+
+	attempts, _ := strconv.Atoi(attribute(sqsAttemptsAttribute))
+	failedAt, _ := time.Parse(time.RFC3339, attribute(sqsFailedAtAttribute))
+
+	return DeadLetter{
+		ID:       aws.StringValue(msg.MessageId),
+		Body:     aws.StringValue(msg.Body),
+		Reason:   attribute(sqsReasonAttribute),
+		Error:    attribute(sqsErrorAttribute),
+		Attempts: attempts,
+		FailedAt: failedAt,
+	}
+}
+
+// receiveCount is the number of times a message has been received
+func receiveCount(msg *sqs.Message) int {
+	count, err := strconv.Atoi(aws.StringValue(msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]))
+	if err != nil {
+		return 1
+	}
+	return count
+}
+
+func stringAttribute(value string) *sqs.MessageAttributeValue {
+	return &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(value),
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Start command request message handler. Requests are read from the
+// SQS_COMMANDS_REQUEST_QUEUE_URL queue, subscribed to the requests topic.
+// Malformed requests are dropped, as they would never be handled.
+func (s *sqsCommandMessenger) StartHandler(ctx context.Context, fn func(contract.Request) (contract.Response, error)) error {
+	log.Println("Starting command message request handler")
+	queueURL := s.config.RequestQueueURL
+
+	for ctx.Err() == nil {
+		output, err := s.sqsSvc.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueURL),
+			MaxNumberOfMessages: aws.Int64(1),
+			WaitTimeSeconds:     aws.Int64(20),
+		})
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Failed to fetch sqs message, retrying in %s: %v\n", sqsErrorBackoff, err)
+			select {
+			case <-time.After(sqsErrorBackoff):
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		for _, msg := range output.Messages {
+			req, err := contract.DecodeRequest([]byte(snsMessage(*msg.Body)))
+			if err != nil {
+				log.Printf("Dropping malformed command request %s: %s\n", aws.StringValue(msg.MessageId), err)
+				s.deleteMessage(queueURL, msg.ReceiptHandle)
+				continue
+			}
+
+			resp, err := fn(req)
+			if err != nil {
+				// Message will be received again after the visibility timeout
+				log.Printf("Error processing command request: %s\n", err)
+				continue
+			}
+
+			resStr, _ := json.Marshal(resp)
+			_, err = s.sqsSvc.SendMessage(&sqs.SendMessageInput{
+				MessageBody: aws.String(string(resStr)),
+				QueueUrl:    aws.String(s.config.ResponseQueueURL),
+			})
+			if err != nil {
+				log.Printf("Error sending command response: %s\n", err)
+				continue
+			}
+
+			s.deleteMessage(queueURL, msg.ReceiptHandle)
+		}
+	}
+
+	return nil
+}
+
+// snsMessage unwraps the message of an SNS notification delivered to SQS
+// without raw message delivery
+func snsMessage(body string) string {
+	var notification struct {
+		Type    string
+		Message string
+	}
+	if err := json.Unmarshal([]byte(body), &notification); err == nil && notification.Type == "Notification" {
+		return notification.Message
+	}
+	return body
+}
@@ -0,0 +1,455 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/contract"
+)
+
+var (
+	_ BotCommandMessenger = (*sqsCommandMessenger)(nil)
+	_ BotCommandConsumer  = (*sqsCommandMessenger)(nil)
+	_ DeadLetterQueue     = (*sqsCommandMessenger)(nil)
+)
+
+var testSQSConfig = SQSConfig{
+	ResponseQueueURL:   "responses",
+	DeadLetterQueueURL: "dlq",
+}
+
+// fakeSQS keeps queues in memory. Received messages are hidden until they
+// are deleted or made visible again.
+type fakeSQS struct {
+	sqsiface.SQSAPI
+
+	mu                sync.Mutex
+	queues            map[string][]*sqs.Message
+	hidden            map[string]bool
+	receives          []int64
+	batches           []int
+	visibilityChanges int
+	// Visibility changes by receipt handle
+	changes map[string]int
+	errs    int
+}
+
+func newFakeSQS() *fakeSQS {
+	return &fakeSQS{
+		queues:  make(map[string][]*sqs.Message),
+		hidden:  make(map[string]bool),
+		changes: make(map[string]int),
+	}
+}
+
+func (f *fakeSQS) add(queue, id, body string, receives string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.queues[queue] = append(f.queues[queue], &sqs.Message{
+		MessageId:     aws.String(id),
+		ReceiptHandle: aws.String(id),
+		Body:          aws.String(body),
+		Attributes:    map[string]*string{sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String(receives)},
+	})
+}
+
+func (f *fakeSQS) len(queue string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.queues[queue])
+}
+
+func (f *fakeSQS) ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.errs > 0 {
+		f.errs--
+		return nil, errors.New("receive failed")
+	}
+
+	var messages []*sqs.Message
+	for _, msg := range f.queues[*input.QueueUrl] {
+		if int64(len(messages)) < *input.MaxNumberOfMessages && !f.hidden[*msg.ReceiptHandle] {
+			messages = append(messages, msg)
+			if aws.Int64Value(input.VisibilityTimeout) != 0 || input.VisibilityTimeout == nil {
+				f.hidden[*msg.ReceiptHandle] = true
+			}
+		}
+	}
+	f.receives = append(f.receives, *input.MaxNumberOfMessages)
+	return &sqs.ReceiveMessageOutput{Messages: messages}, nil
+}
+
+func (f *fakeSQS) ReceiveMessageWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	output, err := f.ReceiveMessage(input)
+	if err == nil && len(output.Messages) == 0 {
+		// Long poll
+		select {
+		case <-time.After(5 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return output, err
+}
+
+func (f *fakeSQS) SendMessage(input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	queue := *input.QueueUrl
+	f.queues[queue] = append(f.queues[queue], &sqs.Message{
+		MessageId:         aws.String("sent-" + *input.MessageBody),
+		ReceiptHandle:     aws.String("sent-" + *input.MessageBody),
+		Body:              input.MessageBody,
+		MessageAttributes: input.MessageAttributes,
+	})
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func (f *fakeSQS) delete(queue, receiptHandle string) {
+	for i, msg := range f.queues[queue] {
+		if *msg.ReceiptHandle == receiptHandle {
+			f.queues[queue] = append(f.queues[queue][:i], f.queues[queue][i+1:]...)
+			break
+		}
+	}
+	delete(f.hidden, receiptHandle)
+}
+
+func (f *fakeSQS) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.delete(*input.QueueUrl, *input.ReceiptHandle)
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeSQS) DeleteMessageBatch(input *sqs.DeleteMessageBatchInput) (*sqs.DeleteMessageBatchOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, entry := range input.Entries {
+		f.delete(*input.QueueUrl, *entry.ReceiptHandle)
+	}
+	f.batches = append(f.batches, len(input.Entries))
+	return &sqs.DeleteMessageBatchOutput{}, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibility(input *sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if *input.VisibilityTimeout == 0 {
+		delete(f.hidden, *input.ReceiptHandle)
+	}
+	f.visibilityChanges++
+	f.changes[*input.ReceiptHandle]++
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func TestSQSConfigDefaults(t *testing.T) {
+	s := NewSQSMessenger(nil, newFakeSQS(), SQSConfig{BatchSize: 50, WaitTime: time.Minute})
+
+	assert.Equal(t, 10, s.config.BatchSize)
+	assert.Equal(t, 4, s.config.Workers)
+	assert.Equal(t, 20*time.Second, s.config.WaitTime)
+	assert.Equal(t, 3, s.config.MaxReceives)
+}
+
+func TestSQSHandleResponse(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		receives string
+		err      error
+		reason   string
+		done     bool
+	}{
+		{name: "processed", body: `{"RoomID":1,"Message":"Hi"}`, receives: "1", done: true},
+		{name: "malformed", body: `not json`, receives: "1", reason: ReasonMalformed, done: true},
+		{name: "failed", body: `{"RoomID":1,"Message":"Hi"}`, receives: "1", err: errors.New("failed")},
+		{name: "failed too many times", body: `{"RoomID":1,"Message":"Hi"}`, receives: "3", err: errors.New("failed"), reason: ReasonHandlerFailed, done: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fake := newFakeSQS()
+			fake.add("responses", "1", c.body, c.receives)
+			s := NewSQSMessenger(nil, fake, testSQSConfig)
+
+			done := s.handleResponse(fake.queues["responses"][0], func(contract.Response) error {
+				return c.err
+			})
+			assert.Equal(t, c.done, done)
+
+			if c.reason == "" {
+				assert.Empty(t, fake.queues["dlq"])
+				return
+			}
+
+			require.Len(t, fake.queues["dlq"], 1)
+			letter := deadLetterFromMessage(fake.queues["dlq"][0])
+			assert.Equal(t, c.body, letter.Body)
+			assert.Equal(t, c.reason, letter.Reason)
+			assert.NotEmpty(t, letter.Error)
+			assert.False(t, letter.FailedAt.IsZero())
+		})
+	}
+}
+
+func TestSQSConsumerBatches(t *testing.T) {
+	fake := newFakeSQS()
+	for i := 0; i < 25; i++ {
+		fake.add("responses", fmt.Sprint(i), fmt.Sprintf(`{"RoomID":%d,"Message":"Hi"}`, i+1), "1")
+	}
+
+	config := testSQSConfig
+	config.Workers = 5
+	s := NewSQSMessenger(nil, fake, config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	received := make(map[uint]bool)
+	done := make(chan error)
+	go func() {
+		done <- s.StartConsumer(ctx, func(msg contract.Response) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received[msg.RoomID] = true
+			if len(received) == 25 {
+				cancel()
+			}
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("responses not consumed")
+	}
+
+	// Processed messages are deleted before returning
+	assert.Len(t, received, 25)
+	assert.Equal(t, 0, fake.len("responses"))
+	assert.Equal(t, int64(10), fake.receives[0])
+	for _, size := range fake.batches {
+		assert.True(t, size <= sqsMaxBatch)
+	}
+}
+
+func TestSQSConsumerSurvivesBadInput(t *testing.T) {
+	backoff := sqsErrorBackoff
+	sqsErrorBackoff = 10 * time.Millisecond
+	defer func() { sqsErrorBackoff = backoff }()
+
+	fake := newFakeSQS()
+	fake.errs = 1
+	fake.add("responses", "1", `not json`, "1")
+	fake.add("responses", "2", `{"RoomID":2,"Message":"Hi"}`, "1")
+	s := NewSQSMessenger(nil, fake, testSQSConfig)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := make(chan contract.Response, 1)
+	go s.StartConsumer(ctx, func(msg contract.Response) error {
+		received <- msg
+		return nil
+	})
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, uint(2), msg.RoomID)
+	case <-time.After(time.Second):
+		t.Fatal("consumer stopped")
+	}
+}
+
+func TestSQSHandlerSurvivesBadInput(t *testing.T) {
+	backoff := sqsErrorBackoff
+	sqsErrorBackoff = 10 * time.Millisecond
+	defer func() { sqsErrorBackoff = backoff }()
+
+	fake := newFakeSQS()
+	fake.errs = 1
+	fake.add("requests", "1", `not json`, "1")
+	body, err := json.Marshal(contract.NewRequest("stock", []string{"AAPL"}, contract.Requester{Username: "jdoe"}, 2))
+	require.NoError(t, err)
+	fake.add("requests", "2", string(body), "1")
+	config := testSQSConfig
+	config.RequestQueueURL = "requests"
+	s := NewSQSMessenger(nil, fake, config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := make(chan contract.Request, 1)
+	go s.StartHandler(ctx, func(req contract.Request) (contract.Response, error) {
+		received <- req
+		return contract.Response{RoomID: req.RoomID, Text: "quote"}, nil
+	})
+
+	select {
+	case req := <-received:
+		assert.Equal(t, uint(2), req.RoomID)
+	case <-time.After(time.Second):
+		t.Fatal("handler stopped")
+	}
+
+	// The malformed request is dropped, the handled one answered
+	for i := 0; i < 100 && fake.len("requests") > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 0, fake.len("requests"))
+	assert.Equal(t, 1, fake.len("responses"))
+}
+
+func TestSQSExtendVisibility(t *testing.T) {
+	fake := newFakeSQS()
+	s := NewSQSMessenger(nil, fake, testSQSConfig)
+	s.config.VisibilityTimeout = 20 * time.Millisecond
+
+	stop := s.extendVisibility("responses", &sqs.Message{ReceiptHandle: aws.String("1")})
+	time.Sleep(35 * time.Millisecond)
+	stop()
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	assert.True(t, fake.visibilityChanges >= 2)
+}
+
+func TestSQSConsumerExtendsWaitingMessages(t *testing.T) {
+	fake := newFakeSQS()
+	fake.add("responses", "1", `{"RoomID":1,"Message":"Hi"}`, "1")
+	fake.add("responses", "2", `{"RoomID":2,"Message":"Hi"}`, "1")
+
+	config := testSQSConfig
+	config.Workers = 1
+	s := NewSQSMessenger(nil, fake, config)
+	s.config.VisibilityTimeout = 20 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.StartConsumer(ctx, func(msg contract.Response) error {
+			if msg.RoomID == 1 {
+				// Message 2 waits for the only worker
+				time.Sleep(50 * time.Millisecond)
+				return nil
+			}
+			cancel()
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("responses not consumed")
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	assert.True(t, fake.changes["2"] >= 2)
+}
+
+func TestSQSDeleter(t *testing.T) {
+	fake := newFakeSQS()
+	for i := 0; i < 12; i++ {
+		fake.add("responses", fmt.Sprint(i), "{}", "1")
+	}
+
+	d := newSQSDeleter(fake, "responses", time.Hour)
+	for i := 0; i < 12; i++ {
+		d.Delete(aws.String(fmt.Sprint(i)))
+	}
+	d.Close()
+
+	assert.Equal(t, []int{10, 2}, fake.batches)
+	assert.Equal(t, 0, fake.len("responses"))
+}
+
+func TestSQSDeadLetters(t *testing.T) {
+	fake := newFakeSQS()
+	s := NewSQSMessenger(nil, fake, testSQSConfig)
+	for _, body := range []string{"a", "b", "c"} {
+		s.deadLetter(&sqs.Message{MessageId: aws.String(body), Body: aws.String(body)}, ReasonMalformed, errors.New("invalid"))
+	}
+
+	letters, err := s.ListDeadLetters(2)
+	require.Nil(t, err)
+	require.Len(t, letters, 2)
+	assert.Equal(t, "a", letters[0].Body)
+	assert.Equal(t, ReasonMalformed, letters[0].Reason)
+
+	count, err := s.RedriveDeadLetters([]string{"sent-b"})
+	require.Nil(t, err)
+	assert.Equal(t, 1, count)
+	require.Len(t, fake.queues["responses"], 1)
+	assert.Equal(t, "b", *fake.queues["responses"][0].Body)
+
+	count, err = s.RedriveDeadLetters(nil)
+	require.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.Empty(t, fake.queues["dlq"])
+}
+
+func TestSQSNoDeadLetterQueue(t *testing.T) {
+	s := NewSQSMessenger(nil, newFakeSQS(), SQSConfig{})
+
+	_, err := s.ListDeadLetters(10)
+	assert.Equal(t, ErrNoDeadLetterQueue, err)
+
+	_, err = s.RedriveDeadLetters(nil)
+	assert.Equal(t, ErrNoDeadLetterQueue, err)
+}
+
+// fakeSNS records the topics of the published messages
+type fakeSNS struct {
+	snsiface.SNSAPI
+	topics []string
+}
+
+func (f *fakeSNS) Publish(input *sns.PublishInput) (*sns.PublishOutput, error) {
+	f.topics = append(f.topics, aws.StringValue(input.TopicArn))
+	return &sns.PublishOutput{}, nil
+}
+
+func TestSQSPublishRouted(t *testing.T) {
+	fake := &fakeSNS{}
+	s := NewSQSMessenger(fake, nil, SQSConfig{
+		RequestTopicARN: "stock-topic",
+		Routes:          Routes{"fx": "fx-topic"},
+	})
+
+	require.Nil(t, s.Publish(contract.NewRequest("stock", []string{"AAPL"}, contract.Requester{}, 1)))
+	require.Nil(t, s.Publish(contract.NewRequest("fx", []string{"EURUSD"}, contract.Requester{}, 1)))
+	assert.Equal(t, []string{"stock-topic", "fx-topic"}, fake.topics)
+}
+
+func TestSNSMessage(t *testing.T) {
+	body := `{"RoomID":1,"Message":"AAPL"}`
+	notification := `{"Type":"Notification","MessageId":"1","Message":"{\"RoomID\":1,\"Message\":\"AAPL\"}"}`
+
+	assert.Equal(t, body, snsMessage(notification))
+	assert.Equal(t, body, snsMessage(body))
+	assert.Equal(t, "not json", snsMessage("not json"))
+}
@@ -0,0 +1,98 @@
+package messenger
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// Maximum entries of an SQS batch request
+const sqsMaxBatch = 10
+
+// sqsDeleter deletes messages from a queue in batches. A batch is sent when
+// it is full or after the flush interval.
+type sqsDeleter struct {
+	sqsSvc   sqsiface.SQSAPI
+	queueURL string
+	handles  chan *string
+	done     chan struct{}
+}
+
+func newSQSDeleter(sqsSvc sqsiface.SQSAPI, queueURL string, interval time.Duration) *sqsDeleter {
+	d := &sqsDeleter{
+		sqsSvc:   sqsSvc,
+		queueURL: queueURL,
+		handles:  make(chan *string),
+		done:     make(chan struct{}),
+	}
+	go d.run(interval)
+	return d
+}
+
+// Delete queues the message with the given receipt handle for deletion
+func (d *sqsDeleter) Delete(receiptHandle *string) {
+	d.handles <- receiptHandle
+}
+
+// Close deletes the pending messages and stops the deleter
+func (d *sqsDeleter) Close() {
+	close(d.handles)
+	<-d.done
+}
+
+func (d *sqsDeleter) run(interval time.Duration) {
+	defer close(d.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var batch []*string
+	for {
+		select {
+		case handle, ok := <-d.handles:
+			if !ok {
+				d.flush(batch)
+				return
+			}
+			if batch = append(batch, handle); len(batch) == sqsMaxBatch {
+				d.flush(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			d.flush(batch)
+			batch = nil
+		}
+	}
+}
+
+func (d *sqsDeleter) flush(batch []*string) {
+	if len(batch) == 0 {
+		return
+	}
+
+	entries := make([]*sqs.DeleteMessageBatchRequestEntry, len(batch))
+	for i, handle := range batch {
+		entries[i] = &sqs.DeleteMessageBatchRequestEntry{
+			Id:            aws.String(strconv.Itoa(i)),
+			ReceiptHandle: handle,
+		}
+	}
+
+	output, err := d.sqsSvc.DeleteMessageBatch(&sqs.DeleteMessageBatchInput{
+		QueueUrl: aws.String(d.queueURL),
+		Entries:  entries,
+	})
+	if err != nil {
+		// Messages will be received again after the visibility timeout
+		log.Printf("Error deleting %d messages from queue: %s\n", len(batch), err)
+		return
+	}
+
+	for _, failed := range output.Failed {
+		log.Printf("Error deleting message from queue: %s\n", aws.StringValue(failed.Message))
+	}
+}
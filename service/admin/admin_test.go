@@ -0,0 +1,245 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/audit"
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+// run runs a command with JSON output, decoding it into v
+func run(t *testing.T, repos repository.Repositories, v interface{}, args ...string) {
+	var out bytes.Buffer
+	require.NoError(t, Command(repos, Server{}, append([]string{"-json"}, args...), &out))
+	require.NoError(t, json.Unmarshal(out.Bytes(), v), out.String())
+}
+
+func TestUsers(t *testing.T) {
+	repos := repository.NewMemory()
+
+	var created UserOutput
+	run(t, repos, &created, "users", "create", "-role", "moderator", "jdoe", "jdoe@mail.com")
+	assert.Equal(t, "jdoe", created.Username)
+	assert.Equal(t, models.RoleModerator, created.Role)
+	assert.Len(t, created.Password, 24)
+
+	user, err := repos.Users.FindByUsername("jdoe")
+	require.NoError(t, err)
+	assert.Equal(t, created.Password, user.Password)
+
+	var reset UserOutput
+	run(t, repos, &reset, "users", "reset", "jdoe")
+	assert.NotEqual(t, created.Password, reset.Password)
+	user, _ = repos.Users.FindByUsername("jdoe")
+	assert.Equal(t, reset.Password, user.Password)
+
+	var disabled UserOutput
+	run(t, repos, &disabled, "users", "disable", "jdoe")
+	assert.True(t, disabled.Disabled)
+	assert.Empty(t, disabled.Password)
+
+	var granted UserOutput
+	run(t, repos, &granted, "users", "grant", "jdoe", "admin")
+	assert.Equal(t, models.RoleAdmin, granted.Role)
+
+	var users []UserOutput
+	run(t, repos, &users, "users", "list")
+	require.Len(t, users, 1)
+	assert.Equal(t, models.RoleAdmin, users[0].Role)
+	assert.True(t, users[0].Disabled)
+	assert.Empty(t, users[0].Password)
+
+	var enabled UserOutput
+	run(t, repos, &enabled, "users", "enable", "jdoe")
+	assert.False(t, enabled.Disabled)
+
+	// Every change is audited
+	entries, err := repos.Audit.List(repository.AuditFilter{Actor: Actor})
+	require.NoError(t, err)
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	assert.Equal(t, []string{
+		audit.ActionUserEnable,
+		audit.ActionUserGrant,
+		audit.ActionUserDisable,
+		audit.ActionUserReset,
+		audit.ActionUserCreate,
+	}, actions)
+	assert.Equal(t, `{"previous":"moderator","role":"admin"}`, entries[1].Details)
+}
+
+func TestUsersErrors(t *testing.T) {
+	repos := repository.NewMemory()
+	require.NoError(t, repos.Users.Create(&models.User{Username: "jdoe", Email: "jdoe@mail.com"}))
+	bot := models.NewBotUser("Bot")
+	require.NoError(t, repos.Users.Create(&bot))
+
+	for args, message := range map[string]string{
+		"users create jdoe other@mail.com":         "username jdoe or email other@mail.com is taken",
+		"users create -role owner jane a@mail.com": `invalid role "owner", one of admin, moderator, user, bot`,
+		"users grant jdoe owner":                   `invalid role "owner", one of admin, moderator, user, bot`,
+		"users grant jdoe bot":                     "user jdoe: only bot users have the bot role",
+		"users grant Bot admin":                    "user Bot: only bot users have the bot role",
+		"users disable jane":                       "user jane not found",
+		"rooms archive 1":                          "room 1 not found",
+		"rooms rename general lobby":               `invalid room ID "general"`,
+		"bot rotate jdoe":                          `username "jdoe" belongs to a user`,
+	} {
+		err := Command(repos, Server{}, strings.Fields(args), ioutil.Discard)
+		if assert.Error(t, err, args) {
+			assert.Equal(t, message, err.Error(), args)
+		}
+	}
+}
+
+func TestRooms(t *testing.T) {
+	repos := repository.NewMemory()
+
+	var room RoomOutput
+	run(t, repos, &room, "rooms", "create", "General")
+	assert.EqualValues(t, 1, room.ID)
+
+	run(t, repos, &room, "rooms", "rename", "1", "Lobby")
+	assert.Equal(t, "Lobby", room.Name)
+	run(t, repos, &room, "rooms", "archive", "1")
+	assert.True(t, room.Archived)
+
+	var rooms []RoomOutput
+	run(t, repos, &rooms, "rooms", "list")
+	require.Len(t, rooms, 1)
+	assert.Equal(t, "Lobby", rooms[0].Name)
+	assert.True(t, rooms[0].Archived)
+
+	run(t, repos, &room, "rooms", "unarchive", "1")
+	assert.False(t, room.Archived)
+
+	entries, err := repos.Audit.List(repository.AuditFilter{Target: "room:1"})
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	assert.Equal(t, audit.ActionRoomRename, entries[2].Action)
+	assert.Equal(t, `{"name":"Lobby","previous":"General"}`, entries[2].Details)
+}
+
+func TestBotRotate(t *testing.T) {
+	repos := repository.NewMemory()
+
+	// The default bot user is created on its first rotation
+	var bot UserOutput
+	run(t, repos, &bot, "bot", "rotate")
+	assert.Equal(t, "Bot", bot.Username)
+	assert.Equal(t, models.RoleBot, bot.Role)
+	assert.True(t, bot.Bot)
+	assert.Equal(t, "bot@bots.invalid", bot.Email)
+	assert.Empty(t, bot.Password)
+
+	// Passwords left on bot users are revoked
+	user, err := repos.Users.FindByUsername("Bot")
+	require.NoError(t, err)
+	user.Password = "secret"
+	require.NoError(t, repos.Users.Update(&user))
+
+	run(t, repos, &bot, "bot", "rotate", "Bot")
+	assert.Empty(t, bot.Password)
+	user, err = repos.Users.FindByUsername("Bot")
+	require.NoError(t, err)
+	assert.Empty(t, user.Password)
+
+	users, _ := repos.Users.List()
+	assert.Len(t, users, 1)
+
+	// Bot users get no password
+	var created UserOutput
+	run(t, repos, &created, "users", "create", "-role", "bot", "quotes", "quotes@mail.com")
+	assert.True(t, created.Bot)
+	assert.Empty(t, created.Password)
+	err = Command(repos, Server{}, []string{"users", "reset", "quotes"}, ioutil.Discard)
+	if assert.Error(t, err) {
+		assert.Equal(t, "user quotes is a bot, and cannot log in", err.Error())
+	}
+}
+
+func TestTextOutput(t *testing.T) {
+	repos := repository.NewMemory()
+	require.NoError(t, repos.Users.Create(&models.User{Username: "jdoe", Email: "jdoe@mail.com"}))
+	require.NoError(t, repos.Users.Create(&models.User{Username: "jane", Email: "jane@mail.com", Role: models.RoleAdmin, Disabled: true}))
+
+	var out bytes.Buffer
+	require.NoError(t, Command(repos, Server{}, []string{"users", "list"}, &out))
+	assert.Equal(t, ""+
+		"ID  USERNAME  EMAIL          ROLE   STATUS\n"+
+		"1   jdoe      jdoe@mail.com  user   active\n"+
+		"2   jane      jane@mail.com  admin  disabled\n", out.String())
+
+	out.Reset()
+	require.NoError(t, Command(repos, Server{}, []string{"users", "reset", "jdoe"}, &out))
+	user, _ := repos.Users.FindByUsername("jdoe")
+	assert.Equal(t, ""+
+		"ID  USERNAME  EMAIL          ROLE  STATUS\n"+
+		"1   jdoe      jdoe@mail.com  user  active\n"+
+		"Password: "+user.Password+"\n", out.String())
+}
+
+func TestSessions(t *testing.T) {
+	connectedAt := time.Date(2019, 12, 20, 12, 0, 0, 0, time.UTC)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/admin/sessions" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":401,"message":"auth header is empty"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(viewmodels.ListSessionResponse{Sessions: []viewmodels.SessionView{
+			{ID: "10.0.0.1:52000", UserAgent: "Firefox", ConnectedAt: connectedAt},
+		}})
+	}))
+	defer s.Close()
+	repos := repository.NewMemory()
+
+	var out bytes.Buffer
+	require.NoError(t, Command(repos, Server{URL: s.URL + "/", Token: "token"}, []string{"sessions"}, &out))
+	assert.Equal(t, ""+
+		"ID              CONNECTED             USER AGENT\n"+
+		"10.0.0.1:52000  2019-12-20T12:00:00Z  Firefox\n", out.String())
+
+	out.Reset()
+	require.NoError(t, Command(repos, Server{URL: s.URL, Token: "token"}, []string{"-json", "sessions"}, &out))
+	var sessions []viewmodels.SessionView
+	require.NoError(t, json.Unmarshal(out.Bytes(), &sessions))
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "Firefox", sessions[0].UserAgent)
+
+	assert.Equal(t, ErrNoToken, Command(repos, Server{URL: s.URL}, []string{"sessions"}, ioutil.Discard))
+	err := Command(repos, Server{URL: s.URL, Token: "expired"}, []string{"sessions"}, ioutil.Discard)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "401 Unauthorized")
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range []string{
+		"",
+		"-yaml users list",
+		"users",
+		"users list all",
+		"users create jdoe",
+		"users delete jdoe",
+		"rooms rename 1",
+		"sessions all",
+		"bot rotate a b",
+	} {
+		assert.Equal(t, ErrUsage, Command(repository.NewMemory(), Server{}, strings.Fields(args), ioutil.Discard), args)
+	}
+}
@@ -0,0 +1,393 @@
+// Package admin implements the admin subcommand, managing the users, rooms
+// and bot users on the database, and listing the sessions of a running
+// server through its API.
+//
+// Changes are recorded in the audit log as made by the "admin-cli" actor.
+// Generated passwords are printed once, and cannot be read back.
+package admin
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/hernanrocha/fin-chat/service/audit"
+	"github.com/hernanrocha/fin-chat/service/hub/handler"
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+)
+
+// ErrUsage is returned for invalid admin arguments
+var ErrUsage = errors.New(`usage: admin [-json] <command>
+
+  users list
+  users create [-role <role>] <username> <email>
+  users disable <username>
+  users enable <username>
+  users reset <username>
+  users grant <username> <role>
+  rooms list
+  rooms create <name>
+  rooms archive <id>
+  rooms unarchive <id>
+  rooms rename <id> <name>
+  sessions
+  bot rotate [<name>]`)
+
+// Actor of the audit log entries
+const Actor = "admin-cli"
+
+// Random bytes of the generated passwords
+const passwordBytes = 18
+
+// Command runs the admin subcommand given by args, writing its output to
+// out as text or, with -json, as JSON
+func Command(repos repository.Repositories, server Server, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("admin", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	asJSON := flags.Bool("json", false, "write JSON output")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		return ErrUsage
+	}
+
+	c := &command{
+		repos:    repos,
+		auditLog: audit.NewLogger(repos.Audit),
+		server:   server,
+		printer:  printer{out: out, json: *asJSON},
+	}
+	return c.run(flags.Args())
+}
+
+type command struct {
+	repos    repository.Repositories
+	auditLog *audit.Logger
+	server   Server
+	printer  printer
+}
+
+func (c *command) run(args []string) error {
+	if args[0] == "sessions" {
+		if len(args) != 1 {
+			return ErrUsage
+		}
+		return c.listSessions()
+	}
+	if len(args) < 2 {
+		return ErrUsage
+	}
+
+	name, args := args[0]+" "+args[1], args[2:]
+	switch {
+	case name == "users list" && len(args) == 0:
+		return c.listUsers()
+	case name == "users create":
+		return c.createUser(args)
+	case name == "users disable" && len(args) == 1:
+		return c.setDisabled(args[0], true)
+	case name == "users enable" && len(args) == 1:
+		return c.setDisabled(args[0], false)
+	case name == "users reset" && len(args) == 1:
+		return c.resetPassword(args[0])
+	case name == "users grant" && len(args) == 2:
+		return c.grantRole(args[0], args[1])
+	case name == "rooms list" && len(args) == 0:
+		return c.listRooms()
+	case name == "rooms create" && len(args) == 1:
+		return c.createRoom(args[0])
+	case name == "rooms archive" && len(args) == 1:
+		return c.setArchived(args[0], true)
+	case name == "rooms unarchive" && len(args) == 1:
+		return c.setArchived(args[0], false)
+	case name == "rooms rename" && len(args) == 2:
+		return c.renameRoom(args[0], args[1])
+	case name == "bot rotate" && len(args) == 0:
+		return c.rotateBot(handler.DefaultBotName)
+	case name == "bot rotate" && len(args) == 1:
+		return c.rotateBot(args[0])
+	}
+	return ErrUsage
+}
+
+// record appends an entry to the audit log
+func (c *command) record(action, target string, details map[string]interface{}) error {
+	entry := models.AuditEntry{Actor: Actor, Action: action, Target: target}
+	if details != nil {
+		b, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		entry.Details = string(b)
+	}
+	_, err := c.auditLog.Record(entry)
+	return err
+}
+
+func userTarget(username string) string {
+	return "user:" + username
+}
+
+func roomTarget(id uint) string {
+	return fmt.Sprintf("room:%d", id)
+}
+
+// generatePassword returns a random password
+func generatePassword() (string, error) {
+	b := make([]byte, passwordBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (c *command) findUser(username string) (models.User, error) {
+	user, err := c.repos.Users.FindByUsername(username)
+	if err == repository.ErrNotFound {
+		return user, fmt.Errorf("user %s not found", username)
+	}
+	return user, err
+}
+
+func (c *command) updateUser(user *models.User) error {
+	err := c.repos.Users.Update(user)
+	if err == repository.ErrDuplicated {
+		return fmt.Errorf("username %s or email %s is taken", user.Username, user.Email)
+	}
+	return err
+}
+
+func validateRole(role string) error {
+	if !models.ValidRole(role) {
+		return fmt.Errorf("invalid role %q, one of %s", role, strings.Join(models.Roles, ", "))
+	}
+	return nil
+}
+
+func (c *command) listUsers() error {
+	users, err := c.repos.Users.List()
+	if err != nil {
+		return err
+	}
+	return c.printer.users(users)
+}
+
+func (c *command) createUser(args []string) error {
+	flags := flag.NewFlagSet("users create", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	role := flags.String("role", models.RoleUser, "role of the user")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 2 {
+		return ErrUsage
+	}
+	if err := validateRole(*role); err != nil {
+		return err
+	}
+
+	// Bot users cannot log in, so they get no password
+	password := ""
+	if *role != models.RoleBot {
+		var err error
+		if password, err = generatePassword(); err != nil {
+			return err
+		}
+	}
+	user := models.User{
+		Username: flags.Arg(0),
+		Email:    flags.Arg(1),
+		Password: password,
+		Role:     *role,
+		Bot:      *role == models.RoleBot,
+	}
+	if err := c.repos.Users.Create(&user); err != nil {
+		if err == repository.ErrDuplicated {
+			return fmt.Errorf("username %s or email %s is taken", user.Username, user.Email)
+		}
+		return err
+	}
+
+	if err := c.record(audit.ActionUserCreate, userTarget(user.Username), map[string]interface{}{"email": user.Email, "role": user.Role}); err != nil {
+		return err
+	}
+	return c.printer.user(user, password)
+}
+
+func (c *command) setDisabled(username string, disabled bool) error {
+	user, err := c.findUser(username)
+	if err != nil {
+		return err
+	}
+
+	user.Disabled = disabled
+	if err := c.updateUser(&user); err != nil {
+		return err
+	}
+
+	action := audit.ActionUserEnable
+	if disabled {
+		action = audit.ActionUserDisable
+	}
+	if err := c.record(action, userTarget(user.Username), nil); err != nil {
+		return err
+	}
+	return c.printer.user(user, "")
+}
+
+func (c *command) resetPassword(username string) error {
+	user, err := c.findUser(username)
+	if err != nil {
+		return err
+	}
+	if user.Bot {
+		return fmt.Errorf("user %s is a bot, and cannot log in", username)
+	}
+
+	password, err := generatePassword()
+	if err != nil {
+		return err
+	}
+	user.Password = password
+	if err := c.updateUser(&user); err != nil {
+		return err
+	}
+
+	if err := c.record(audit.ActionUserReset, userTarget(user.Username), nil); err != nil {
+		return err
+	}
+	return c.printer.user(user, password)
+}
+
+func (c *command) grantRole(username, role string) error {
+	if err := validateRole(role); err != nil {
+		return err
+	}
+	user, err := c.findUser(username)
+	if err != nil {
+		return err
+	}
+
+	previous := user.Role
+	if err := user.GrantRole(role); err != nil {
+		return fmt.Errorf("user %s: %s", username, err)
+	}
+	if err := c.updateUser(&user); err != nil {
+		return err
+	}
+
+	if err := c.record(audit.ActionUserGrant, userTarget(user.Username), map[string]interface{}{"role": role, "previous": previous}); err != nil {
+		return err
+	}
+	return c.printer.user(user, "")
+}
+
+// rotateBot revokes the login password of a bot user, creating it if it
+// does not exist yet. Bots post through the server, and cannot log in.
+func (c *command) rotateBot(name string) error {
+	user, err := c.repos.Users.FindByUsername(name)
+	switch {
+	case err == repository.ErrNotFound:
+		// Like the bot users created on the first response of a bot
+		user = models.NewBotUser(name)
+		err = c.repos.Users.Create(&user)
+	case err != nil:
+		return err
+	case !user.Bot:
+		return fmt.Errorf("username %q belongs to a user", name)
+	default:
+		user.Password = ""
+		err = c.updateUser(&user)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := c.record(audit.ActionBotRotate, userTarget(user.Username), nil); err != nil {
+		return err
+	}
+	return c.printer.user(user, "")
+}
+
+func (c *command) findRoom(id string) (models.Room, error) {
+	roomID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return models.Room{}, fmt.Errorf("invalid room ID %q", id)
+	}
+
+	room, err := c.repos.Rooms.Find(uint(roomID))
+	if err == repository.ErrNotFound {
+		return room, fmt.Errorf("room %d not found", roomID)
+	}
+	return room, err
+}
+
+func (c *command) listRooms() error {
+	rooms, err := c.repos.Rooms.List()
+	if err != nil {
+		return err
+	}
+	return c.printer.rooms(rooms)
+}
+
+func (c *command) createRoom(name string) error {
+	room := models.Room{Name: name}
+	if err := c.repos.Rooms.Create(&room); err != nil {
+		return err
+	}
+
+	if err := c.record(audit.ActionRoomCreate, roomTarget(room.ID), map[string]interface{}{"name": room.Name}); err != nil {
+		return err
+	}
+	return c.printer.room(room)
+}
+
+func (c *command) setArchived(id string, archived bool) error {
+	room, err := c.findRoom(id)
+	if err != nil {
+		return err
+	}
+
+	room.Archived = archived
+	if err := c.repos.Rooms.Update(&room); err != nil {
+		return err
+	}
+
+	action := audit.ActionRoomUnarchive
+	if archived {
+		action = audit.ActionRoomArchive
+	}
+	if err := c.record(action, roomTarget(room.ID), nil); err != nil {
+		return err
+	}
+	return c.printer.room(room)
+}
+
+func (c *command) renameRoom(id, name string) error {
+	room, err := c.findRoom(id)
+	if err != nil {
+		return err
+	}
+
+	previous := room.Name
+	room.Name = name
+	if err := c.repos.Rooms.Update(&room); err != nil {
+		return err
+	}
+
+	if err := c.record(audit.ActionRoomRename, roomTarget(room.ID), map[string]interface{}{"name": name, "previous": previous}); err != nil {
+		return err
+	}
+	return c.printer.room(room)
+}
+
+func (c *command) listSessions() error {
+	sessions, err := c.server.Sessions()
+	if err != nil {
+		return err
+	}
+	return c.printer.sessions(sessions)
+}
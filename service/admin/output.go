@@ -0,0 +1,155 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+// UserOutput is a user in the JSON output
+type UserOutput struct {
+	ID        uint      `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Role      string    `json:"role"`
+	Bot       bool      `json:"bot"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"created_at"`
+	// Only set when the password was generated
+	Password string `json:"password,omitempty"`
+}
+
+// RoomOutput is a room in the JSON output
+type RoomOutput struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Archived  bool      `json:"archived"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func userOutput(user models.User) UserOutput {
+	return UserOutput{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Role:      user.Role,
+		Bot:       user.Bot,
+		Disabled:  user.Disabled,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+func roomOutput(room models.Room) RoomOutput {
+	return RoomOutput{
+		ID:        room.ID,
+		Name:      room.Name,
+		Archived:  room.Archived,
+		CreatedAt: room.CreatedAt,
+	}
+}
+
+// printer writes the output as text tables or JSON. Lists are written as
+// JSON arrays, and the users and rooms changed as objects.
+type printer struct {
+	out  io.Writer
+	json bool
+}
+
+func (p printer) writeJSON(v interface{}) error {
+	enc := json.NewEncoder(p.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (p printer) table(header string, write func(w io.Writer)) error {
+	w := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, header)
+	write(w)
+	return w.Flush()
+}
+
+func (p printer) users(users []models.User) error {
+	if p.json {
+		list := make([]UserOutput, len(users))
+		for i, u := range users {
+			list[i] = userOutput(u)
+		}
+		return p.writeJSON(list)
+	}
+
+	return p.table("ID\tUSERNAME\tEMAIL\tROLE\tSTATUS", func(w io.Writer) {
+		for _, u := range users {
+			status := "active"
+			if u.Disabled {
+				status = "disabled"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", u.ID, u.Username, u.Email, u.Role, status)
+		}
+	})
+}
+
+// user writes a user, and its password if it was generated
+func (p printer) user(user models.User, password string) error {
+	if p.json {
+		output := userOutput(user)
+		output.Password = password
+		return p.writeJSON(output)
+	}
+
+	if err := p.users([]models.User{user}); err != nil {
+		return err
+	}
+	if password == "" {
+		return nil
+	}
+	_, err := fmt.Fprintf(p.out, "Password: %s\n", password)
+	return err
+}
+
+func (p printer) rooms(rooms []models.Room) error {
+	if p.json {
+		list := make([]RoomOutput, len(rooms))
+		for i, r := range rooms {
+			list[i] = roomOutput(r)
+		}
+		return p.writeJSON(list)
+	}
+
+	return p.table("ID\tNAME\tSTATUS", func(w io.Writer) {
+		for _, r := range rooms {
+			status := "active"
+			if r.Archived {
+				status = "archived"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", r.ID, r.Name, status)
+		}
+	})
+}
+
+func (p printer) room(room models.Room) error {
+	if p.json {
+		return p.writeJSON(roomOutput(room))
+	}
+	return p.rooms([]models.Room{room})
+}
+
+func (p printer) sessions(sessions []viewmodels.SessionView) error {
+	if p.json {
+		return p.writeJSON(sessions)
+	}
+
+	return p.table("ID\tCONNECTED\tUSER AGENT", func(w io.Writer) {
+		for _, s := range sessions {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", s.ID, s.ConnectedAt.Format(time.RFC3339), s.UserAgent)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+// ErrNoToken is returned when the server is reached without a token
+var ErrNoToken = errors.New("admin: the token of an admin is required to reach the server")
+
+// Time allowed for the requests to the server
+const serverTimeout = 10 * time.Second
+
+// Server is the API of a running server, for the commands reading its
+// state (e.g. the sessions connected to it)
+type Server struct {
+	// Base URL (e.g. "http://localhost:8001")
+	URL string
+	// JWT of an admin, from POST /login
+	Token  string
+	Client *http.Client
+}
+
+// Sessions returns the WebSocket sessions connected to the server. With
+// several instances, only the ones of the instance serving the request.
+func (s Server) Sessions() ([]viewmodels.SessionView, error) {
+	var response viewmodels.ListSessionResponse
+	err := s.get("/api/v1/admin/sessions", &response)
+	return response.Sessions, err
+}
+
+func (s Server) get(path string, v interface{}) error {
+	if s.Token == "" {
+		return ErrNoToken
+	}
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: serverTimeout}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(s.URL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.Token)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("admin: GET %s: %s: %s", path, res.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,148 @@
+// Package audit records security and moderation events in an append-only
+// log.
+//
+// Each entry holds the hash of the previous one and its own hash, computed
+// from its fields and the previous hash. Changing or removing an entry
+// breaks the chain from that entry on, which Verify reports. Removing the
+// newest entries is only detected by comparing the head hash with a copy
+// kept elsewhere.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+)
+
+// Recorded actions
+const (
+	ActionLogin          = "auth.login"
+	ActionLoginFailed    = "auth.login_failed"
+	ActionRegister       = "auth.register"
+	ActionRoomCreate     = "room.create"
+	ActionRoomRetention  = "room.retention"
+	ActionRetentionPurge = "retention.purge"
+	ActionExportCreate   = "export.create"
+	ActionExportDownload = "export.download"
+	ActionUserCreate     = "user.create"
+	ActionUserDisable    = "user.disable"
+	ActionUserEnable     = "user.enable"
+	ActionUserReset      = "user.reset_password"
+	ActionUserGrant      = "user.grant"
+	ActionRoomArchive    = "room.archive"
+	ActionRoomUnarchive  = "room.unarchive"
+	ActionRoomRename     = "room.rename"
+	ActionRoomDelete     = "room.delete"
+	ActionBotRotate      = "bot.rotate"
+)
+
+// Appends retried when other instances append at the same time
+const appendAttempts = 10
+
+// Entries read at once by Verify
+const verifyBatchSize = 500
+
+// Hash returns the hash of an entry, chained to its previous hash
+func Hash(entry models.AuditEntry) string {
+	// Encoding the fields as an array keeps their boundaries
+	fields, _ := json.Marshal([]string{
+		entry.PrevHash,
+		entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+		entry.Actor,
+		entry.Action,
+		entry.Target,
+		entry.IP,
+		entry.UserAgent,
+		entry.Details,
+	})
+	sum := sha256.Sum256(fields)
+	return hex.EncodeToString(sum[:])
+}
+
+// Logger appends entries to the audit log
+type Logger struct {
+	entries repository.AuditRepository
+	now     func() time.Time
+	// Appends of this instance are serialized to avoid retries
+	mu sync.Mutex
+}
+
+// NewLogger returns a logger of an audit log repository
+func NewLogger(entries repository.AuditRepository) *Logger {
+	return &Logger{
+		entries: entries,
+		now:     time.Now,
+	}
+}
+
+// Record appends an entry to the log, setting its creation time and
+// hashes, and returns it
+func (l *Logger) Record(entry models.AuditEntry) (models.AuditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Postgres keeps microseconds, and the hash must match the stored time
+	entry.ID = 0
+	entry.CreatedAt = l.now().UTC().Truncate(time.Microsecond)
+
+	for i := 0; i < appendAttempts; i++ {
+		last, err := l.entries.Last()
+		if err != nil && err != repository.ErrNotFound {
+			return entry, err
+		}
+
+		entry.PrevHash = last.Hash
+		entry.Hash = Hash(entry)
+		err = l.entries.Append(&entry)
+		if err != repository.ErrDuplicated {
+			return entry, err
+		}
+	}
+
+	return entry, fmt.Errorf("audit log: %d concurrent appends failed", appendAttempts)
+}
+
+// List returns the entries matching a filter, newest first
+func (l *Logger) List(filter repository.AuditFilter) ([]models.AuditEntry, error) {
+	return l.entries.List(filter)
+}
+
+// Verification is the outcome of the verification of the chain
+type Verification struct {
+	Valid bool
+	// Entries verified, up to the first broken one
+	Entries int
+	// First entry not matching its hash or its previous entry, if not valid
+	BrokenID uint
+	// Hash of the newest entry
+	Head string
+}
+
+// Verify checks the hashes of every entry, oldest first
+func (l *Logger) Verify() (Verification, error) {
+	v := Verification{Valid: true}
+	var afterID uint
+	for {
+		entries, err := l.entries.Chain(afterID, verifyBatchSize)
+		if err != nil || len(entries) == 0 {
+			return v, err
+		}
+
+		for _, e := range entries {
+			if e.PrevHash != v.Head || e.Hash != Hash(e) {
+				v.Valid = false
+				v.BrokenID = e.ID
+				return v, nil
+			}
+			v.Entries++
+			v.Head = e.Hash
+			afterID = e.ID
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/storage/storagetest"
+)
+
+func TestRecord(t *testing.T) {
+	db := storagetest.SQLite(t)
+	defer db.Close()
+	l := NewLogger(repository.NewGorm(db).Audit)
+	now := time.Date(2019, 12, 20, 12, 0, 0, 123456789, time.UTC)
+	l.now = func() time.Time { return now }
+
+	first, err := l.Record(models.AuditEntry{Actor: "jdoe", Action: ActionLogin, IP: "10.0.0.1", UserAgent: "curl"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, first.ID)
+	assert.Equal(t, now.Truncate(time.Microsecond), first.CreatedAt)
+	assert.Empty(t, first.PrevHash)
+	assert.Len(t, first.Hash, 64)
+
+	second, err := l.Record(models.AuditEntry{Actor: "jdoe", Action: ActionRoomCreate, Target: "room:1"})
+	require.NoError(t, err)
+	assert.Equal(t, first.Hash, second.PrevHash)
+
+	// Stored entries hash the same
+	entries, err := l.List(repository.AuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, second.Hash, Hash(entries[0]))
+
+	v, err := l.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, Verification{Valid: true, Entries: 2, Head: second.Hash}, v)
+}
+
+func TestAppendOnly(t *testing.T) {
+	db := storagetest.SQLite(t)
+	defer db.Close()
+	l := NewLogger(repository.NewGorm(db).Audit)
+
+	for _, actor := range []string{"jdoe", "jane", "john"} {
+		_, err := l.Record(models.AuditEntry{Actor: actor, Action: ActionLogin})
+		require.NoError(t, err)
+	}
+
+	assert.Error(t, db.Exec(`UPDATE audit_log SET actor = 'mallory' WHERE id = 2`).Error)
+	assert.Error(t, db.Exec(`DELETE FROM audit_log WHERE id = 2`).Error)
+
+	// Changes bypassing the triggers break the chain
+	require.NoError(t, db.Exec(`DROP TRIGGER audit_log_no_update`).Error)
+	require.NoError(t, db.Exec(`UPDATE audit_log SET actor = 'mallory' WHERE id = 2`).Error)
+
+	v, err := l.Verify()
+	require.NoError(t, err)
+	assert.False(t, v.Valid)
+	assert.Equal(t, 1, v.Entries)
+	assert.EqualValues(t, 2, v.BrokenID)
+}
+
+func TestVerifyRemoved(t *testing.T) {
+	db := storagetest.SQLite(t)
+	defer db.Close()
+	l := NewLogger(repository.NewGorm(db).Audit)
+
+	for i := 0; i < 3; i++ {
+		_, err := l.Record(models.AuditEntry{Actor: "jdoe", Action: ActionLogin})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, db.Exec(`DROP TRIGGER audit_log_no_delete`).Error)
+	require.NoError(t, db.Exec(`DELETE FROM audit_log WHERE id = 2`).Error)
+
+	v, err := l.Verify()
+	require.NoError(t, err)
+	assert.False(t, v.Valid)
+	assert.EqualValues(t, 3, v.BrokenID)
+}
+
+func TestRecordConcurrently(t *testing.T) {
+	entries := repository.NewMemory().Audit
+
+	// Loggers of several instances sharing the log
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(l *Logger) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				_, err := l.Record(models.AuditEntry{Action: ActionLogin})
+				assert.NoError(t, err)
+			}
+		}(NewLogger(entries))
+	}
+	wg.Wait()
+
+	v, err := NewLogger(entries).Verify()
+	require.NoError(t, err)
+	assert.True(t, v.Valid)
+	assert.Equal(t, 20, v.Entries)
+}
+
+func TestHash(t *testing.T) {
+	entry := models.AuditEntry{Actor: "jdoe", Action: ActionLogin, CreatedAt: time.Now()}
+
+	// Field boundaries are part of the hash
+	moved := entry
+	moved.Actor, moved.Action = "jdoeauth", ".login"
+	assert.NotEqual(t, Hash(entry), Hash(moved))
+
+	// The ID and stored hashes are not
+	stored := entry
+	stored.ID, stored.Hash = 7, "hash"
+	assert.Equal(t, Hash(entry), Hash(stored))
+}
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hernanrocha/fin-chat/service/audit"
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+const (
+	// Audit entries listed when no limit is given
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// recordAudit appends an event of a request to the audit log. Failures are
+// logged, the request has already been handled.
+func recordAudit(auditLog *audit.Logger, ctx *gin.Context, actor, action, target string, details interface{}) {
+	entry := models.AuditEntry{
+		Actor:     actor,
+		Action:    action,
+		Target:    target,
+		IP:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	}
+	if details != nil {
+		d, _ := json.Marshal(details)
+		entry.Details = string(d)
+	}
+
+	if _, err := auditLog.Record(entry); err != nil {
+		log.Printf("Error recording %s of %q in the audit log: %s\n", action, actor, err)
+	}
+}
+
+// currentUsername returns the username of the JWT of a request
+func currentUsername(ctx *gin.Context) string {
+	if user := currentUser(ctx); user != nil {
+		return user.Username
+	}
+	return ""
+}
+
+// AuditController ...
+type AuditController struct {
+	auditLog *audit.Logger
+}
+
+// NewAuditController ...
+func NewAuditController(auditLog *audit.Logger) *AuditController {
+	return &AuditController{
+		auditLog: auditLog,
+	}
+}
+
+// ListAuditLog godoc
+// @Summary List Audit Log
+// @Description List audit log entries, newest first
+// @Tags Admin
+// @Param Authorization header string true "JWT Token"
+// @Param actor query string false "Username acting"
+// @Param action query string false "Action, like auth.login"
+// @Param target query string false "Target, like room:1"
+// @Param since query string false "Entries at or after a time (RFC 3339)"
+// @Param until query string false "Entries before a time (RFC 3339)"
+// @Param before_id query int false "Entries older than an entry, to page"
+// @Param limit query int false "Maximum number of entries (100 by default, up to 1000)"
+// @Produce  json
+// @Success 200 {object} viewmodels.ListAuditResponse
+// @Router /api/v1/admin/audit [get]
+func (c *AuditController) ListAuditLog(ctx *gin.Context) {
+	filter := repository.AuditFilter{
+		Actor:  ctx.Query("actor"),
+		Action: ctx.Query("action"),
+		Target: ctx.Query("target"),
+	}
+
+	var err error
+	if since := ctx.Query("since"); since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid since"})
+			return
+		}
+	}
+	if until := ctx.Query("until"); until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid until"})
+			return
+		}
+	}
+	if beforeID := ctx.Query("before_id"); beforeID != "" {
+		id, err := strconv.ParseUint(beforeID, 10, 32)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid before_id"})
+			return
+		}
+		filter.BeforeID = uint(id)
+	}
+	filter.Limit, err = strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(defaultAuditLimit)))
+	if err != nil || filter.Limit < 1 || filter.Limit > maxAuditLimit {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	entries, err := c.auditLog.List(filter)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	entryList := make([]viewmodels.AuditEntryView, len(entries))
+	for i, e := range entries {
+		entryList[i] = viewmodels.AuditEntryView{
+			ID:        e.ID,
+			CreatedAt: e.CreatedAt,
+			Actor:     e.Actor,
+			Action:    e.Action,
+			Target:    e.Target,
+			IP:        e.IP,
+			UserAgent: e.UserAgent,
+			Details:   e.Details,
+			PrevHash:  e.PrevHash,
+			Hash:      e.Hash,
+		}
+	}
+
+	response := &viewmodels.ListAuditResponse{
+		Entries: entryList,
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// VerifyAuditLog godoc
+// @Summary Verify Audit Log
+// @Description Verify the hash chain of the audit log, reporting the first entry changed or following a removed one
+// @Tags Admin
+// @Param Authorization header string true "JWT Token"
+// @Produce  json
+// @Success 200 {object} viewmodels.VerifyAuditResponse
+// @Router /api/v1/admin/audit/verify [get]
+func (c *AuditController) VerifyAuditLog(ctx *gin.Context) {
+	v, err := c.auditLog.Verify()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := &viewmodels.VerifyAuditResponse{
+		Valid:    v.Valid,
+		Entries:  v.Entries,
+		BrokenID: v.BrokenID,
+		Head:     v.Head,
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
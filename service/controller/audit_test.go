@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/audit"
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+func listAudit(t *testing.T, router *gin.Engine, query, token string) []viewmodels.AuditEntryView {
+	w := performAuthRequest(router, "GET", "/api/v1/admin/audit"+query, nil, token)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp viewmodels.ListAuditResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Entries
+}
+
+func TestAuditLog(t *testing.T) {
+	repos := repository.NewMemory()
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repos})
+
+	// Registration and login
+	token := generateRoleToken(t, router, repos.Users, models.RoleAdmin)
+	entries := listAudit(t, router, "", token)
+	require.Len(t, entries, 2)
+	username := entries[0].Actor
+	assert.Equal(t, audit.ActionLogin, entries[0].Action)
+	assert.Equal(t, "user:"+username, entries[0].Target)
+	assert.Equal(t, audit.ActionRegister, entries[1].Action)
+	assert.Equal(t, entries[1].Hash, entries[0].PrevHash)
+
+	w := performRequest(router, "POST", "/login", gin.H{"username": username, "password": "wrong"})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	w = performAuthRequest(router, "POST", "/api/v1/rooms", gin.H{"name": "General"}, token)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	entries = listAudit(t, router, "?action="+audit.ActionLoginFailed, token)
+	require.Len(t, entries, 1)
+	assert.Equal(t, username, entries[0].Actor)
+	assert.JSONEq(t, `{"reason":"wrong password"}`, entries[0].Details)
+
+	entries = listAudit(t, router, "?actor="+username+"&limit=1", token)
+	require.Len(t, entries, 1)
+	assert.Equal(t, audit.ActionRoomCreate, entries[0].Action)
+	assert.Equal(t, "room:1", entries[0].Target)
+	assert.JSONEq(t, `{"name":"General"}`, entries[0].Details)
+
+	entries = listAudit(t, router, "?before_id=2", token)
+	require.Len(t, entries, 1)
+	assert.Equal(t, audit.ActionRegister, entries[0].Action)
+
+	w = performAuthRequest(router, "GET", "/api/v1/admin/audit/verify", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp viewmodels.VerifyAuditResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Valid)
+	assert.Equal(t, 4, resp.Entries)
+}
+
+func TestAuditLogInvalid(t *testing.T) {
+	repos := repository.NewMemory()
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repos})
+	token := generateRoleToken(t, router, repos.Users, models.RoleAdmin)
+
+	for _, query := range []string{
+		"?since=yesterday",
+		"?until=2019-12-20",
+		"?before_id=-1",
+		"?limit=0",
+		"?limit=1001",
+	} {
+		w := performAuthRequest(router, "GET", "/api/v1/admin/audit"+query, nil, token)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	w := performRequest(router, "GET", "/api/v1/admin/audit", nil)
+	assertUnauthorized(t, w)
+}
@@ -7,21 +7,24 @@ import (
 
 	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
-	"github.com/jinzhu/gorm"
 
+	"github.com/hernanrocha/fin-chat/service/audit"
 	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
 	"github.com/hernanrocha/fin-chat/service/viewmodels"
 )
 
 // AuthController ...
 type AuthController struct {
-	db *gorm.DB
+	users    repository.UserRepository
+	auditLog *audit.Logger
 }
 
 // NewAuthController ...
-func NewAuthController() *AuthController {
+func NewAuthController(users repository.UserRepository, auditLog *audit.Logger) *AuthController {
 	return &AuthController{
-		db: models.GetDB(),
+		users:    users,
+		auditLog: auditLog,
 	}
 }
 
@@ -36,26 +39,47 @@ func NewAuthController() *AuthController {
 func (c *AuthController) Authenticate(ctx *gin.Context) (interface{}, error) {
 	var json viewmodels.LoginRequest
 	if err := ctx.ShouldBindJSON(&json); err != nil {
+		c.loginFailed(ctx, json.Username, "missing credentials")
 		return nil, jwt.ErrMissingLoginValues
 	}
 
-	var user models.User
-	if err := c.db.Where("username = ?", json.Username).Find(&user).Error; err != nil {
+	user, err := c.users.FindByUsername(json.Username)
+	if err != nil {
+		c.loginFailed(ctx, json.Username, "unknown user")
+		return nil, jwt.ErrFailedAuthentication
+	}
+
+	// Bots post through the server, and cannot log in
+	if user.Bot {
+		c.loginFailed(ctx, json.Username, "bot user")
 		return nil, jwt.ErrFailedAuthentication
 	}
 
 	if json.Password != user.Password {
+		c.loginFailed(ctx, json.Username, "wrong password")
 		return nil, jwt.ErrFailedAuthentication
 	}
 
+	if user.Disabled {
+		c.loginFailed(ctx, json.Username, "disabled user")
+		return nil, jwt.ErrFailedAuthentication
+	}
+
+	recordAudit(c.auditLog, ctx, user.Username, audit.ActionLogin, "user:"+user.Username, nil)
+
 	return &viewmodels.UserView{
 		Username:  user.Username,
 		Email:     user.Email,
 		FirstName: user.FirstName,
 		LastName:  user.LastName,
+		Role:      user.Role,
 	}, nil
 }
 
+func (c *AuthController) loginFailed(ctx *gin.Context, username, reason string) {
+	recordAudit(c.auditLog, ctx, username, audit.ActionLoginFailed, "user:"+username, gin.H{"reason": reason})
+}
+
 // Register godoc
 // @Summary Register User
 // @Description Register User in database
@@ -77,29 +101,35 @@ func (c *AuthController) Register(ctx *gin.Context) {
 		Email:     json.Email,
 		FirstName: json.FirstName,
 		LastName:  json.LastName,
+		Role:      models.RoleUser,
 	}
 
-	if err := c.db.Create(user).Error; err != nil {
+	if err := c.users.Create(user); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	recordAudit(c.auditLog, ctx, user.Username, audit.ActionRegister, "user:"+user.Username, gin.H{"email": user.Email})
+
 	response := &viewmodels.RegisterResponse{
 		viewmodels.UserView{
 			Username:  user.Username,
 			Email:     user.Email,
 			FirstName: user.FirstName,
 			LastName:  user.LastName,
+			Role:      user.Role,
 		},
 	}
 
 	ctx.JSON(http.StatusOK, response)
 }
 
-func (c *AuthController) JWTMiddleware() (*jwt.GinJWTMiddleware, error) {
+// JWTMiddleware returns the middleware authenticating the requests with the
+// JWTs signed by key
+func (c *AuthController) JWTMiddleware(key []byte) (*jwt.GinJWTMiddleware, error) {
 	authMiddleware, err := jwt.New(&jwt.GinJWTMiddleware{
 		Realm:       "test zone",
-		Key:         []byte("secret key"),
+		Key:         key,
 		Timeout:     time.Hour,
 		MaxRefresh:  time.Hour,
 		IdentityKey: "username",
@@ -107,15 +137,37 @@ func (c *AuthController) JWTMiddleware() (*jwt.GinJWTMiddleware, error) {
 			if v, ok := data.(*viewmodels.UserView); ok {
 				return jwt.MapClaims{
 					"username": v.Username,
+					"role":     v.Role,
 				}
 			}
 			return jwt.MapClaims{}
 		},
-		IdentityHandler: func(c *gin.Context) interface{} {
-			log.Println("IdentityHandler")
-			claims := jwt.ExtractClaims(c)
+		IdentityHandler: func(ctx *gin.Context) interface{} {
+			claims := jwt.ExtractClaims(ctx)
+			username, _ := claims["username"].(string)
+			// The claims keep the role at login, while role changes and
+			// disabled users apply on the next request
+			user, err := c.users.FindByUsername(username)
+			if err != nil {
+				if err != repository.ErrNotFound {
+					log.Printf("Error loading user %s: %s\n", username, err)
+				}
+				return nil
+			}
+			if user.Disabled {
+				return nil
+			}
+			// Users created before roles were introduced are users
+			role := user.Role
+			if role == "" {
+				role = models.RoleUser
+			}
 			return &viewmodels.UserView{
-				Username: claims["username"].(string),
+				Username:  user.Username,
+				Email:     user.Email,
+				FirstName: user.FirstName,
+				LastName:  user.LastName,
+				Role:      role,
 			}
 		},
 		Authenticator: c.Authenticate,
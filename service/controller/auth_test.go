@@ -9,14 +9,16 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	_ "github.com/jinzhu/gorm/dialects/postgres"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/audit"
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
 )
 
 func TestRegisterLogin(t *testing.T) {
-	require.Nil(t, SetupDatabase())
-	router := SetupRouter(nil)
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repository.NewMemory()})
 
 	rand.Seed(int64(time.Now().Nanosecond()))
 	userID := rand.Int()
@@ -37,6 +39,7 @@ func TestRegisterLogin(t *testing.T) {
 		"email":      req["email"],
 		"first_name": req["first_name"],
 		"last_name":  req["last_name"],
+		"role":       "user",
 	}
 
 	// Perform Register
@@ -85,8 +88,7 @@ func TestRegisterLogin(t *testing.T) {
 }
 
 func TestRegisterErrorNoPassword(t *testing.T) {
-	require.Nil(t, SetupDatabase())
-	router := SetupRouter(nil)
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repository.NewMemory()})
 
 	rand.Seed(int64(time.Now().Nanosecond()))
 	userID := rand.Int()
@@ -115,8 +117,7 @@ func TestRegisterErrorNoPassword(t *testing.T) {
 }
 
 func TestLoginInvalidCredentials(t *testing.T) {
-	require.Nil(t, SetupDatabase())
-	router := SetupRouter(nil)
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repository.NewMemory()})
 
 	// Login Request (with invalid credentials)
 	req := gin.H{
@@ -144,3 +145,35 @@ func TestLoginInvalidCredentials(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, "incorrect Username or Password", messageStr)
 }
+
+func TestLoginDisabled(t *testing.T) {
+	repos := repository.NewMemory()
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repos})
+
+	user := models.User{Username: "jdoe", Email: "jdoe@mail.com", Password: "secret", Disabled: true}
+	require.NoError(t, repos.Users.Create(&user))
+
+	w := performRequest(router, "POST", "/login", gin.H{"username": "jdoe", "password": "secret"})
+	assertUnauthorized(t, w)
+
+	entries, err := repos.Audit.List(repository.AuditFilter{Action: audit.ActionLoginFailed})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, `{"reason":"disabled user"}`, entries[0].Details)
+}
+
+func TestLoginBot(t *testing.T) {
+	repos := repository.NewMemory()
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repos})
+
+	user := models.User{Username: "Bot", Email: "bot@mail.com", Password: "secret", Bot: true, Role: models.RoleBot}
+	require.NoError(t, repos.Users.Create(&user))
+
+	w := performRequest(router, "POST", "/login", gin.H{"username": "Bot", "password": "secret"})
+	assertUnauthorized(t, w)
+
+	entries, err := repos.Audit.List(repository.AuditFilter{Action: audit.ActionLoginFailed})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, `{"reason":"bot user"}`, entries[0].Details)
+}
@@ -7,28 +7,46 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jinzhu/gorm"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
-	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
 )
 
+// testJWTKey signs the tokens of the tests
+var testJWTKey = []byte("test key")
+
 func generateToken(t *testing.T, router *gin.Engine) string {
+	return login(t, router, register(t, router))
+}
+
+// generateRoleToken registers a user, grants it a role and logs in
+func generateRoleToken(t *testing.T, router *gin.Engine, users repository.UserRepository, role string) string {
+	username := register(t, router)
+
+	user, err := users.FindByUsername(username)
+	require.NoError(t, err)
+	user.Role = role
+	require.NoError(t, users.Update(&user))
+
+	return login(t, router, username)
+}
+
+// register registers a new user with the "password" password, returning
+// its username
+func register(t *testing.T, router *gin.Engine) string {
 	rand.Seed(int64(time.Now().Nanosecond()))
 	userID := rand.Int()
-	password := "password"
 
 	// Register Request
 	req := gin.H{
 		"username":   fmt.Sprintf("user-%d", userID),
 		"email":      fmt.Sprintf("user-%d@mail.com", userID),
-		"password":   password,
+		"password":   "password",
 		"first_name": "First Name",
 		"last_name":  "Last Name",
 	}
@@ -39,14 +57,18 @@ func generateToken(t *testing.T, router *gin.Engine) string {
 	// Check
 	require.Equal(t, http.StatusOK, w.Code)
 
+	return req["username"].(string)
+}
+
+func login(t *testing.T, router *gin.Engine, username string) string {
 	// Login Request
-	req = gin.H{
-		"username": fmt.Sprintf("user-%d", userID),
-		"password": password,
+	req := gin.H{
+		"username": username,
+		"password": "password",
 	}
 
 	// Perform Login
-	w = performRequest(router, "POST", "/login", req)
+	w := performRequest(router, "POST", "/login", req)
 
 	// Check
 	require.Equal(t, http.StatusOK, w.Code)
@@ -91,23 +113,3 @@ func performAuthRequest(r http.Handler, method, path string, body gin.H, token s
 	r.ServeHTTP(w, req)
 	return w
 }
-
-func getEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
-		return value
-	}
-	return fallback
-}
-
-func SetupDatabase() error {
-	dbconn := getEnv("DB_CONNECTION", "host=localhost port=15432 user=postgres password=postgres dbname=finchat sslmode=disable")
-	db, err := gorm.Open("postgres", dbconn)
-
-	if err != nil {
-		return err
-	}
-
-	models.Setup(db)
-
-	return err
-}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hernanrocha/fin-chat/messenger"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+// Dead letters listed when no limit is given
+const defaultDeadLetterLimit = 10
+
+// DeadLetterController ...
+type DeadLetterController struct {
+	queue messenger.DeadLetterQueue
+}
+
+// NewDeadLetterController ...
+func NewDeadLetterController(queue messenger.DeadLetterQueue) *DeadLetterController {
+	return &DeadLetterController{
+		queue: queue,
+	}
+}
+
+// ListDeadLetters godoc
+// @Summary List Dead Letters
+// @Description List command responses moved to the dead-letter queue
+// @Tags Admin
+// @Param Authorization header string true "JWT Token"
+// @Param limit query int false "Maximum number of dead letters"
+// @Produce  json
+// @Success 200 {object} viewmodels.ListDeadLetterResponse
+// @Router /api/v1/admin/dead-letters [get]
+func (c *DeadLetterController) ListDeadLetters(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(defaultDeadLetterLimit)))
+	if err != nil || limit < 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	letters, err := c.queue.ListDeadLetters(limit)
+	if err != nil {
+		ctx.JSON(deadLetterStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	letterList := make([]viewmodels.DeadLetterView, len(letters))
+	for i, l := range letters {
+		letterList[i] = viewmodels.DeadLetterView{
+			ID:       l.ID,
+			Body:     l.Body,
+			Reason:   l.Reason,
+			Error:    l.Error,
+			Attempts: l.Attempts,
+			FailedAt: l.FailedAt,
+		}
+	}
+
+	response := &viewmodels.ListDeadLetterResponse{
+		DeadLetters: letterList,
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// RedriveDeadLetters godoc
+// @Summary Redrive Dead Letters
+// @Description Send dead-lettered command responses back to the response queue
+// @Tags Admin
+// @Param Authorization header string true "JWT Token"
+// @Param ids body viewmodels.RedriveDeadLetterRequest true "Dead letters to redrive (all if empty)"
+// @Produce  json
+// @Success 200 {object} viewmodels.RedriveDeadLetterResponse
+// @Router /api/v1/admin/dead-letters/redrive [post]
+func (c *DeadLetterController) RedriveDeadLetters(ctx *gin.Context) {
+	var json viewmodels.RedriveDeadLetterRequest
+	if err := ctx.ShouldBindJSON(&json); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	count, err := c.queue.RedriveDeadLetters(json.IDs)
+	if err != nil {
+		ctx.JSON(deadLetterStatus(err), gin.H{"error": err.Error(), "redriven": count})
+		return
+	}
+
+	response := &viewmodels.RedriveDeadLetterResponse{
+		Redriven: count,
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+func deadLetterStatus(err error) int {
+	if err == messenger.ErrNoDeadLetterQueue {
+		return http.StatusNotImplemented
+	}
+	if _, ok := err.(*messenger.InvalidDeadLetterIDError); ok {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
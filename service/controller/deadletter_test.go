@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/messenger"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+type MockDeadLetterQueue struct {
+	mock.Mock
+}
+
+func NewMockDeadLetterQueue() *MockDeadLetterQueue {
+	return &MockDeadLetterQueue{}
+}
+
+func (m *MockDeadLetterQueue) ListDeadLetters(max int) ([]messenger.DeadLetter, error) {
+	args := m.Called(max)
+	letters, _ := args.Get(0).([]messenger.DeadLetter)
+	return letters, args.Error(1)
+}
+
+func (m *MockDeadLetterQueue) RedriveDeadLetters(ids []string) (int, error) {
+	args := m.Called(ids)
+	return args.Int(0), args.Error(1)
+}
+
+func setupDeadLetterRouter(queue messenger.DeadLetterQueue) *gin.Engine {
+	c := NewDeadLetterController(queue)
+	r := gin.New()
+	r.GET("/dead-letters", c.ListDeadLetters)
+	r.POST("/dead-letters/redrive", c.RedriveDeadLetters)
+	return r
+}
+
+func TestListDeadLetters(t *testing.T) {
+	failedAt := time.Date(2019, 12, 1, 10, 0, 0, 0, time.UTC)
+	queue := NewMockDeadLetterQueue()
+	queue.On("ListDeadLetters", 5).Return([]messenger.DeadLetter{
+		{ID: "1", Body: "not json", Reason: messenger.ReasonMalformed, Error: "invalid character", Attempts: 1, FailedAt: failedAt},
+	}, nil).Once()
+
+	w := performRequest(setupDeadLetterRouter(queue), "GET", "/dead-letters?limit=5", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp viewmodels.ListDeadLetterResponse
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []viewmodels.DeadLetterView{
+		{ID: "1", Body: "not json", Reason: "malformed", Error: "invalid character", Attempts: 1, FailedAt: failedAt},
+	}, resp.DeadLetters)
+	queue.AssertExpectations(t)
+}
+
+func TestListDeadLettersErrors(t *testing.T) {
+	queue := NewMockDeadLetterQueue()
+	queue.On("ListDeadLetters", defaultDeadLetterLimit).Return(nil, messenger.ErrNoDeadLetterQueue).Once()
+	router := setupDeadLetterRouter(queue)
+
+	w := performRequest(router, "GET", "/dead-letters?limit=abc", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performRequest(router, "GET", "/dead-letters", nil)
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+	queue.AssertExpectations(t)
+}
+
+func TestRedriveDeadLetters(t *testing.T) {
+	queue := NewMockDeadLetterQueue()
+	queue.On("RedriveDeadLetters", []string{"1", "2"}).Return(2, nil).Once()
+	queue.On("RedriveDeadLetters", []string(nil)).Return(1, errors.New("send failed")).Once()
+	queue.On("RedriveDeadLetters", []string{"abc"}).Return(0, &messenger.InvalidDeadLetterIDError{ID: "abc"}).Once()
+	router := setupDeadLetterRouter(queue)
+
+	w := performRequest(router, "POST", "/dead-letters/redrive", gin.H{"ids": []string{"1", "2"}})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp viewmodels.RedriveDeadLetterResponse
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Redriven)
+
+	w = performRequest(router, "POST", "/dead-letters/redrive", gin.H{})
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	w = performRequest(router, "POST", "/dead-letters/redrive", gin.H{"ids": []string{"abc"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	queue.AssertExpectations(t)
+}
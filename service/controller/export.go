@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hernanrocha/fin-chat/service/audit"
+	"github.com/hernanrocha/fin-chat/service/export"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+// ExportController ...
+type ExportController struct {
+	exporter *export.Exporter
+	auditLog *audit.Logger
+}
+
+// NewExportController ...
+func NewExportController(exporter *export.Exporter, auditLog *audit.Logger) *ExportController {
+	return &ExportController{
+		exporter: exporter,
+		auditLog: auditLog,
+	}
+}
+
+func exportJobView(job export.Job) viewmodels.ExportJobView {
+	v := viewmodels.ExportJobView{
+		ID:          job.ID,
+		Status:      job.Status,
+		RoomIDs:     job.Request.RoomIDs,
+		Until:       job.Request.Period.Until,
+		Formats:     job.Request.Formats,
+		RequestedBy: job.Request.RequestedBy,
+		Exported:    job.Exported,
+		Total:       job.Total,
+		Error:       job.Error,
+		CreatedAt:   job.CreatedAt,
+		Checksum:    job.Checksum,
+		Size:        job.Size,
+	}
+	if !job.Request.Period.Since.IsZero() {
+		v.Since = &job.Request.Period.Since
+	}
+	if !job.FinishedAt.IsZero() {
+		v.FinishedAt = &job.FinishedAt
+	}
+	if job.Status == export.StatusDone {
+		v.DownloadURL = "/api/v1/admin/exports/" + job.ID + "/download"
+	}
+	return v
+}
+
+// CreateExport godoc
+// @Summary Create Export
+// @Description Start the export of the messages of rooms over a period, soft deleted and archived ones included
+// @Tags Admin
+// @Param Authorization header string true "JWT Token"
+// @Param export body viewmodels.CreateExportRequest true "Export Data"
+// @Produce  json
+// @Success 202 {object} viewmodels.ExportJobResponse
+// @Router /api/v1/admin/exports [post]
+func (c *ExportController) CreateExport(ctx *gin.Context) {
+	var json viewmodels.CreateExportRequest
+	if err := ctx.ShouldBindJSON(&json); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req := export.Request{
+		RoomIDs:     json.RoomIDs,
+		Formats:     json.Formats,
+		RequestedBy: currentUsername(ctx),
+	}
+	if json.Since != nil {
+		req.Period.Since = json.Since.UTC()
+	}
+	if json.Until != nil {
+		req.Period.Until = json.Until.UTC()
+	}
+
+	job, err := c.exporter.Start(req)
+	switch err {
+	case nil:
+	case repository.ErrNotFound:
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "room not found"})
+		return
+	case export.ErrQueueFull:
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAudit(c.auditLog, ctx, req.RequestedBy, audit.ActionExportCreate, "export:"+job.ID, json)
+
+	ctx.JSON(http.StatusAccepted, &viewmodels.ExportJobResponse{
+		ExportJobView: exportJobView(job),
+	})
+}
+
+// ListExports godoc
+// @Summary List Exports
+// @Description List the exports, newest first
+// @Tags Admin
+// @Param Authorization header string true "JWT Token"
+// @Produce  json
+// @Success 200 {object} viewmodels.ListExportResponse
+// @Router /api/v1/admin/exports [get]
+func (c *ExportController) ListExports(ctx *gin.Context) {
+	jobs, err := c.exporter.Jobs()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	exportList := make([]viewmodels.ExportJobView, len(jobs))
+	for i, job := range jobs {
+		exportList[i] = exportJobView(job)
+	}
+
+	response := &viewmodels.ListExportResponse{
+		Exports: exportList,
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// GetExport godoc
+// @Summary Get Export
+// @Description Get the status and progress of an export
+// @Tags Admin
+// @Param Authorization header string true "JWT Token"
+// @Param id path string true "Export ID"
+// @Produce  json
+// @Success 200 {object} viewmodels.ExportJobResponse
+// @Router /api/v1/admin/exports/{id} [get]
+func (c *ExportController) GetExport(ctx *gin.Context) {
+	job, err := c.exporter.Job(ctx.Params.ByName("id"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, &viewmodels.ExportJobResponse{
+		ExportJobView: exportJobView(job),
+	})
+}
+
+// DownloadExport godoc
+// @Summary Download Export
+// @Description Download the zip archive of a done export, with its manifest
+// @Tags Admin
+// @Param Authorization header string true "JWT Token"
+// @Param id path string true "Export ID"
+// @Produce  application/zip
+// @Success 200 {string} string "Zip archive"
+// @Router /api/v1/admin/exports/{id}/download [get]
+func (c *ExportController) DownloadExport(ctx *gin.Context) {
+	id := ctx.Params.ByName("id")
+	path, err := c.exporter.Archive(id)
+	switch err {
+	case nil:
+	case export.ErrNotDone:
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	default:
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAudit(c.auditLog, ctx, currentUsername(ctx), audit.ActionExportDownload, "export:"+id, nil)
+
+	ctx.Header("Content-Disposition", `attachment; filename="fin-chat-export-`+id+`.zip"`)
+	ctx.File(path)
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/audit"
+	"github.com/hernanrocha/fin-chat/service/export"
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+func setupExportRouter(t *testing.T) (*gin.Engine, *export.Exporter, repository.Repositories, func()) {
+	dir, err := ioutil.TempDir("", "export")
+	require.NoError(t, err)
+
+	repos := repository.NewMemory()
+	exporter := export.NewExporter(repos.Rooms, repos.Messages, repos.Exports, export.Config{Dir: dir})
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repos, Exports: exporter})
+	return router, exporter, repos, func() { os.RemoveAll(dir) }
+}
+
+func getExport(t *testing.T, router *gin.Engine, id, token string) viewmodels.ExportJobResponse {
+	w := performAuthRequest(router, "GET", "/api/v1/admin/exports/"+id, nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp viewmodels.ExportJobResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestExport(t *testing.T) {
+	router, exporter, repos, cleanup := setupExportRouter(t)
+	defer cleanup()
+	token := generateRoleToken(t, router, repos.Users, models.RoleAdmin)
+
+	w := performAuthRequest(router, "POST", "/api/v1/rooms", gin.H{"name": "General"}, token)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = performAuthRequest(router, "POST", "/api/v1/admin/exports", gin.H{"room_ids": []uint{1}, "formats": []string{"jsonl"}}, token)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var resp viewmodels.ExportJobResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, export.StatusPending, resp.Status)
+	assert.Empty(t, resp.DownloadURL)
+
+	// Not ready
+	w = performAuthRequest(router, "GET", "/api/v1/admin/exports/"+resp.ID+"/download", nil, token)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go exporter.Run(ctx)
+	for i := 0; i < 200 && resp.Status != export.StatusDone; i++ {
+		time.Sleep(10 * time.Millisecond)
+		resp = getExport(t, router, resp.ID, token)
+	}
+	require.Equal(t, export.StatusDone, resp.Status, resp.Error)
+	assert.NotNil(t, resp.FinishedAt)
+
+	w = performAuthRequest(router, "GET", resp.DownloadURL, nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), resp.ID+".zip")
+	sum := sha256.Sum256(w.Body.Bytes())
+	assert.Equal(t, resp.Checksum, hex.EncodeToString(sum[:]))
+
+	w = performAuthRequest(router, "GET", "/api/v1/admin/exports", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list viewmodels.ListExportResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Exports, 1)
+	assert.Equal(t, resp.ID, list.Exports[0].ID)
+
+	// Exports and downloads are audited
+	entries, err := repos.Audit.List(repository.AuditFilter{Target: "export:" + resp.ID})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, audit.ActionExportDownload, entries[0].Action)
+	assert.Equal(t, audit.ActionExportCreate, entries[1].Action)
+	assert.Equal(t, resp.RequestedBy, entries[1].Actor)
+}
+
+func TestCreateExportInvalid(t *testing.T) {
+	router, _, repos, cleanup := setupExportRouter(t)
+	defer cleanup()
+	token := generateRoleToken(t, router, repos.Users, models.RoleAdmin)
+
+	w := performAuthRequest(router, "POST", "/api/v1/rooms", gin.H{"name": "General"}, token)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	tests := []struct {
+		body gin.H
+		code int
+	}{
+		{gin.H{}, http.StatusBadRequest},
+		{gin.H{"room_ids": []uint{}}, http.StatusBadRequest},
+		{gin.H{"room_ids": []uint{1}, "formats": []string{"eml"}}, http.StatusBadRequest},
+		{gin.H{"room_ids": []uint{1}, "since": "2019-12-20T00:00:00Z", "until": "2019-12-19T00:00:00Z"}, http.StatusBadRequest},
+		{gin.H{"room_ids": []uint{1}, "since": "yesterday"}, http.StatusBadRequest},
+		{gin.H{"room_ids": []uint{2}}, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		w := performAuthRequest(router, "POST", "/api/v1/admin/exports", test.body, token)
+		assert.Equal(t, test.code, w.Code, "%v", test.body)
+	}
+
+	w = performAuthRequest(router, "GET", "/api/v1/admin/exports/unknown", nil, token)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = performAuthRequest(router, "GET", "/api/v1/admin/exports/unknown/download", nil, token)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+	"github.com/hernanrocha/fin-chat/supervisor"
+)
+
+// HealthReporter reports the status of background processes
+type HealthReporter interface {
+	Health() []supervisor.Status
+}
+
+// HealthController ...
+type HealthController struct {
+	reporter HealthReporter
+}
+
+// NewHealthController ...
+func NewHealthController(reporter HealthReporter) *HealthController {
+	return &HealthController{
+		reporter: reporter,
+	}
+}
+
+// Health godoc
+// @Summary Health
+// @Description Status of the background processes (e.g. command response consumers)
+// @Tags Health
+// @Produce  json
+// @Success 200 {object} viewmodels.HealthResponse
+// @Failure 503 {object} viewmodels.HealthResponse
+// @Router /health [get]
+func (c *HealthController) Health(ctx *gin.Context) {
+	response := &viewmodels.HealthResponse{
+		Status:    "ok",
+		Processes: []viewmodels.ProcessStatusView{},
+	}
+
+	if c.reporter != nil {
+		for _, s := range c.reporter.Health() {
+			if !s.Running {
+				response.Status = "degraded"
+			}
+			response.Processes = append(response.Processes, viewmodels.ProcessStatusView{
+				Name:      s.Name,
+				Running:   s.Running,
+				Restarts:  s.Restarts,
+				LastError: s.LastError,
+				Since:     s.Since,
+			})
+		}
+	}
+
+	code := http.StatusOK
+	if response.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	ctx.JSON(code, response)
+}
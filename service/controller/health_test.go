@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+	"github.com/hernanrocha/fin-chat/supervisor"
+)
+
+type fakeHealthReporter []supervisor.Status
+
+func (r fakeHealthReporter) Health() []supervisor.Status {
+	return r
+}
+
+func TestHealth(t *testing.T) {
+	cases := []struct {
+		name     string
+		reporter HealthReporter
+		code     int
+		status   string
+	}{
+		{name: "no processes", code: http.StatusOK, status: "ok"},
+		{name: "running", reporter: fakeHealthReporter{{Name: "consumer", Running: true}}, code: http.StatusOK, status: "ok"},
+		{name: "failed", reporter: fakeHealthReporter{{Name: "consumer", Running: true}, {Name: "other", LastError: "failed"}}, code: http.StatusServiceUnavailable, status: "degraded"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/health", NewHealthController(c.reporter).Health)
+
+			w := performRequest(r, "GET", "/health", nil)
+			assert.Equal(t, c.code, w.Code)
+
+			var resp viewmodels.HealthResponse
+			require.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, c.status, resp.Status)
+		})
+	}
+}
@@ -1,27 +1,35 @@
 package controller
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hernanrocha/fin-chat/service/hub"
 	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
 	"github.com/hernanrocha/fin-chat/service/viewmodels"
-	"github.com/jinzhu/gorm"
 )
 
+// Messages listed per room
+const roomMessagesLimit = 50
+
 // MessageController ...
 type MessageController struct {
-	hub hub.HubInterface
-	db  *gorm.DB
+	hub      hub.HubInterface
+	users    repository.UserRepository
+	rooms    repository.RoomRepository
+	messages repository.MessageRepository
 }
 
 // NewMessageController ...
-func NewMessageController(hub hub.HubInterface) *MessageController {
+func NewMessageController(hub hub.HubInterface, users repository.UserRepository, rooms repository.RoomRepository, messages repository.MessageRepository) *MessageController {
 	return &MessageController{
-		hub: hub,
-		db:  models.GetDB(),
+		hub:      hub,
+		users:    users,
+		rooms:    rooms,
+		messages: messages,
 	}
 }
 
@@ -45,11 +53,26 @@ func (c *MessageController) CreateMessage(ctx *gin.Context) {
 	userView, _ := ctx.Get("username")
 	id := ctx.Params.ByName("id")
 	uid, _ := strconv.Atoi(id)
-	var user models.User
-	if err := c.db.Where("username = ?", userView.(*viewmodels.UserView).Username).Find(&user).Error; err != nil {
+	user, err := c.users.FindByUsername(userView.(*viewmodels.UserView).Username)
+	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// Tokens issued before the user was disabled are still valid
+	if user.Disabled {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "user is disabled"})
+		return
+	}
+
+	room, err := c.rooms.Find(uint(uid))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if room.Archived {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "room is archived"})
+		return
+	}
 
 	message := &models.Message{
 		Text:   json.Text,
@@ -57,7 +80,7 @@ func (c *MessageController) CreateMessage(ctx *gin.Context) {
 		UserID: user.ID,
 	}
 
-	if err := c.db.Create(message).Error; err != nil {
+	if err := c.messages.Create(message); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -90,11 +113,14 @@ func (c *MessageController) CreateMessage(ctx *gin.Context) {
 // @Success 200 {object} viewmodels.ListMessageResponse
 // @Router /api/v1/rooms/{id}/messages [get]
 func (c *MessageController) ListRoomMessages(ctx *gin.Context) {
-	var messages []models.Message
-	id := ctx.Params.ByName("id")
+	id, err := strconv.ParseUint(ctx.Params.ByName("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	db := c.db.Where("room_id = ?", id).Preload("User").Limit(50).Order("created_at desc").Find(&messages)
-	if err := db.Error; err != nil {
+	messages, err := c.messages.ListByRoom(uint(id), roomMessagesLimit)
+	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -107,6 +133,7 @@ func (c *MessageController) ListRoomMessages(ctx *gin.Context) {
 			RoomID:    m.RoomID,
 			Username:  m.User.Username,
 			CreatedAt: m.CreatedAt,
+			Quotes:    json.RawMessage(m.Result),
 		}
 	}
 
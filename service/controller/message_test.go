@@ -12,17 +12,18 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
-	"github.com/hernanrocha/fin-chat/service/viewmodels"
 	"github.com/hernanrocha/fin-chat/service/hub/mocks"
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
 )
 
 func TestMessageListCreateGet(t *testing.T) {
-	require.Nil(t, SetupDatabase())
 
 	mockHub := mocks.NewMockHub()
 	mockHub.On("BroadcastMessage", mock.AnythingOfType("viewmodels.MessageView")).
 		Return().Once()
-	router := SetupRouter(mockHub)
+	router := SetupRouter(Services{JWTKey: testJWTKey, Hub: mockHub, Repositories: repository.NewMemory()})
 
 	token := generateToken(t, router)
 
@@ -73,8 +74,7 @@ func TestMessageListCreateGet(t *testing.T) {
 }
 
 func TestMessageUnauthorized(t *testing.T) {
-	require.Nil(t, SetupDatabase())
-	router := SetupRouter(nil)
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repository.NewMemory()})
 
 	w := performRequest(router, "POST", "/api/v1/rooms/1/messages", nil)
 	assertUnauthorized(t, w)
@@ -82,3 +82,56 @@ func TestMessageUnauthorized(t *testing.T) {
 	w = performRequest(router, "GET", "/api/v1/rooms/1/messages", nil)
 	assertUnauthorized(t, w)
 }
+
+func TestCreateMessageForbidden(t *testing.T) {
+	repos := repository.NewMemory()
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repos})
+	token := generateToken(t, router)
+
+	room := models.Room{Name: "General", Archived: true}
+	require.NoError(t, repos.Rooms.Create(&room))
+	path := fmt.Sprintf("/api/v1/rooms/%d/messages", room.ID)
+
+	// Archived rooms are read only
+	w := performAuthRequest(router, "POST", path, gin.H{"text": "Hi"}, token)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Users disabled after logging in cannot post
+	room.Archived = false
+	require.NoError(t, repos.Rooms.Update(&room))
+	users, err := repos.Users.List()
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	users[0].Disabled = true
+	require.NoError(t, repos.Users.Update(&users[0]))
+
+	w = performAuthRequest(router, "POST", path, gin.H{"text": "Hi"}, token)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestListBotResults(t *testing.T) {
+	repos := repository.NewMemory()
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repos})
+	token := generateToken(t, router)
+
+	bot := models.User{Username: "Bot", Email: "bot@mail.com", Bot: true, Role: models.RoleBot}
+	require.NoError(t, repos.Users.Create(&bot))
+	room := models.Room{Name: "General"}
+	require.NoError(t, repos.Rooms.Create(&room))
+	quotes := `[{"symbol":"AAPL.US","close":279.74}]`
+	require.NoError(t, repos.Messages.Create(&models.Message{Text: "AAPL.US quote is $279.74 per share", UserID: bot.ID, RoomID: room.ID, Result: quotes}))
+	require.NoError(t, repos.Messages.Create(&models.Message{Text: "Thanks", UserID: bot.ID, RoomID: room.ID}))
+
+	// The structured results of bots are listed with their messages
+	w := performAuthRequest(router, "GET", "/api/v1/rooms/1/messages", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp viewmodels.ListMessageResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Messages, 2)
+	results := map[string]string{}
+	for _, m := range resp.Messages {
+		results[m.Text] = string(m.Quotes)
+	}
+	assert.JSONEq(t, quotes, results["AAPL.US quote is $279.74 per share"])
+	assert.Empty(t, results["Thanks"])
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+// currentUser returns the user of the JWT of a request, nil if there is none
+func currentUser(ctx *gin.Context) *viewmodels.UserView {
+	if user, ok := ctx.Get("username"); ok {
+		if v, ok := user.(*viewmodels.UserView); ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// RequirePermission returns a middleware rejecting the requests of users
+// whose role does not grant a permission, with 403. It runs after the JWT
+// middleware.
+func RequirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user := currentUser(ctx)
+		if user == nil || !models.HasPermission(user.Role, permission) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": fmt.Sprintf("%s permission required", permission),
+			})
+			return
+		}
+		ctx.Next()
+	}
+}
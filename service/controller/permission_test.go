@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+)
+
+func TestRequirePermission(t *testing.T) {
+	repos := repository.NewMemory()
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repos})
+
+	tests := []struct {
+		role   string
+		method string
+		path   string
+		code   int
+	}{
+		{models.RoleUser, "GET", "/api/v1/admin/audit", http.StatusForbidden},
+		{models.RoleUser, "GET", "/api/v1/admin/users", http.StatusForbidden},
+		{models.RoleBot, "GET", "/api/v1/admin/users", http.StatusForbidden},
+		{models.RoleModerator, "GET", "/api/v1/admin/audit", http.StatusForbidden},
+		{models.RoleAdmin, "GET", "/api/v1/admin/audit", http.StatusOK},
+		{models.RoleBot, "GET", "/api/v1/rooms", http.StatusOK},
+	}
+	for _, test := range tests {
+		token := generateRoleToken(t, router, repos.Users, test.role)
+		w := performAuthRequest(router, test.method, test.path, nil, token)
+		assert.Equal(t, test.code, w.Code, "%s %s %s", test.role, test.method, test.path)
+	}
+
+	token := generateToken(t, router)
+	w := performAuthRequest(router, "GET", "/api/v1/admin/users", nil, token)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	var resp gin.H
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "admin permission required", resp["error"])
+}
+
+func TestRoleClaim(t *testing.T) {
+	repos := repository.NewMemory()
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repos})
+	token := generateRoleToken(t, router, repos.Users, models.RoleAdmin)
+
+	w := performAuthRequest(router, "GET", "/api/v1/admin/users", nil, token)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The role of the claims is the one at login, the stored role applies
+	users, _ := repos.Users.List()
+	user := users[0]
+	user.Role = models.RoleUser
+	require.NoError(t, repos.Users.Update(&user))
+
+	w = performAuthRequest(router, "GET", "/api/v1/admin/users", nil, token)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Disabled users are rejected before their tokens expire
+	user.Role = models.RoleAdmin
+	user.Disabled = true
+	require.NoError(t, repos.Users.Update(&user))
+
+	w = performAuthRequest(router, "GET", "/api/v1/rooms", nil, token)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestTokenKey(t *testing.T) {
+	repos := repository.NewMemory()
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repos})
+	token := generateToken(t, router)
+
+	// Tokens signed by another key are rejected
+	other := SetupRouter(Services{JWTKey: []byte("other key"), Repositories: repos})
+	w := performAuthRequest(other, "GET", "/api/v1/rooms", nil, token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
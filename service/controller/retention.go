@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hernanrocha/fin-chat/service/audit"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/retention"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+// RetentionController ...
+type RetentionController struct {
+	purger   *retention.Purger
+	rooms    repository.RoomRepository
+	auditLog *audit.Logger
+}
+
+// NewRetentionController ...
+func NewRetentionController(purger *retention.Purger, rooms repository.RoomRepository, auditLog *audit.Logger) *RetentionController {
+	return &RetentionController{
+		purger:   purger,
+		rooms:    rooms,
+		auditLog: auditLog,
+	}
+}
+
+// RetentionReport godoc
+// @Summary Retention Report
+// @Description Report the messages expired by the retention policies, without purging them
+// @Tags Admin
+// @Param Authorization header string true "JWT Token"
+// @Produce  json
+// @Success 200 {object} viewmodels.RetentionReportResponse
+// @Router /api/v1/admin/retention [get]
+func (c *RetentionController) RetentionReport(ctx *gin.Context) {
+	c.purge(ctx, true)
+}
+
+// PurgeMessages godoc
+// @Summary Purge Messages
+// @Description Purge the messages expired by the retention policies now
+// @Tags Admin
+// @Param Authorization header string true "JWT Token"
+// @Produce  json
+// @Success 200 {object} viewmodels.RetentionReportResponse
+// @Router /api/v1/admin/retention/purge [post]
+func (c *RetentionController) PurgeMessages(ctx *gin.Context) {
+	c.purge(ctx, false)
+}
+
+func (c *RetentionController) purge(ctx *gin.Context, dryRun bool) {
+	report, err := c.purger.Purge(dryRun)
+	if !dryRun {
+		// Partial purges are recorded too
+		recordAudit(c.auditLog, ctx, currentUsername(ctx), audit.ActionRetentionPurge, "",
+			gin.H{"purged": report.Total, "archive": report.Archive})
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "total": report.Total})
+		return
+	}
+
+	roomList := make([]viewmodels.RoomRetentionReportView, len(report.Rooms))
+	for i, r := range report.Rooms {
+		roomList[i] = viewmodels.RoomRetentionReportView{
+			RoomID: r.RoomID,
+			Name:   r.Name,
+			Policy: viewmodels.RetentionPolicyView{
+				Days:     r.Policy.Days,
+				Messages: r.Policy.Messages,
+			},
+			LegalHold: r.LegalHold,
+			Expired:   r.Expired,
+		}
+	}
+
+	response := &viewmodels.RetentionReportResponse{
+		DryRun:  report.DryRun,
+		Archive: report.Archive,
+		Rooms:   roomList,
+		Total:   report.Total,
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// UpdateRoomRetention godoc
+// @Summary Update Room Retention
+// @Description Override the global retention policy for a room, or put it on legal hold
+// @Tags Admin
+// @Param Authorization header string true "JWT Token"
+// @Param id path int true "Room ID"
+// @Param retention body viewmodels.UpdateRoomRetentionRequest true "Retention Settings"
+// @Produce  json
+// @Success 200 {object} viewmodels.RoomRetentionResponse
+// @Router /api/v1/admin/rooms/{id}/retention [put]
+func (c *RetentionController) UpdateRoomRetention(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Params.ByName("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var json viewmodels.UpdateRoomRetentionRequest
+	if err := ctx.ShouldBindJSON(&json); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (json.Days != nil && *json.Days < 0) || (json.Messages != nil && *json.Messages < 0) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "days and messages cannot be negative"})
+		return
+	}
+
+	err = c.rooms.UpdateRetention(uint(id), json.Days, json.Messages, json.LegalHold)
+	if err == repository.ErrNotFound {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAudit(c.auditLog, ctx, currentUsername(ctx), audit.ActionRoomRetention, roomTarget(uint(id)), json)
+
+	response := &viewmodels.RoomRetentionResponse{
+		RoomID:    uint(id),
+		Days:      json.Days,
+		Messages:  json.Messages,
+		LegalHold: json.LegalHold,
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
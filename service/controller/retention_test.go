@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/audit"
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/retention"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+func setupRetentionRouter(t *testing.T, global retention.Policy) (*gin.Engine, repository.Repositories) {
+	repos := repository.NewMemory()
+	user := models.User{Username: "jdoe", Email: "jdoe@mail.com"}
+	require.NoError(t, repos.Users.Create(&user))
+	room := models.Room{Name: "General"}
+	require.NoError(t, repos.Rooms.Create(&room))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, repos.Messages.Create(&models.Message{Text: "Hi", UserID: user.ID, RoomID: room.ID}))
+	}
+
+	purger := retention.NewPurger(repos.Rooms, repos.Messages, retention.Config{Global: global})
+	c := NewRetentionController(purger, repos.Rooms, audit.NewLogger(repos.Audit))
+	r := gin.New()
+	r.GET("/retention", c.RetentionReport)
+	r.POST("/retention/purge", c.PurgeMessages)
+	r.PUT("/rooms/:id/retention", c.UpdateRoomRetention)
+	return r, repos
+}
+
+func TestRetentionReportAndPurge(t *testing.T) {
+	router, repos := setupRetentionRouter(t, retention.Policy{Messages: 1})
+
+	w := performRequest(router, "GET", "/retention", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp viewmodels.RetentionReportResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, viewmodels.RetentionReportResponse{
+		DryRun: true,
+		Rooms: []viewmodels.RoomRetentionReportView{
+			{RoomID: 1, Name: "General", Policy: viewmodels.RetentionPolicyView{Messages: 1}, Expired: 2},
+		},
+		Total: 2,
+	}, resp)
+
+	// The report does not purge
+	messages, err := repos.Messages.ListByRoom(1, 10)
+	require.NoError(t, err)
+	assert.Len(t, messages, 3)
+
+	w = performRequest(router, "POST", "/retention/purge", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.DryRun)
+	assert.Equal(t, 2, resp.Total)
+
+	messages, err = repos.Messages.ListByRoom(1, 10)
+	require.NoError(t, err)
+	assert.Len(t, messages, 1)
+
+	// Only the purge is audited
+	entries, err := repos.Audit.List(repository.AuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, audit.ActionRetentionPurge, entries[0].Action)
+	assert.JSONEq(t, `{"purged":2,"archive":false}`, entries[0].Details)
+}
+
+func TestUpdateRoomRetention(t *testing.T) {
+	router, repos := setupRetentionRouter(t, retention.Policy{Messages: 1})
+
+	w := performRequest(router, "PUT", "/rooms/1/retention", gin.H{"days": 30, "legal_hold": true})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"room_id":1,"days":30,"messages":null,"legal_hold":true}`, w.Body.String())
+
+	room, err := repos.Rooms.Find(1)
+	require.NoError(t, err)
+	assert.Equal(t, 30, *room.RetentionDays)
+	assert.True(t, room.LegalHold)
+
+	entry, err := repos.Audit.Last()
+	require.NoError(t, err)
+	assert.Equal(t, audit.ActionRoomRetention, entry.Action)
+	assert.Equal(t, "room:1", entry.Target)
+	assert.JSONEq(t, `{"days":30,"messages":null,"legal_hold":true}`, entry.Details)
+
+	// Rooms on legal hold are not purged
+	w = performRequest(router, "POST", "/retention/purge", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":0`)
+}
+
+func TestUpdateRoomRetentionInvalid(t *testing.T) {
+	router, _ := setupRetentionRouter(t, retention.Policy{})
+
+	tests := []struct {
+		path string
+		body gin.H
+		code int
+	}{
+		{"/rooms/abc/retention", gin.H{}, http.StatusBadRequest},
+		{"/rooms/1/retention", gin.H{"days": -1}, http.StatusBadRequest},
+		{"/rooms/1/retention", gin.H{"messages": "all"}, http.StatusBadRequest},
+		{"/rooms/2/retention", gin.H{"days": 1}, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		w := performRequest(router, "PUT", test.path, test.body)
+		assert.Equal(t, test.code, w.Code, "%s %v", test.path, test.body)
+	}
+}
@@ -1,27 +1,37 @@
 package controller
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jinzhu/gorm"
 
+	"github.com/hernanrocha/fin-chat/service/audit"
 	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
 	"github.com/hernanrocha/fin-chat/service/viewmodels"
 )
 
 // RoomController ...
 type RoomController struct {
-	db *gorm.DB
+	rooms    repository.RoomRepository
+	auditLog *audit.Logger
 }
 
 // NewRoomController ...
-func NewRoomController() *RoomController {
+func NewRoomController(rooms repository.RoomRepository, auditLog *audit.Logger) *RoomController {
 	return &RoomController{
-		db: models.GetDB(),
+		rooms:    rooms,
+		auditLog: auditLog,
 	}
 }
 
+// roomTarget is the audit log target of a room
+func roomTarget(id uint) string {
+	return fmt.Sprintf("room:%d", id)
+}
+
 // ListRooms godoc
 // @Summary List Rooms
 // @Description List Rooms in database
@@ -31,8 +41,8 @@ func NewRoomController() *RoomController {
 // @Success 200 {object} viewmodels.ListRoomResponse
 // @Router /api/v1/rooms [get]
 func (c *RoomController) ListRooms(ctx *gin.Context) {
-	var rooms []models.Room
-	if err := c.db.Find(&rooms).Error; err != nil {
+	rooms, err := c.rooms.List()
+	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -40,8 +50,9 @@ func (c *RoomController) ListRooms(ctx *gin.Context) {
 	roomList := make([]viewmodels.RoomView, len(rooms))
 	for i, r := range rooms {
 		roomList[i] = viewmodels.RoomView{
-			ID:   r.ID,
-			Name: r.Name,
+			ID:       r.ID,
+			Name:     r.Name,
+			Archived: r.Archived,
 		}
 	}
 
@@ -72,11 +83,13 @@ func (c *RoomController) CreateRoom(ctx *gin.Context) {
 		Name: json.Name,
 	}
 
-	if err := c.db.Create(room).Error; err != nil {
+	if err := c.rooms.Create(room); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	recordAudit(c.auditLog, ctx, currentUsername(ctx), audit.ActionRoomCreate, roomTarget(room.ID), gin.H{"name": room.Name})
+
 	response := &viewmodels.CreateRoomResponse{
 		viewmodels.RoomView{
 			ID:   room.ID,
@@ -97,20 +110,135 @@ func (c *RoomController) CreateRoom(ctx *gin.Context) {
 // @Success 200 {object} viewmodels.GetRoomResponse
 // @Router /api/v1/rooms/{id} [get]
 func (c *RoomController) GetRoom(ctx *gin.Context) {
-	id := ctx.Params.ByName("id")
-	var room models.Room
+	id, err := strconv.ParseUint(ctx.Params.ByName("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	if err := c.db.Where("id = ?", id).Find(&room).Error; err != nil {
+	room, err := c.rooms.Find(uint(id))
+	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	response := &viewmodels.GetRoomResponse{
 		viewmodels.RoomView{
-			ID:   room.ID,
-			Name: room.Name,
+			ID:       room.ID,
+			Name:     room.Name,
+			Archived: room.Archived,
 		},
 	}
 
 	ctx.JSON(http.StatusOK, response)
 }
+
+// ArchiveRoom godoc
+// @Summary Archive Room
+// @Description Make a room read only
+// @Tags Rooms
+// @Param Authorization header string true "JWT Token"
+// @Param id path int true "Room ID"
+// @Produce  json
+// @Success 200 {object} viewmodels.GetRoomResponse
+// @Router /api/v1/rooms/{id}/archive [post]
+func (c *RoomController) ArchiveRoom(ctx *gin.Context) {
+	c.setArchived(ctx, true)
+}
+
+// UnarchiveRoom godoc
+// @Summary Unarchive Room
+// @Description Allow posting to an archived room again
+// @Tags Rooms
+// @Param Authorization header string true "JWT Token"
+// @Param id path int true "Room ID"
+// @Produce  json
+// @Success 200 {object} viewmodels.GetRoomResponse
+// @Router /api/v1/rooms/{id}/archive [delete]
+func (c *RoomController) UnarchiveRoom(ctx *gin.Context) {
+	c.setArchived(ctx, false)
+}
+
+func (c *RoomController) setArchived(ctx *gin.Context, archived bool) {
+	id, err := strconv.ParseUint(ctx.Params.ByName("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	room, err := c.rooms.Find(uint(id))
+	if err == repository.ErrNotFound {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	room.Archived = archived
+	if err := c.rooms.Update(&room); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	action := audit.ActionRoomUnarchive
+	if archived {
+		action = audit.ActionRoomArchive
+	}
+	recordAudit(c.auditLog, ctx, currentUsername(ctx), action, roomTarget(room.ID), nil)
+
+	response := &viewmodels.GetRoomResponse{
+		viewmodels.RoomView{
+			ID:       room.ID,
+			Name:     room.Name,
+			Archived: room.Archived,
+		},
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// DeleteRoom godoc
+// @Summary Delete Room
+// @Description Soft delete a room, keeping its messages in the database. Rooms on legal hold cannot be deleted.
+// @Tags Admin
+// @Param Authorization header string true "JWT Token"
+// @Param id path int true "Room ID"
+// @Success 204
+// @Router /api/v1/admin/rooms/{id} [delete]
+func (c *RoomController) DeleteRoom(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Params.ByName("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	room, err := c.rooms.Find(uint(id))
+	if err == repository.ErrNotFound {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if room.LegalHold {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "room is on legal hold"})
+		return
+	}
+
+	err = c.rooms.Delete(room.ID)
+	if err == repository.ErrNotFound {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAudit(c.auditLog, ctx, currentUsername(ctx), audit.ActionRoomDelete, roomTarget(uint(id)), nil)
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -8,14 +8,16 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hernanrocha/fin-chat/service/audit"
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
 	"github.com/hernanrocha/fin-chat/service/viewmodels"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestRoomListCreateGet(t *testing.T) {
-	require.Nil(t, SetupDatabase())
-	router := SetupRouter(nil)
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repository.NewMemory()})
 
 	token := generateToken(t, router)
 
@@ -61,8 +63,7 @@ func TestRoomListCreateGet(t *testing.T) {
 }
 
 func TestRoomsUnauthorized(t *testing.T) {
-	require.Nil(t, SetupDatabase())
-	router := SetupRouter(nil)
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repository.NewMemory()})
 
 	w := performRequest(router, "GET", "/api/v1/rooms", nil)
 	assertUnauthorized(t, w)
@@ -75,8 +76,7 @@ func TestRoomsUnauthorized(t *testing.T) {
 }
 
 func TestGetRoomNotExist(t *testing.T) {
-	require.Nil(t, SetupDatabase())
-	router := SetupRouter(nil)
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repository.NewMemory()})
 
 	token := generateToken(t, router)
 
@@ -85,8 +85,7 @@ func TestGetRoomNotExist(t *testing.T) {
 }
 
 func TestCreateRoomInvalidRequest(t *testing.T) {
-	require.Nil(t, SetupDatabase())
-	router := SetupRouter(nil)
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repository.NewMemory()})
 
 	token := generateToken(t, router)
 
@@ -95,3 +94,72 @@ func TestCreateRoomInvalidRequest(t *testing.T) {
 	w := performAuthRequest(router, "POST", "/api/v1/rooms", req, token)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
+
+func TestArchiveRoom(t *testing.T) {
+	repos := repository.NewMemory()
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repos})
+	require.NoError(t, repos.Rooms.Create(&models.Room{Name: "General"}))
+
+	// Users cannot moderate rooms
+	token := generateToken(t, router)
+	w := performAuthRequest(router, "POST", "/api/v1/rooms/1/archive", nil, token)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	token = generateRoleToken(t, router, repos.Users, models.RoleModerator)
+	w = performAuthRequest(router, "POST", "/api/v1/rooms/1/archive", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp viewmodels.GetRoomResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Archived)
+
+	w = performAuthRequest(router, "DELETE", "/api/v1/rooms/1/archive", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	room, _ := repos.Rooms.Find(1)
+	assert.False(t, room.Archived)
+
+	w = performAuthRequest(router, "POST", "/api/v1/rooms/2/archive", nil, token)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	entries, err := repos.Audit.List(repository.AuditFilter{Target: "room:1"})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, audit.ActionRoomUnarchive, entries[0].Action)
+	assert.Equal(t, audit.ActionRoomArchive, entries[1].Action)
+}
+
+func TestDeleteRoom(t *testing.T) {
+	repos := repository.NewMemory()
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repos})
+	require.NoError(t, repos.Rooms.Create(&models.Room{Name: "General"}))
+
+	// Only admins can delete rooms
+	token := generateRoleToken(t, router, repos.Users, models.RoleModerator)
+	w := performAuthRequest(router, "DELETE", "/api/v1/admin/rooms/1", nil, token)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	token = generateRoleToken(t, router, repos.Users, models.RoleAdmin)
+	w = performAuthRequest(router, "DELETE", "/api/v1/admin/rooms/1", nil, token)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	w = performAuthRequest(router, "GET", "/api/v1/rooms", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp viewmodels.ListRoomResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Empty(t, resp.Rooms)
+
+	w = performAuthRequest(router, "DELETE", "/api/v1/admin/rooms/1", nil, token)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Rooms on legal hold are kept
+	require.NoError(t, repos.Rooms.Create(&models.Room{Name: "Legal"}))
+	require.NoError(t, repos.Rooms.UpdateRetention(2, nil, nil, true))
+	w = performAuthRequest(router, "DELETE", "/api/v1/admin/rooms/2", nil, token)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	_, err := repos.Rooms.Find(2)
+	assert.NoError(t, err)
+
+	entries, err := repos.Audit.List(repository.AuditFilter{Action: audit.ActionRoomDelete})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "room:1", entries[0].Target)
+}
@@ -6,16 +6,47 @@ import (
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/swaggo/gin-swagger/swaggerFiles"
 
+	"github.com/hernanrocha/fin-chat/messenger"
+	"github.com/hernanrocha/fin-chat/service/audit"
+	"github.com/hernanrocha/fin-chat/service/export"
 	"github.com/hernanrocha/fin-chat/service/hub"
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/retention"
 )
 
-func SetupRouter(hub hub.HubInterface) *gin.Engine {
+// Services used by the controllers
+type Services struct {
+	Hub          hub.HubInterface
+	Repositories repository.Repositories
+	// Key signing the JWTs, required
+	JWTKey []byte
+	// Optional, admin dead-letter endpoints are only registered when the
+	// messenger backend has a dead-letter queue
+	DeadLetters messenger.DeadLetterQueue
+	// Optional, status of background processes reported on /health
+	Health HealthReporter
+	// Optional, admin retention endpoints are only registered with a purger
+	Retention *retention.Purger
+	// Optional, admin export endpoints are only registered with an exporter
+	Exports *export.Exporter
+	// Optional, the admin session endpoint is only registered with a lister
+	Sessions SessionLister
+}
+
+// SetupRouter ...
+func SetupRouter(services Services) *gin.Engine {
+	auditLog := audit.NewLogger(services.Repositories.Audit)
+
 	// Controllers
-	c := NewRoomController()
-	m := NewMessageController(hub)
-	ws := NewWebSocketController(hub)
-	auth := NewAuthController()
-	authMiddleware, _ := auth.JWTMiddleware()
+	c := NewRoomController(services.Repositories.Rooms, auditLog)
+	m := NewMessageController(services.Hub, services.Repositories.Users, services.Repositories.Rooms, services.Repositories.Messages)
+	ws := NewWebSocketController(services.Hub)
+	health := NewHealthController(services.Health)
+	auth := NewAuthController(services.Repositories.Users, auditLog)
+	al := NewAuditController(auditLog)
+	uc := NewUserController(services.Repositories.Users, auditLog)
+	authMiddleware, _ := auth.JWTMiddleware(services.JWTKey)
 
 	// Default Engine
 	r := gin.Default()
@@ -34,6 +65,9 @@ func SetupRouter(hub hub.HubInterface) *gin.Engine {
 		})
 	})
 
+	// Health
+	r.GET("/health", health.Health)
+
 	// Auth JWT
 	r.POST("/login", authMiddleware.LoginHandler)
 	r.POST("/register", auth.Register)
@@ -46,12 +80,46 @@ func SetupRouter(hub hub.HubInterface) *gin.Engine {
 		// Refresh time can be longer than token timeout
 		// auth.GET("/refresh_token", authMiddleware.RefreshHandler)
 
-		v1.POST("/rooms", c.CreateRoom)
+		v1.POST("/rooms", RequirePermission(models.PermissionPost), c.CreateRoom)
 		v1.GET("/rooms", c.ListRooms)
 		v1.GET("/rooms/:id", c.GetRoom)
+		v1.POST("/rooms/:id/archive", RequirePermission(models.PermissionModerate), c.ArchiveRoom)
+		v1.DELETE("/rooms/:id/archive", RequirePermission(models.PermissionModerate), c.UnarchiveRoom)
 
 		v1.GET("/rooms/:id/messages", m.ListRoomMessages)
-		v1.POST("/rooms/:id/messages", m.CreateMessage)
+		v1.POST("/rooms/:id/messages", RequirePermission(models.PermissionPost), m.CreateMessage)
+
+		// Admin endpoints, only for the users with the admin role
+		admin := v1.Group("/admin")
+		admin.Use(RequirePermission(models.PermissionAdmin))
+		admin.GET("/users", uc.ListUsers)
+		admin.PUT("/users/:username/role", uc.UpdateUserRole)
+		admin.PUT("/users/:username/disabled", uc.UpdateUserDisabled)
+		admin.DELETE("/rooms/:id", c.DeleteRoom)
+		admin.GET("/audit", al.ListAuditLog)
+		admin.GET("/audit/verify", al.VerifyAuditLog)
+		if services.DeadLetters != nil {
+			dl := NewDeadLetterController(services.DeadLetters)
+			admin.GET("/dead-letters", dl.ListDeadLetters)
+			admin.POST("/dead-letters/redrive", dl.RedriveDeadLetters)
+		}
+		if services.Retention != nil {
+			rc := NewRetentionController(services.Retention, services.Repositories.Rooms, auditLog)
+			admin.GET("/retention", rc.RetentionReport)
+			admin.POST("/retention/purge", rc.PurgeMessages)
+			admin.PUT("/rooms/:id/retention", rc.UpdateRoomRetention)
+		}
+		if services.Exports != nil {
+			ec := NewExportController(services.Exports, auditLog)
+			admin.POST("/exports", ec.CreateExport)
+			admin.GET("/exports", ec.ListExports)
+			admin.GET("/exports/:id", ec.GetExport)
+			admin.GET("/exports/:id/download", ec.DownloadExport)
+		}
+		if services.Sessions != nil {
+			sc := NewSessionController(services.Sessions)
+			admin.GET("/sessions", sc.ListSessions)
+		}
 	}
 
 	// WebSocket
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hernanrocha/fin-chat/service/hub"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+// SessionLister lists the WebSocket sessions connected to the instance
+type SessionLister interface {
+	Sessions() []hub.Session
+}
+
+// SessionController ...
+type SessionController struct {
+	lister SessionLister
+}
+
+// NewSessionController ...
+func NewSessionController(lister SessionLister) *SessionController {
+	return &SessionController{
+		lister: lister,
+	}
+}
+
+// ListSessions godoc
+// @Summary List Sessions
+// @Description List the WebSocket sessions connected to the instance serving the request, oldest first
+// @Tags Admin
+// @Param Authorization header string true "JWT Token"
+// @Produce  json
+// @Success 200 {object} viewmodels.ListSessionResponse
+// @Router /api/v1/admin/sessions [get]
+func (c *SessionController) ListSessions(ctx *gin.Context) {
+	sessions := c.lister.Sessions()
+
+	sessionList := make([]viewmodels.SessionView, len(sessions))
+	for i, s := range sessions {
+		sessionList[i] = viewmodels.SessionView{
+			ID:          s.ID,
+			UserAgent:   s.UserAgent,
+			ConnectedAt: s.ConnectedAt,
+		}
+	}
+
+	response := &viewmodels.ListSessionResponse{
+		Sessions: sessionList,
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/hub"
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+type fakeSessionLister []hub.Session
+
+func (l fakeSessionLister) Sessions() []hub.Session {
+	return l
+}
+
+func TestListSessions(t *testing.T) {
+	connectedAt := time.Date(2019, 12, 20, 12, 0, 0, 0, time.UTC)
+	repos := repository.NewMemory()
+	router := SetupRouter(Services{
+		Repositories: repos,
+		JWTKey:       testJWTKey,
+		Sessions: fakeSessionLister{
+			{ID: "10.0.0.1:52000", UserAgent: "Firefox", ConnectedAt: connectedAt},
+		},
+	})
+	token := generateRoleToken(t, router, repos.Users, models.RoleAdmin)
+
+	w := performAuthRequest(router, "GET", "/api/v1/admin/sessions", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp viewmodels.ListSessionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Sessions, 1)
+	assert.Equal(t, "10.0.0.1:52000", resp.Sessions[0].ID)
+	assert.Equal(t, "Firefox", resp.Sessions[0].UserAgent)
+	assert.True(t, connectedAt.Equal(resp.Sessions[0].ConnectedAt))
+
+	// Not registered without a lister
+	repos = repository.NewMemory()
+	router = SetupRouter(Services{JWTKey: testJWTKey, Repositories: repos})
+	token = generateRoleToken(t, router, repos.Users, models.RoleAdmin)
+	w = performAuthRequest(router, "GET", "/api/v1/admin/sessions", nil, token)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hernanrocha/fin-chat/service/audit"
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+// UserController ...
+type UserController struct {
+	users    repository.UserRepository
+	auditLog *audit.Logger
+}
+
+// NewUserController ...
+func NewUserController(users repository.UserRepository, auditLog *audit.Logger) *UserController {
+	return &UserController{
+		users:    users,
+		auditLog: auditLog,
+	}
+}
+
+func adminUserView(user models.User) viewmodels.AdminUserView {
+	return viewmodels.AdminUserView{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Role:      user.Role,
+		Bot:       user.Bot,
+		Disabled:  user.Disabled,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+// ListUsers godoc
+// @Summary List Users
+// @Description List every user, with its role and whether it is disabled
+// @Tags Admin
+// @Param Authorization header string true "JWT Token"
+// @Produce  json
+// @Success 200 {object} viewmodels.ListUserResponse
+// @Router /api/v1/admin/users [get]
+func (c *UserController) ListUsers(ctx *gin.Context) {
+	users, err := c.users.List()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	userList := make([]viewmodels.AdminUserView, len(users))
+	for i, u := range users {
+		userList[i] = adminUserView(u)
+	}
+
+	response := &viewmodels.ListUserResponse{
+		Users: userList,
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// UpdateUserRole godoc
+// @Summary Update User Role
+// @Description Grant a role to a user, effective on its next request. Admins cannot change their own role, and only bot users have the bot role.
+// @Tags Admin
+// @Param Authorization header string true "JWT Token"
+// @Param username path string true "Username"
+// @Param role body viewmodels.UpdateUserRoleRequest true "Role"
+// @Produce  json
+// @Success 200 {object} viewmodels.UpdateUserResponse
+// @Router /api/v1/admin/users/{username}/role [put]
+func (c *UserController) UpdateUserRole(ctx *gin.Context) {
+	var json viewmodels.UpdateUserRoleRequest
+	if err := ctx.ShouldBindJSON(&json); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.ValidRole(json.Role) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
+		return
+	}
+
+	c.updateUser(ctx, func(user *models.User) (string, interface{}, error) {
+		previous := user.Role
+		if err := user.GrantRole(json.Role); err != nil {
+			return "", nil, err
+		}
+		return audit.ActionUserGrant, gin.H{"role": json.Role, "previous": previous}, nil
+	})
+}
+
+// UpdateUserDisabled godoc
+// @Summary Disable or Enable User
+// @Description Disabled users cannot log in or use the API. Admins cannot disable themselves.
+// @Tags Admin
+// @Param Authorization header string true "JWT Token"
+// @Param username path string true "Username"
+// @Param disabled body viewmodels.UpdateUserDisabledRequest true "Disabled"
+// @Produce  json
+// @Success 200 {object} viewmodels.UpdateUserResponse
+// @Router /api/v1/admin/users/{username}/disabled [put]
+func (c *UserController) UpdateUserDisabled(ctx *gin.Context) {
+	var json viewmodels.UpdateUserDisabledRequest
+	if err := ctx.ShouldBindJSON(&json); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.updateUser(ctx, func(user *models.User) (string, interface{}, error) {
+		user.Disabled = *json.Disabled
+		if user.Disabled {
+			return audit.ActionUserDisable, nil, nil
+		}
+		return audit.ActionUserEnable, nil, nil
+	})
+}
+
+// updateUser applies a change to the user of the request path, other than
+// the admin making it, and records it with the returned action and details.
+// Changes returning an error are rejected with a 409.
+func (c *UserController) updateUser(ctx *gin.Context, change func(user *models.User) (string, interface{}, error)) {
+	username := ctx.Params.ByName("username")
+	// Admins would lock themselves out
+	if username == currentUsername(ctx) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "admins cannot change themselves"})
+		return
+	}
+
+	user, err := c.users.FindByUsername(username)
+	if err == repository.ErrNotFound {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	action, details, err := change(&user)
+	if err != nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.users.Update(&user); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAudit(c.auditLog, ctx, currentUsername(ctx), action, "user:"+user.Username, details)
+
+	response := &viewmodels.UpdateUserResponse{
+		AdminUserView: adminUserView(user),
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/audit"
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+func TestAdminUsers(t *testing.T) {
+	repos := repository.NewMemory()
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repos})
+	require.NoError(t, repos.Users.Create(&models.User{Username: "jdoe", Email: "jdoe@mail.com", Password: "password"}))
+	token := generateRoleToken(t, router, repos.Users, models.RoleAdmin)
+
+	w := performAuthRequest(router, "GET", "/api/v1/admin/users", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list viewmodels.ListUserResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Users, 2)
+	assert.Equal(t, "jdoe", list.Users[0].Username)
+	assert.Equal(t, models.RoleUser, list.Users[0].Role)
+	assert.Equal(t, models.RoleAdmin, list.Users[1].Role)
+
+	w = performAuthRequest(router, "PUT", "/api/v1/admin/users/jdoe/role", gin.H{"role": "moderator"}, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp viewmodels.UpdateUserResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, models.RoleModerator, resp.Role)
+
+	w = performAuthRequest(router, "PUT", "/api/v1/admin/users/jdoe/disabled", gin.H{"disabled": true}, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	user, _ := repos.Users.FindByUsername("jdoe")
+	assert.True(t, user.Disabled)
+	assert.Equal(t, models.RoleModerator, user.Role)
+
+	entries, err := repos.Audit.List(repository.AuditFilter{Target: "user:jdoe"})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, audit.ActionUserDisable, entries[0].Action)
+	assert.Equal(t, audit.ActionUserGrant, entries[1].Action)
+	assert.Equal(t, `{"previous":"user","role":"moderator"}`, entries[1].Details)
+}
+
+func TestAdminUsersInvalid(t *testing.T) {
+	repos := repository.NewMemory()
+	router := SetupRouter(Services{JWTKey: testJWTKey, Repositories: repos})
+	require.NoError(t, repos.Users.Create(&models.User{Username: "jdoe", Email: "jdoe@mail.com"}))
+	token := generateRoleToken(t, router, repos.Users, models.RoleAdmin)
+	users, _ := repos.Users.List()
+	admin := users[1].Username
+	bot := models.NewBotUser("Bot")
+	require.NoError(t, repos.Users.Create(&bot))
+
+	tests := []struct {
+		path string
+		body gin.H
+		code int
+	}{
+		{"/api/v1/admin/users/jdoe/role", gin.H{}, http.StatusBadRequest},
+		{"/api/v1/admin/users/jdoe/role", gin.H{"role": "owner"}, http.StatusBadRequest},
+		{"/api/v1/admin/users/jdoe/disabled", gin.H{}, http.StatusBadRequest},
+		{"/api/v1/admin/users/jane/role", gin.H{"role": "admin"}, http.StatusNotFound},
+		{"/api/v1/admin/users/" + admin + "/role", gin.H{"role": "user"}, http.StatusConflict},
+		{"/api/v1/admin/users/" + admin + "/disabled", gin.H{"disabled": true}, http.StatusConflict},
+		// Only bots have the bot role
+		{"/api/v1/admin/users/jdoe/role", gin.H{"role": "bot"}, http.StatusConflict},
+		{"/api/v1/admin/users/Bot/role", gin.H{"role": "admin"}, http.StatusConflict},
+	}
+	for _, test := range tests {
+		w := performAuthRequest(router, "PUT", test.path, test.body, token)
+		assert.Equal(t, test.code, w.Code, "%s %v", test.path, test.body)
+	}
+}
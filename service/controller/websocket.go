@@ -37,7 +37,7 @@ func (c *WebSocketController) WebSocket(ctx *gin.Context) {
 		return
 	}
 
-	handler := handler.NewWebSocketMessageHandler(conn)
+	handler := handler.NewWebSocketMessageHandler(conn, ctx.Request.UserAgent())
 	c.hub.AddClient(handler)
 
 	for {
@@ -1,6 +1,6 @@
 // GENERATED BY THE COMMAND ABOVE; DO NOT EDIT
 // This file was generated by swaggo/swag at
-// 2019-12-17 15:32:47.765754078 -0300 -03 m=+0.055268684
+// 2026-10-19 12:02:59.380719095 +0000 UTC m=+0.190727273
 
 package docs
 
@@ -32,16 +32,16 @@ var doc = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/api/v1/rooms": {
+        "/api/v1/admin/audit": {
             "get": {
-                "description": "List Rooms in database",
+                "description": "List audit log entries, newest first",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Rooms"
+                    "Admin"
                 ],
-                "summary": "List Rooms",
+                "summary": "List Audit Log",
                 "parameters": [
                     {
                         "type": "string",
@@ -49,26 +49,134 @@ var doc = `{
                         "name": "Authorization",
                         "in": "header",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Username acting",
+                        "name": "actor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Action, like auth.login",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Target, like room:1",
+                        "name": "target",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Entries at or after a time (RFC 3339)",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Entries before a time (RFC 3339)",
+                        "name": "until",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Entries older than an entry, to page",
+                        "name": "before_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of entries (100 by default, up to 1000)",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/viewmodels.ListRoomResponse"
+                            "$ref": "#/definitions/viewmodels.ListAuditResponse"
                         }
                     }
                 }
-            },
+            }
+        },
+        "/api/v1/admin/audit/verify": {
+            "get": {
+                "description": "Verify the hash chain of the audit log, reporting the first entry changed or following a removed one",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Verify Audit Log",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.VerifyAuditResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/admin/dead-letters": {
+            "get": {
+                "description": "List command responses moved to the dead-letter queue",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "List Dead Letters",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of dead letters",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.ListDeadLetterResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/admin/dead-letters/redrive": {
             "post": {
-                "description": "Create Room in database",
+                "description": "Send dead-lettered command responses back to the response queue",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Rooms"
+                    "Admin"
                 ],
-                "summary": "Create Room",
+                "summary": "Redrive Dead Letters",
                 "parameters": [
                     {
                         "type": "string",
@@ -78,13 +186,13 @@ var doc = `{
                         "required": true
                     },
                     {
-                        "description": "Room Data",
-                        "name": "user",
+                        "description": "Dead letters to redrive (all if empty)",
+                        "name": "ids",
                         "in": "body",
                         "required": true,
                         "schema": {
                             "type": "object",
-                            "$ref": "#/definitions/viewmodels.CreateRoomRequest"
+                            "$ref": "#/definitions/viewmodels.RedriveDeadLetterRequest"
                         }
                     }
                 ],
@@ -92,22 +200,22 @@ var doc = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/viewmodels.CreateRoomResponse"
+                            "$ref": "#/definitions/viewmodels.RedriveDeadLetterResponse"
                         }
                     }
                 }
             }
         },
-        "/api/v1/rooms/{id}": {
+        "/api/v1/admin/exports": {
             "get": {
-                "description": "Get Room by ID",
+                "description": "List the exports, newest first",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Rooms"
+                    "Admin"
                 ],
-                "summary": "Get Room",
+                "summary": "List Exports",
                 "parameters": [
                     {
                         "type": "string",
@@ -115,35 +223,65 @@ var doc = `{
                         "name": "Authorization",
                         "in": "header",
                         "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "description": "Room ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/viewmodels.GetRoomResponse"
+                            "$ref": "#/definitions/viewmodels.ListExportResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Start the export of the messages of rooms over a period, soft deleted and archived ones included",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Create Export",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Export Data",
+                        "name": "export",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "$ref": "#/definitions/viewmodels.CreateExportRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.ExportJobResponse"
                         }
                     }
                 }
             }
         },
-        "/api/v1/rooms/{id}/messages": {
+        "/api/v1/admin/exports/{id}": {
             "get": {
-                "description": "List last Room Messages in database",
+                "description": "Get the status and progress of an export",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Messages"
+                    "Admin"
                 ],
-                "summary": "List Room Messages",
+                "summary": "Get Export",
                 "parameters": [
                     {
                         "type": "string",
@@ -153,8 +291,8 @@ var doc = `{
                         "required": true
                     },
                     {
-                        "type": "integer",
-                        "description": "Room ID",
+                        "type": "string",
+                        "description": "Export ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -164,20 +302,22 @@ var doc = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/viewmodels.ListMessageResponse"
+                            "$ref": "#/definitions/viewmodels.ExportJobResponse"
                         }
                     }
                 }
-            },
-            "post": {
-                "description": "Create Message in database",
+            }
+        },
+        "/api/v1/admin/exports/{id}/download": {
+            "get": {
+                "description": "Download the zip archive of a done export, with its manifest",
                 "produces": [
-                    "application/json"
+                    "application/zip"
                 ],
                 "tags": [
-                    "Messages"
+                    "Admin"
                 ],
-                "summary": "Create Message",
+                "summary": "Download Export",
                 "parameters": [
                     {
                         "type": "string",
@@ -187,84 +327,142 @@ var doc = `{
                         "required": true
                     },
                     {
-                        "type": "integer",
-                        "description": "Room ID",
+                        "type": "string",
+                        "description": "Export ID",
                         "name": "id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "description": "Message Data",
-                        "name": "user",
-                        "in": "body",
-                        "required": true,
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Zip archive",
                         "schema": {
-                            "type": "object",
-                            "$ref": "#/definitions/viewmodels.CreateMessageRequest"
+                            "type": "string"
                         }
                     }
+                }
+            }
+        },
+        "/api/v1/admin/retention": {
+            "get": {
+                "description": "Report the messages expired by the retention policies, without purging them",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Retention Report",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/viewmodels.CreateMessageResponse"
+                            "$ref": "#/definitions/viewmodels.RetentionReportResponse"
                         }
                     }
                 }
             }
         },
-        "/login": {
+        "/api/v1/admin/retention/purge": {
             "post": {
-                "description": "Login with Username and Password",
+                "description": "Purge the messages expired by the retention policies now",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Authentication"
+                    "Admin"
                 ],
-                "summary": "Login",
+                "summary": "Purge Messages",
                 "parameters": [
                     {
-                        "description": "Login Credentials",
-                        "name": "login",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "type": "object",
-                            "$ref": "#/definitions/viewmodels.LoginRequest"
-                        }
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/viewmodels.LoginResponse"
+                            "$ref": "#/definitions/viewmodels.RetentionReportResponse"
                         }
                     }
                 }
             }
         },
-        "/register": {
-            "post": {
-                "description": "Register User in database",
+        "/api/v1/admin/rooms/{id}": {
+            "delete": {
+                "description": "Soft delete a room, keeping its messages in the database. Rooms on legal hold cannot be deleted.",
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Delete Room",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {}
+                }
+            }
+        },
+        "/api/v1/admin/rooms/{id}/retention": {
+            "put": {
+                "description": "Override the global retention policy for a room, or put it on legal hold",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Authentication"
+                    "Admin"
                 ],
-                "summary": "Register User",
+                "summary": "Update Room Retention",
                 "parameters": [
                     {
-                        "description": "User Data",
-                        "name": "user",
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Retention Settings",
+                        "name": "retention",
                         "in": "body",
                         "required": true,
                         "schema": {
                             "type": "object",
-                            "$ref": "#/definitions/viewmodels.RegisterRequest"
+                            "$ref": "#/definitions/viewmodels.UpdateRoomRetentionRequest"
                         }
                     }
                 ],
@@ -272,56 +470,806 @@ var doc = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/viewmodels.RegisterResponse"
+                            "$ref": "#/definitions/viewmodels.RoomRetentionResponse"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "viewmodels.CreateMessageRequest": {
-            "type": "object",
-            "properties": {
-                "text": {
-                    "type": "string"
-                }
-            }
         },
-        "viewmodels.CreateMessageResponse": {
-            "type": "object",
-            "properties": {
-                "created_at": {
-                    "type": "string"
-                },
+        "/api/v1/admin/sessions": {
+            "get": {
+                "description": "List the WebSocket sessions connected to the instance serving the request, oldest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "List Sessions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.ListSessionResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/admin/users": {
+            "get": {
+                "description": "List every user, with its role and whether it is disabled",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "List Users",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.ListUserResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/admin/users/{username}/disabled": {
+            "put": {
+                "description": "Disabled users cannot log in or use the API. Admins cannot disable themselves.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Disable or Enable User",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Disabled",
+                        "name": "disabled",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "$ref": "#/definitions/viewmodels.UpdateUserDisabledRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.UpdateUserResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/admin/users/{username}/role": {
+            "put": {
+                "description": "Grant a role to a user, effective on its next request. Admins cannot change their own role, and only bot users have the bot role.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Update User Role",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Role",
+                        "name": "role",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "$ref": "#/definitions/viewmodels.UpdateUserRoleRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.UpdateUserResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/rooms": {
+            "get": {
+                "description": "List Rooms in database",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Rooms"
+                ],
+                "summary": "List Rooms",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.ListRoomResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create Room in database",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Rooms"
+                ],
+                "summary": "Create Room",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Room Data",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "$ref": "#/definitions/viewmodels.CreateRoomRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.CreateRoomResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/rooms/{id}": {
+            "get": {
+                "description": "Get Room by ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Rooms"
+                ],
+                "summary": "Get Room",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.GetRoomResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/rooms/{id}/archive": {
+            "post": {
+                "description": "Make a room read only",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Rooms"
+                ],
+                "summary": "Archive Room",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.GetRoomResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Allow posting to an archived room again",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Rooms"
+                ],
+                "summary": "Unarchive Room",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.GetRoomResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/rooms/{id}/messages": {
+            "get": {
+                "description": "List last Room Messages in database",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "List Room Messages",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.ListMessageResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create Message in database",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Create Message",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT Token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Message Data",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "$ref": "#/definitions/viewmodels.CreateMessageRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.CreateMessageResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "Status of the background processes (e.g. command response consumers)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Health",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.HealthResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.HealthResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/login": {
+            "post": {
+                "description": "Login with Username and Password",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Login",
+                "parameters": [
+                    {
+                        "description": "Login Credentials",
+                        "name": "login",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "$ref": "#/definitions/viewmodels.LoginRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.LoginResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/register": {
+            "post": {
+                "description": "Register User in database",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Register User",
+                "parameters": [
+                    {
+                        "description": "User Data",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "$ref": "#/definitions/viewmodels.RegisterRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/viewmodels.RegisterResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "viewmodels.AdminUserView": {
+            "type": "object",
+            "properties": {
+                "bot": {
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "disabled": {
+                    "type": "boolean"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "first_name": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_name": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "viewmodels.AuditEntryView": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "details": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "prev_hash": {
+                    "type": "string"
+                },
+                "target": {
+                    "type": "string"
+                },
+                "user_agent": {
+                    "type": "string"
+                }
+            }
+        },
+        "viewmodels.CreateExportRequest": {
+            "type": "object",
+            "required": [
+                "room_ids"
+            ],
+            "properties": {
+                "formats": {
+                    "description": "\"jsonl\" and/or \"csv\", both if empty",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "room_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "since": {
+                    "description": "Messages created at or after since, all of them if null",
+                    "type": "string"
+                },
+                "until": {
+                    "description": "Messages created before until, up to now if null",
+                    "type": "string"
+                }
+            }
+        },
+        "viewmodels.CreateMessageRequest": {
+            "type": "object",
+            "properties": {
+                "text": {
+                    "type": "string"
+                }
+            }
+        },
+        "viewmodels.CreateMessageResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "quotes": {
+                    "description": "Structured bot payload, only set on messages broadcast by a bot",
+                    "type": "object"
+                },
+                "room_id": {
+                    "type": "integer"
+                },
+                "text": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "viewmodels.CreateRoomRequest": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "viewmodels.CreateRoomResponse": {
+            "type": "object",
+            "properties": {
+                "archived": {
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "viewmodels.DeadLetterView": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "body": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "failed_at": {
+                    "type": "string"
+                },
                 "id": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                }
+            }
+        },
+        "viewmodels.ExportJobResponse": {
+            "type": "object",
+            "properties": {
+                "checksum": {
+                    "description": "SHA-256 checksum and size of the archive, once done",
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "download_url": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Failure reason of failed exports",
+                    "type": "string"
+                },
+                "exported": {
+                    "description": "Messages exported, out of total",
                     "type": "integer"
                 },
-                "room_id": {
+                "finished_at": {
+                    "type": "string"
+                },
+                "formats": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "requested_by": {
+                    "type": "string"
+                },
+                "room_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "since": {
+                    "type": "string"
+                },
+                "size": {
                     "type": "integer"
                 },
-                "text": {
+                "status": {
                     "type": "string"
                 },
-                "username": {
+                "total": {
+                    "type": "integer"
+                },
+                "until": {
                     "type": "string"
                 }
             }
         },
-        "viewmodels.CreateRoomRequest": {
+        "viewmodels.ExportJobView": {
             "type": "object",
-            "required": [
-                "name"
-            ],
             "properties": {
-                "name": {
+                "checksum": {
+                    "description": "SHA-256 checksum and size of the archive, once done",
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "download_url": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Failure reason of failed exports",
+                    "type": "string"
+                },
+                "exported": {
+                    "description": "Messages exported, out of total",
+                    "type": "integer"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "formats": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "requested_by": {
+                    "type": "string"
+                },
+                "room_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "since": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer"
+                },
+                "until": {
                     "type": "string"
                 }
             }
         },
-        "viewmodels.CreateRoomResponse": {
+        "viewmodels.GetRoomResponse": {
             "type": "object",
             "properties": {
+                "archived": {
+                    "type": "boolean"
+                },
                 "id": {
                     "type": "integer"
                 },
@@ -330,17 +1278,54 @@ var doc = `{
                 }
             }
         },
-        "viewmodels.GetRoomResponse": {
+        "viewmodels.HealthResponse": {
             "type": "object",
             "properties": {
-                "id": {
-                    "type": "integer"
+                "processes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/viewmodels.ProcessStatusView"
+                    }
                 },
-                "name": {
+                "status": {
+                    "description": "ok if every process is running, degraded otherwise",
                     "type": "string"
                 }
             }
         },
+        "viewmodels.ListAuditResponse": {
+            "type": "object",
+            "properties": {
+                "entries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/viewmodels.AuditEntryView"
+                    }
+                }
+            }
+        },
+        "viewmodels.ListDeadLetterResponse": {
+            "type": "object",
+            "properties": {
+                "dead_letters": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/viewmodels.DeadLetterView"
+                    }
+                }
+            }
+        },
+        "viewmodels.ListExportResponse": {
+            "type": "object",
+            "properties": {
+                "exports": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/viewmodels.ExportJobView"
+                    }
+                }
+            }
+        },
         "viewmodels.ListMessageResponse": {
             "type": "object",
             "properties": {
@@ -363,6 +1348,28 @@ var doc = `{
                 }
             }
         },
+        "viewmodels.ListSessionResponse": {
+            "type": "object",
+            "properties": {
+                "sessions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/viewmodels.SessionView"
+                    }
+                }
+            }
+        },
+        "viewmodels.ListUserResponse": {
+            "type": "object",
+            "properties": {
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/viewmodels.AdminUserView"
+                    }
+                }
+            }
+        },
         "viewmodels.LoginRequest": {
             "type": "object",
             "required": [
@@ -401,6 +1408,10 @@ var doc = `{
                 "id": {
                     "type": "integer"
                 },
+                "quotes": {
+                    "description": "Structured bot payload, only set on messages broadcast by a bot",
+                    "type": "object"
+                },
                 "room_id": {
                     "type": "integer"
                 },
@@ -412,6 +1423,46 @@ var doc = `{
                 }
             }
         },
+        "viewmodels.ProcessStatusView": {
+            "type": "object",
+            "properties": {
+                "last_error": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "restarts": {
+                    "type": "integer"
+                },
+                "running": {
+                    "type": "boolean"
+                },
+                "since": {
+                    "type": "string"
+                }
+            }
+        },
+        "viewmodels.RedriveDeadLetterRequest": {
+            "type": "object",
+            "properties": {
+                "ids": {
+                    "description": "Dead letters to redrive, all of them if empty",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "viewmodels.RedriveDeadLetterResponse": {
+            "type": "object",
+            "properties": {
+                "redriven": {
+                    "type": "integer"
+                }
+            }
+        },
         "viewmodels.RegisterRequest": {
             "type": "object",
             "required": [
@@ -432,6 +1483,10 @@ var doc = `{
                 "password": {
                     "type": "string"
                 },
+                "role": {
+                    "description": "Ignored on registration, users are registered with the user role",
+                    "type": "string"
+                },
                 "username": {
                     "type": "string"
                 }
@@ -453,14 +1508,93 @@ var doc = `{
                 "last_name": {
                     "type": "string"
                 },
+                "role": {
+                    "description": "Ignored on registration, users are registered with the user role",
+                    "type": "string"
+                },
                 "username": {
                     "type": "string"
                 }
             }
         },
+        "viewmodels.RetentionPolicyView": {
+            "type": "object",
+            "properties": {
+                "days": {
+                    "description": "Days messages are kept, zero for forever",
+                    "type": "integer"
+                },
+                "messages": {
+                    "description": "Newest messages kept, zero for all",
+                    "type": "integer"
+                }
+            }
+        },
+        "viewmodels.RetentionReportResponse": {
+            "type": "object",
+            "properties": {
+                "archive": {
+                    "type": "boolean"
+                },
+                "dry_run": {
+                    "type": "boolean"
+                },
+                "rooms": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/viewmodels.RoomRetentionReportView"
+                    }
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "viewmodels.RoomRetentionReportView": {
+            "type": "object",
+            "properties": {
+                "expired": {
+                    "description": "Messages purged, or that would be purged on dry runs",
+                    "type": "integer"
+                },
+                "legal_hold": {
+                    "type": "boolean"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "policy": {
+                    "type": "object",
+                    "$ref": "#/definitions/viewmodels.RetentionPolicyView"
+                },
+                "room_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "viewmodels.RoomRetentionResponse": {
+            "type": "object",
+            "properties": {
+                "days": {
+                    "type": "integer"
+                },
+                "legal_hold": {
+                    "type": "boolean"
+                },
+                "messages": {
+                    "type": "integer"
+                },
+                "room_id": {
+                    "type": "integer"
+                }
+            }
+        },
         "viewmodels.RoomView": {
             "type": "object",
             "properties": {
+                "archived": {
+                    "type": "boolean"
+                },
                 "id": {
                     "type": "integer"
                 },
@@ -468,6 +1602,112 @@ var doc = `{
                     "type": "string"
                 }
             }
+        },
+        "viewmodels.SessionView": {
+            "type": "object",
+            "properties": {
+                "connected_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "user_agent": {
+                    "type": "string"
+                }
+            }
+        },
+        "viewmodels.UpdateRoomRetentionRequest": {
+            "type": "object",
+            "properties": {
+                "days": {
+                    "description": "Days messages are kept, overriding the global policy. Null to\ninherit it, zero for forever.",
+                    "type": "integer"
+                },
+                "legal_hold": {
+                    "description": "Rooms on legal hold are never purged",
+                    "type": "boolean"
+                },
+                "messages": {
+                    "description": "Newest messages kept, overriding the global policy. Null to inherit\nit, zero for all.",
+                    "type": "integer"
+                }
+            }
+        },
+        "viewmodels.UpdateUserDisabledRequest": {
+            "type": "object",
+            "required": [
+                "disabled"
+            ],
+            "properties": {
+                "disabled": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "viewmodels.UpdateUserResponse": {
+            "type": "object",
+            "properties": {
+                "bot": {
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "disabled": {
+                    "type": "boolean"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "first_name": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_name": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "viewmodels.UpdateUserRoleRequest": {
+            "type": "object",
+            "required": [
+                "role"
+            ],
+            "properties": {
+                "role": {
+                    "description": "admin, moderator, user or bot",
+                    "type": "string"
+                }
+            }
+        },
+        "viewmodels.VerifyAuditResponse": {
+            "type": "object",
+            "properties": {
+                "broken_id": {
+                    "description": "First entry not matching its hash or its previous entry",
+                    "type": "integer"
+                },
+                "entries": {
+                    "description": "Entries verified, up to the first broken one",
+                    "type": "integer"
+                },
+                "head": {
+                    "description": "Hash of the newest entry",
+                    "type": "string"
+                },
+                "valid": {
+                    "type": "boolean"
+                }
+            }
         }
     }
 }`
@@ -0,0 +1,633 @@
+// Package export runs the compliance exports of the history of rooms.
+//
+// Exports are queued jobs producing a zip archive with the messages of the
+// rooms over a period, soft deleted and archived ones included, in JSON
+// Lines and/or CSV, and a manifest with the SHA-256 checksum of every file.
+// Jobs are stored in the database and run by any instance, and archives are
+// written to a directory shared by the instances, until they expire.
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+)
+
+// Export formats
+const (
+	JSONLines = "jsonl"
+	CSV       = "csv"
+)
+
+// Job statuses
+const (
+	StatusPending = models.ExportPending
+	StatusRunning = models.ExportRunning
+	StatusDone    = models.ExportDone
+	StatusFailed  = models.ExportFailed
+)
+
+var (
+	// ErrNoRooms is returned when an export has no rooms
+	ErrNoRooms = errors.New("export: no rooms")
+	// ErrUnknownFormat is returned for formats other than JSONLines and CSV
+	ErrUnknownFormat = errors.New("export: unknown format")
+	// ErrInvalidPeriod is returned when the period ends before it starts
+	ErrInvalidPeriod = errors.New("export: until is before since")
+	// ErrQueueFull is returned when too many exports are pending
+	ErrQueueFull = errors.New("export: too many pending exports")
+	// ErrNotDone is returned when the archive of a job is not ready
+	ErrNotDone = errors.New("export: not done")
+	// ErrNoArchive is returned when the archive of a done job is not in the
+	// directory, e.g. if it is not shared with the instance running it
+	ErrNoArchive = errors.New("export: archive not found")
+)
+
+// Exports waiting to run
+const queueSize = 16
+
+// Time between removals of expired jobs
+const pruneInterval = 10 * time.Minute
+
+// Time between the heartbeats of running jobs. Running jobs without a
+// heartbeat for staleTimeout are failed by the next prune, as the instance
+// running them stopped.
+const (
+	heartbeatInterval = 30 * time.Second
+	staleTimeout      = 5 * time.Minute
+)
+
+// Time between checks for jobs queued on other instances
+var pollInterval = 5 * time.Second
+
+// Request of an export
+type Request struct {
+	RoomIDs []uint
+	// Messages created in the period. A zero Until is the time of the
+	// request.
+	Period  repository.Period
+	Formats []string
+	// Username requesting the export
+	RequestedBy string
+}
+
+// Job is an export and its progress
+type Job struct {
+	ID      string
+	Request Request
+	Status  string
+	// Messages written, out of the messages found when the export started
+	Exported int
+	Total    int
+	// Failure reason of failed jobs
+	Error      string
+	CreatedAt  time.Time
+	FinishedAt time.Time
+	// SHA-256 checksum and size of the archive of done jobs
+	Checksum string
+	Size     int64
+}
+
+// Config of the exports
+type Config struct {
+	// Directory of the archives, shared by the instances
+	Dir string
+	// Messages read at once
+	BatchSize int
+	// Time jobs and archives are kept
+	TTL time.Duration
+}
+
+// Exporter runs the queued exports one at a time. Exporters sharing the
+// jobs repository run each job once.
+type Exporter struct {
+	rooms    repository.RoomRepository
+	messages repository.MessageRepository
+	jobs     repository.ExportRepository
+	config   Config
+	now      func() time.Time
+
+	// Signaled when a job is queued on this instance
+	queued chan struct{}
+}
+
+// NewExporter returns an exporter of the rooms and messages of the
+// repositories
+func NewExporter(rooms repository.RoomRepository, messages repository.MessageRepository, jobs repository.ExportRepository, config Config) *Exporter {
+	if config.Dir == "" {
+		config.Dir = filepath.Join(os.TempDir(), "fin-chat-exports")
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1000
+	}
+	if config.TTL <= 0 {
+		config.TTL = 24 * time.Hour
+	}
+
+	return &Exporter{
+		rooms:    rooms,
+		messages: messages,
+		jobs:     jobs,
+		config:   config,
+		now:      time.Now,
+		queued:   make(chan struct{}, 1),
+	}
+}
+
+// Start queues an export, returning ErrNotFound if a room does not exist
+func (e *Exporter) Start(req Request) (Job, error) {
+	if len(req.RoomIDs) == 0 {
+		return Job{}, ErrNoRooms
+	}
+	if len(req.Formats) == 0 {
+		req.Formats = []string{JSONLines, CSV}
+	}
+	for _, format := range req.Formats {
+		if format != JSONLines && format != CSV {
+			return Job{}, ErrUnknownFormat
+		}
+	}
+	for _, id := range req.RoomIDs {
+		if _, err := e.rooms.Find(id); err != nil {
+			return Job{}, err
+		}
+	}
+
+	now := e.now().UTC()
+	if req.Period.Until.IsZero() {
+		req.Period.Until = now
+	}
+	if !req.Period.Since.IsZero() && req.Period.Until.Before(req.Period.Since) {
+		return Job{}, ErrInvalidPeriod
+	}
+
+	pending, err := e.jobs.CountPending()
+	if err != nil {
+		return Job{}, err
+	}
+	if pending >= queueSize {
+		return Job{}, ErrQueueFull
+	}
+
+	job := Job{
+		ID:        newID(),
+		Request:   req,
+		Status:    StatusPending,
+		CreatedAt: now,
+	}
+	m := job.model()
+	if err := e.jobs.Create(&m); err != nil {
+		return Job{}, err
+	}
+
+	select {
+	case e.queued <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Job returns ErrNotFound if there is no such job
+func (e *Exporter) Job(id string) (Job, error) {
+	m, err := e.jobs.Find(id)
+	if err != nil {
+		return Job{}, err
+	}
+	return newJob(m), nil
+}
+
+// Jobs returns every job, newest first
+func (e *Exporter) Jobs() ([]Job, error) {
+	stored, err := e.jobs.List()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]Job, len(stored))
+	for i, m := range stored {
+		jobs[i] = newJob(m)
+	}
+	return jobs, nil
+}
+
+// Archive returns the path of the archive of a job, ErrNotFound if there is
+// no such job, ErrNotDone if it is not ready and ErrNoArchive if it is not
+// in the directory
+func (e *Exporter) Archive(id string) (string, error) {
+	job, err := e.Job(id)
+	if err != nil {
+		return "", err
+	}
+	if job.Status != StatusDone {
+		return "", ErrNotDone
+	}
+
+	path := e.archivePath(id)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", ErrNoArchive
+	}
+	return path, nil
+}
+
+func (e *Exporter) archivePath(id string) string {
+	return filepath.Join(e.config.Dir, id+".zip")
+}
+
+// save stores the progress of a running job, which is not interrupted if
+// it fails
+func (e *Exporter) save(job *Job) {
+	m := job.model()
+	if err := e.jobs.Update(&m); err != nil {
+		log.Printf("Error saving export %s: %s\n", job.ID, err)
+	}
+}
+
+// Run exports the queued jobs until ctx is done, including the ones queued
+// on other instances. Running jobs are failed when ctx is done, pending
+// ones are kept for the next run. Jobs left running by stopped instances
+// are failed when it starts and on every prune.
+func (e *Exporter) Run(ctx context.Context) error {
+	if err := os.MkdirAll(e.config.Dir, 0700); err != nil {
+		return err
+	}
+
+	prune := time.NewTicker(pruneInterval)
+	defer prune.Stop()
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+
+	e.prune()
+	for {
+		e.runPending(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-prune.C:
+			e.prune()
+		case <-poll.C:
+		case <-e.queued:
+		}
+	}
+}
+
+// runPending runs the pending jobs until there are none left or ctx is done
+func (e *Exporter) runPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		m, err := e.jobs.Claim(e.now().UTC())
+		if err == repository.ErrNotFound {
+			return
+		}
+		if err != nil {
+			log.Printf("Error claiming export: %s\n", err)
+			return
+		}
+		e.run(ctx, newJob(m))
+	}
+}
+
+// run exports a claimed job, recording its outcome
+func (e *Exporter) run(ctx context.Context, job Job) {
+	stop := make(chan struct{})
+	go e.heartbeat(job.ID, stop)
+	checksum, size, err := e.export(ctx, &job)
+	close(stop)
+
+	job.FinishedAt = e.now().UTC()
+	if err != nil {
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = StatusDone
+		job.Checksum = checksum
+		job.Size = size
+		// Messages purged while exporting are not in the archive
+		job.Total = job.Exported
+	}
+	e.save(&job)
+
+	if err != nil {
+		log.Printf("Export %s failed: %s\n", job.ID, err)
+		os.Remove(e.archivePath(job.ID))
+	} else {
+		log.Printf("Export %s done\n", job.ID)
+	}
+}
+
+// heartbeat reports a running job alive until stop is closed
+func (e *Exporter) heartbeat(id string, stop chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := e.jobs.Heartbeat(id, e.now().UTC()); err != nil {
+				log.Printf("Error reporting export %s alive: %s\n", id, err)
+			}
+		}
+	}
+}
+
+// prune fails the jobs left running by stopped instances, and removes the
+// jobs and archives older than the TTL
+func (e *Exporter) prune() {
+	now := e.now().UTC()
+	ids, err := e.jobs.FailStale(now.Add(-staleTimeout), now)
+	if err != nil {
+		log.Printf("Error failing stale exports: %s\n", err)
+	}
+	for _, id := range ids {
+		log.Printf("Export %s failed: its instance stopped\n", id)
+		os.Remove(e.archivePath(id))
+	}
+
+	ids, err = e.jobs.DeleteFinished(e.now().Add(-e.config.TTL))
+	if err != nil {
+		log.Printf("Error removing expired exports: %s\n", err)
+		return
+	}
+	for _, id := range ids {
+		os.Remove(e.archivePath(id))
+	}
+}
+
+// export writes the archive of a job, returning its checksum and size
+func (e *Exporter) export(ctx context.Context, job *Job) (string, int64, error) {
+	// Data files are written at once on this instance, then zipped with the
+	// manifest
+	dir, err := ioutil.TempDir("", "fin-chat-export-")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	manifest, err := e.write(ctx, job, dir)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return e.zip(job.ID, dir, manifest)
+}
+
+// write writes the data files of a job on a directory and returns their
+// manifest
+func (e *Exporter) write(ctx context.Context, job *Job, dir string) (*Manifest, error) {
+	req := job.Request
+	manifest := &Manifest{
+		ExportID:    job.ID,
+		RequestedBy: req.RequestedBy,
+		Until:       req.Period.Until,
+	}
+	if !req.Period.Since.IsZero() {
+		manifest.Since = &req.Period.Since
+	}
+
+	total := 0
+	for _, roomID := range req.RoomIDs {
+		room, err := e.rooms.Find(roomID)
+		if err != nil {
+			return nil, err
+		}
+		count, err := e.messages.CountHistory(roomID, req.Period)
+		if err != nil {
+			return nil, err
+		}
+		archived, err := e.messages.CountArchivedHistory(roomID, req.Period)
+		if err != nil {
+			return nil, err
+		}
+		total += count + archived
+		manifest.Rooms = append(manifest.Rooms, ManifestRoom{ID: room.ID, Name: room.Name})
+	}
+	job.Total = total
+	e.save(job)
+
+	files := make([]*dataFile, len(req.Formats))
+	for i, format := range req.Formats {
+		f, err := createDataFile(dir, format)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		files[i] = f
+	}
+
+	for i := range manifest.Rooms {
+		// Archived messages were purged, so they are older
+		for _, archived := range []bool{true, false} {
+			if err := e.writeRoom(ctx, job, &manifest.Rooms[i], archived, files); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, f := range files {
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Name:    f.name,
+			Records: f.records,
+			Bytes:   f.counter.n,
+			SHA256:  hex.EncodeToString(f.hash.Sum(nil)),
+		})
+	}
+
+	manifest.CreatedAt = e.now().UTC()
+	return manifest, nil
+}
+
+// writeRoom writes the messages or archived messages of a room to the data
+// files
+func (e *Exporter) writeRoom(ctx context.Context, job *Job, room *ManifestRoom, archived bool, files []*dataFile) error {
+	history := e.messages.History
+	if archived {
+		history = e.messages.ArchivedHistory
+	}
+
+	var afterID uint
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.New("export: interrupted by shutdown")
+		default:
+		}
+
+		messages, err := history(room.ID, job.Request.Period, afterID, e.config.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		for _, m := range messages {
+			record := newRecord(m, room.Name, archived)
+			for _, f := range files {
+				if err := f.write(record); err != nil {
+					return err
+				}
+			}
+		}
+		afterID = messages[len(messages)-1].ID
+		room.Messages += len(messages)
+		if archived {
+			room.Archived += len(messages)
+		}
+		job.Exported += len(messages)
+		e.save(job)
+	}
+}
+
+// zip archives the data files of a directory with their manifest,
+// returning the checksum and size of the archive. The archive is renamed
+// once complete, so other instances never serve a partial one.
+func (e *Exporter) zip(id, dir string, manifest *Manifest) (string, int64, error) {
+	path := e.archivePath(id)
+	out, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	hash := sha256.New()
+	counter := &countWriter{w: io.MultiWriter(out, hash)}
+	archive := zip.NewWriter(counter)
+
+	for _, file := range manifest.Files {
+		if err := addFile(archive, filepath.Join(dir, file.Name), file.Name); err != nil {
+			return "", 0, err
+		}
+	}
+
+	w, err := archive.Create(ManifestName)
+	if err != nil {
+		return "", 0, err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return "", 0, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return "", 0, err
+	}
+	if err := out.Close(); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(out.Name(), path); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), counter.n, nil
+}
+
+func addFile(archive *zip.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("export: archiving %s: %s", name, err)
+	}
+	return nil
+}
+
+// newJob returns the job stored in a model
+func newJob(m models.ExportJob) Job {
+	job := Job{
+		ID: m.ID,
+		Request: Request{
+			Period:      repository.Period{Until: m.Until.UTC()},
+			RequestedBy: m.RequestedBy,
+		},
+		Status:    m.Status,
+		Exported:  m.Exported,
+		Total:     m.Total,
+		Error:     m.Error,
+		CreatedAt: m.CreatedAt.UTC(),
+		Checksum:  m.Checksum,
+		Size:      m.Size,
+	}
+	for _, id := range strings.Split(m.RoomIDs, ",") {
+		if n, err := strconv.ParseUint(id, 10, 64); err == nil {
+			job.Request.RoomIDs = append(job.Request.RoomIDs, uint(n))
+		}
+	}
+	if m.Formats != "" {
+		job.Request.Formats = strings.Split(m.Formats, ",")
+	}
+	if m.Since != nil {
+		job.Request.Period.Since = m.Since.UTC()
+	}
+	if m.FinishedAt != nil {
+		job.FinishedAt = m.FinishedAt.UTC()
+	}
+	return job
+}
+
+// model returns the model storing a job
+func (job Job) model() models.ExportJob {
+	roomIDs := make([]string, len(job.Request.RoomIDs))
+	for i, id := range job.Request.RoomIDs {
+		roomIDs[i] = strconv.FormatUint(uint64(id), 10)
+	}
+
+	m := models.ExportJob{
+		ID:          job.ID,
+		RoomIDs:     strings.Join(roomIDs, ","),
+		Formats:     strings.Join(job.Request.Formats, ","),
+		Until:       job.Request.Period.Until,
+		RequestedBy: job.Request.RequestedBy,
+		Status:      job.Status,
+		Exported:    job.Exported,
+		Total:       job.Total,
+		Error:       job.Error,
+		CreatedAt:   job.CreatedAt,
+		Checksum:    job.Checksum,
+		Size:        job.Size,
+	}
+	if !job.Request.Period.Since.IsZero() {
+		since := job.Request.Period.Since
+		m.Since = &since
+	}
+	if !job.FinishedAt.IsZero() {
+		finishedAt := job.FinishedAt
+		m.FinishedAt = &finishedAt
+	}
+	return m
+}
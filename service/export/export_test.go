@@ -0,0 +1,419 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/storage/storagetest"
+)
+
+var now = time.Date(2019, 12, 20, 12, 0, 0, 0, time.UTC)
+
+// exportTest has an SQLite database with rooms "General" (1), "Random" (2)
+// and "Other" (3). General has a command of jdoe 3 days ago, its response
+// 2 days ago and a soft deleted message 1 day ago. Random and Other have a
+// message of jdoe 5 days ago.
+type exportTest struct {
+	db    *gorm.DB
+	repos repository.Repositories
+	e     *Exporter
+	dir   string
+}
+
+func newExportTest(t *testing.T) *exportTest {
+	db := storagetest.SQLite(t)
+	repos := repository.NewGorm(db)
+
+	jdoe := models.User{Username: "jdoe", Email: "jdoe@mail.com"}
+	require.NoError(t, repos.Users.Create(&jdoe))
+	bot := models.User{Username: "Bot", Email: "bot@mail.com", Bot: true}
+	require.NoError(t, repos.Users.Create(&bot))
+	for _, name := range []string{"General", "Random", "Other"} {
+		require.NoError(t, repos.Rooms.Create(&models.Room{Name: name}))
+	}
+
+	for _, m := range []struct {
+		days   int
+		text   string
+		userID uint
+		roomID uint
+	}{
+		{5, "Hi, random", jdoe.ID, 2},
+		{5, "Hi, other", jdoe.ID, 3},
+		{3, "/stock=AAPL", jdoe.ID, 1},
+		{2, "AAPL quote is $279.86 per share", bot.ID, 1},
+		{1, "Oops", jdoe.ID, 1},
+	} {
+		require.NoError(t, db.Create(&models.Message{
+			Model:  gorm.Model{CreatedAt: now.AddDate(0, 0, -m.days), UpdatedAt: now.AddDate(0, 0, -m.days)},
+			Text:   m.text,
+			UserID: m.userID,
+			RoomID: m.roomID,
+		}).Error)
+	}
+	require.NoError(t, db.Delete(&models.Message{Model: gorm.Model{ID: 5}}).Error)
+
+	dir, err := ioutil.TempDir("", "export")
+	require.NoError(t, err)
+	et := &exportTest{db: db, repos: repos, dir: dir}
+	et.e = et.newExporter()
+	return et
+}
+
+// newExporter returns an exporter sharing the database and directory, like
+// the one of another instance
+func (et *exportTest) newExporter() *Exporter {
+	e := NewExporter(et.repos.Rooms, et.repos.Messages, et.repos.Exports, Config{Dir: et.dir, BatchSize: 1})
+	e.now = func() time.Time { return now }
+	return e
+}
+
+func (et *exportTest) Close() {
+	et.db.Close()
+	os.RemoveAll(et.dir)
+}
+
+// wait runs the exporter until a job is finished
+func (et *exportTest) wait(t *testing.T, id string) Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go et.e.Run(ctx)
+
+	for i := 0; i < 200; i++ {
+		job, err := et.e.Job(id)
+		require.NoError(t, err)
+		if job.Status == StatusDone || job.Status == StatusFailed {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.FailNow(t, "export not finished")
+	return Job{}
+}
+
+// readArchive returns the files of an archive by name
+func readArchive(t *testing.T, path string) map[string][]byte {
+	r, err := zip.OpenReader(path)
+	require.NoError(t, err)
+	defer r.Close()
+
+	files := make(map[string][]byte)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		files[f.Name], err = ioutil.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+	}
+	return files
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestExport(t *testing.T) {
+	et := newExportTest(t)
+	defer et.Close()
+
+	job, err := et.e.Start(Request{
+		RoomIDs:     []uint{1, 2},
+		Period:      repository.Period{Since: now.AddDate(0, 0, -6)},
+		RequestedBy: "admin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, job.Status)
+	assert.Equal(t, []string{JSONLines, CSV}, job.Request.Formats)
+	assert.Equal(t, now, job.Request.Period.Until)
+
+	job = et.wait(t, job.ID)
+	require.Equal(t, StatusDone, job.Status, job.Error)
+	assert.Equal(t, 4, job.Exported)
+	assert.Equal(t, 4, job.Total)
+
+	path, err := et.e.Archive(job.ID)
+	require.NoError(t, err)
+	archive, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, checksum(archive), job.Checksum)
+	assert.EqualValues(t, len(archive), job.Size)
+
+	files := readArchive(t, path)
+	require.Len(t, files, 3)
+
+	var manifest Manifest
+	require.NoError(t, json.Unmarshal(files[ManifestName], &manifest))
+	assert.Equal(t, job.ID, manifest.ExportID)
+	assert.Equal(t, "admin", manifest.RequestedBy)
+	assert.Equal(t, []ManifestRoom{{ID: 1, Name: "General", Messages: 3}, {ID: 2, Name: "Random", Messages: 1}}, manifest.Rooms)
+	require.Len(t, manifest.Files, 2)
+	for _, f := range manifest.Files {
+		assert.Equal(t, 4, f.Records, f.Name)
+		assert.EqualValues(t, len(files[f.Name]), f.Bytes, f.Name)
+		assert.Equal(t, checksum(files[f.Name]), f.SHA256, f.Name)
+	}
+
+	var records []Record
+	scanner := bufio.NewScanner(bytes.NewReader(files["messages.jsonl"]))
+	for scanner.Scan() {
+		var r Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+	require.Len(t, records, 4)
+	assert.Equal(t, "stock", records[0].Command)
+	assert.Equal(t, "jdoe", records[0].Username)
+	assert.True(t, records[1].Bot)
+	assert.Empty(t, records[1].Command)
+	assert.Equal(t, "Oops", records[2].Text)
+	assert.NotNil(t, records[2].DeletedAt)
+	assert.Nil(t, records[1].DeletedAt)
+	assert.Equal(t, "Random", records[3].Room)
+
+	rows, err := csv.NewReader(bytes.NewReader(files["messages.csv"])).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 5)
+	assert.Equal(t, csvHeader, rows[0])
+	assert.Equal(t, []string{"3", "1", "General", "1", "jdoe", "false", "/stock=AAPL", "stock"}, rows[1][:8])
+}
+
+func TestExportPeriod(t *testing.T) {
+	et := newExportTest(t)
+	defer et.Close()
+
+	job, err := et.e.Start(Request{
+		RoomIDs: []uint{1, 2},
+		Period:  repository.Period{Since: now.AddDate(0, 0, -4), Until: now.AddDate(0, 0, -1)},
+		Formats: []string{CSV},
+	})
+	require.NoError(t, err)
+
+	job = et.wait(t, job.ID)
+	require.Equal(t, StatusDone, job.Status, job.Error)
+	assert.Equal(t, 2, job.Exported)
+
+	path, err := et.e.Archive(job.ID)
+	require.NoError(t, err)
+	files := readArchive(t, path)
+	assert.Len(t, files, 2)
+	assert.Contains(t, files, "messages.csv")
+}
+
+func TestStartInvalid(t *testing.T) {
+	et := newExportTest(t)
+	defer et.Close()
+
+	tests := []struct {
+		req Request
+		err error
+	}{
+		{Request{}, ErrNoRooms},
+		{Request{RoomIDs: []uint{1}, Formats: []string{"eml"}}, ErrUnknownFormat},
+		{Request{RoomIDs: []uint{1, 4}}, repository.ErrNotFound},
+		{Request{RoomIDs: []uint{1}, Period: repository.Period{Since: now.Add(time.Hour)}}, ErrInvalidPeriod},
+	}
+	for _, test := range tests {
+		_, err := et.e.Start(test.req)
+		assert.Equal(t, test.err, err, "%+v", test.req)
+	}
+	jobs, err := et.e.Jobs()
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func TestStartQueueFull(t *testing.T) {
+	et := newExportTest(t)
+	defer et.Close()
+
+	for i := 0; i < queueSize; i++ {
+		_, err := et.e.Start(Request{RoomIDs: []uint{1}})
+		require.NoError(t, err)
+	}
+	_, err := et.e.Start(Request{RoomIDs: []uint{1}})
+	assert.Equal(t, ErrQueueFull, err)
+	jobs, err := et.e.Jobs()
+	assert.NoError(t, err)
+	assert.Len(t, jobs, queueSize)
+}
+
+func TestExportInterrupted(t *testing.T) {
+	et := newExportTest(t)
+	defer et.Close()
+
+	job, err := et.e.Start(Request{RoomIDs: []uint{1}})
+	require.NoError(t, err)
+
+	claimed, err := et.repos.Exports.Claim(now)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	et.e.run(ctx, newJob(claimed))
+
+	job, err = et.e.Job(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Contains(t, job.Error, "interrupted")
+	_, err = et.e.Archive(job.ID)
+	assert.Equal(t, ErrNotDone, err)
+
+	files, err := ioutil.ReadDir(et.dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestPrune(t *testing.T) {
+	et := newExportTest(t)
+	defer et.Close()
+
+	job, err := et.e.Start(Request{RoomIDs: []uint{1}})
+	require.NoError(t, err)
+	et.wait(t, job.ID)
+
+	// Jobs are kept for the TTL
+	et.e.prune()
+	path, err := et.e.Archive(job.ID)
+	require.NoError(t, err)
+
+	et.e.now = func() time.Time { return now.Add(25 * time.Hour) }
+	et.e.prune()
+	_, err = et.e.Job(job.ID)
+	assert.Equal(t, repository.ErrNotFound, err)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPruneStale(t *testing.T) {
+	et := newExportTest(t)
+	defer et.Close()
+
+	job, err := et.e.Start(Request{RoomIDs: []uint{1}})
+	require.NoError(t, err)
+
+	// Claimed by an instance that stopped before finishing it
+	_, err = et.repos.Exports.Claim(now)
+	require.NoError(t, err)
+
+	et.e.prune()
+	job, err = et.e.Job(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, job.Status)
+
+	et.e.now = func() time.Time { return now.Add(staleTimeout + time.Second) }
+	et.e.prune()
+	job, err = et.e.Job(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Contains(t, job.Error, "instance stopped")
+}
+
+func TestExportArchived(t *testing.T) {
+	et := newExportTest(t)
+	defer et.Close()
+
+	// The command and its response are purged with archive
+	require.NoError(t, et.repos.Messages.Purge([]uint{3, 4}, true))
+
+	job, err := et.e.Start(Request{RoomIDs: []uint{1}, Formats: []string{JSONLines}})
+	require.NoError(t, err)
+	job = et.wait(t, job.ID)
+	require.Equal(t, StatusDone, job.Status, job.Error)
+	assert.Equal(t, 3, job.Exported)
+
+	path, err := et.e.Archive(job.ID)
+	require.NoError(t, err)
+	files := readArchive(t, path)
+
+	var manifest Manifest
+	require.NoError(t, json.Unmarshal(files[ManifestName], &manifest))
+	assert.Equal(t, []ManifestRoom{{ID: 1, Name: "General", Messages: 3, Archived: 2}}, manifest.Rooms)
+
+	var records []Record
+	scanner := bufio.NewScanner(bytes.NewReader(files["messages.jsonl"]))
+	for scanner.Scan() {
+		var r Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+	require.Len(t, records, 3)
+	assert.Equal(t, "/stock=AAPL", records[0].Text)
+	assert.Equal(t, "jdoe", records[0].Username)
+	assert.True(t, records[0].Archived)
+	assert.True(t, records[1].Archived)
+	assert.Equal(t, "Oops", records[2].Text)
+	assert.False(t, records[2].Archived)
+}
+
+func TestExportSharedJobs(t *testing.T) {
+	et := newExportTest(t)
+	defer et.Close()
+	other := et.newExporter()
+
+	job, err := et.e.Start(Request{RoomIDs: []uint{1}})
+	require.NoError(t, err)
+
+	// Run and downloaded on another instance
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go other.Run(ctx)
+	for i := 0; i < 200 && job.Status != StatusDone; i++ {
+		time.Sleep(10 * time.Millisecond)
+		job, err = et.e.Job(job.ID)
+		require.NoError(t, err)
+	}
+	require.Equal(t, StatusDone, job.Status, job.Error)
+	assert.Equal(t, []uint{1}, job.Request.RoomIDs)
+	assert.Equal(t, []string{JSONLines, CSV}, job.Request.Formats)
+
+	path, err := et.e.Archive(job.ID)
+	require.NoError(t, err)
+	archive, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, checksum(archive), job.Checksum)
+
+	// Jobs are claimed once
+	_, err = et.repos.Exports.Claim(now)
+	assert.Equal(t, repository.ErrNotFound, err)
+
+	// Archives missing from the directory
+	require.NoError(t, os.Remove(path))
+	_, err = et.e.Archive(job.ID)
+	assert.Equal(t, ErrNoArchive, err)
+}
+
+func TestCSVFormulas(t *testing.T) {
+	r := Record{Room: "@general", Username: "-jdoe", Text: "=HYPERLINK(\"http://x.com\")", Command: ""}
+	cells := r.csv()
+	assert.Equal(t, "'@general", cells[2])
+	assert.Equal(t, "'-jdoe", cells[4])
+	assert.Equal(t, `'=HYPERLINK("http://x.com")`, cells[6])
+	assert.Equal(t, "", cells[7])
+
+	for _, text := range []string{"+1", "\tx", "\rx"} {
+		assert.Equal(t, "'"+text, csvText(text))
+	}
+	assert.Equal(t, "AAPL = $279.86", csvText("AAPL = $279.86"))
+}
+
+func TestCommandName(t *testing.T) {
+	assert.Equal(t, "stock", commandName("/stock=AAPL"))
+	assert.Equal(t, "stock", commandName("/stock AAPL,MSFT"))
+	assert.Equal(t, "help", commandName("/help"))
+	assert.Empty(t, commandName("stock=AAPL"))
+}
@@ -0,0 +1,222 @@
+package export
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+)
+
+// ManifestName is the name of the manifest in the archives
+const ManifestName = "manifest.json"
+
+// Manifest describes the files of an archive
+type Manifest struct {
+	ExportID    string         `json:"export_id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	RequestedBy string         `json:"requested_by"`
+	Since       *time.Time     `json:"since"`
+	Until       time.Time      `json:"until"`
+	Rooms       []ManifestRoom `json:"rooms"`
+	Files       []ManifestFile `json:"files"`
+}
+
+// ManifestRoom is a room exported
+type ManifestRoom struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	Messages int    `json:"messages"`
+	// Messages read from the archive, included in Messages
+	Archived int `json:"archived"`
+}
+
+// ManifestFile is a data file of an archive
+type ManifestFile struct {
+	Name    string `json:"name"`
+	Records int    `json:"records"`
+	Bytes   int64  `json:"bytes"`
+	SHA256  string `json:"sha256"`
+}
+
+// Record is an exported message
+type Record struct {
+	ID       uint   `json:"id"`
+	RoomID   uint   `json:"room_id"`
+	Room     string `json:"room"`
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	// Posted by a bot, answering a command
+	Bot  bool   `json:"bot"`
+	Text string `json:"text"`
+	// Bot command invoked by the message (e.g. "stock"), if any
+	Command string `json:"command"`
+	// Structured result of a bot response, if any
+	Result    json.RawMessage `json:"result,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	DeletedAt *time.Time      `json:"deleted_at"`
+	// Purged by a retention policy and read from the archive
+	Archived bool `json:"archived"`
+}
+
+// CSV columns of the records
+var csvHeader = []string{"id", "room_id", "room", "user_id", "username", "bot", "text", "command", "result", "created_at", "updated_at", "deleted_at", "archived"}
+
+func newRecord(m models.Message, room string, archived bool) Record {
+	r := Record{
+		ID:        m.ID,
+		RoomID:    m.RoomID,
+		Room:      room,
+		UserID:    m.UserID,
+		Text:      m.Text,
+		Command:   commandName(m.Text),
+		Result:    json.RawMessage(m.Result),
+		CreatedAt: m.CreatedAt.UTC(),
+		UpdatedAt: m.UpdatedAt.UTC(),
+		Archived:  archived,
+	}
+	if m.User != nil {
+		r.Username = m.User.Username
+		r.Bot = m.User.Bot
+	}
+	if m.DeletedAt != nil {
+		deletedAt := m.DeletedAt.UTC()
+		r.DeletedAt = &deletedAt
+	}
+	return r
+}
+
+// commandName returns the command of a "/command=args" or "/command args"
+// message, whether a bot serves it or not
+func commandName(text string) string {
+	if !strings.HasPrefix(text, "/") {
+		return ""
+	}
+	name := strings.TrimPrefix(text, "/")
+	if i := strings.IndexAny(name, "= "); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+func (r Record) csv() []string {
+	deletedAt := ""
+	if r.DeletedAt != nil {
+		deletedAt = r.DeletedAt.Format(time.RFC3339Nano)
+	}
+	return []string{
+		strconv.FormatUint(uint64(r.ID), 10),
+		strconv.FormatUint(uint64(r.RoomID), 10),
+		csvText(r.Room),
+		strconv.FormatUint(uint64(r.UserID), 10),
+		csvText(r.Username),
+		strconv.FormatBool(r.Bot),
+		csvText(r.Text),
+		csvText(r.Command),
+		csvText(string(r.Result)),
+		r.CreatedAt.Format(time.RFC3339Nano),
+		r.UpdatedAt.Format(time.RFC3339Nano),
+		deletedAt,
+		strconv.FormatBool(r.Archived),
+	}
+}
+
+// csvText escapes the text of a CSV cell that spreadsheets would evaluate
+// as a formula, prefixing it with a quote
+func csvText(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// dataFile writes the records of an export in a format, hashing them
+type dataFile struct {
+	name    string
+	file    *os.File
+	hash    hash.Hash
+	counter *countWriter
+	records int
+	write   func(r Record) error
+	flush   func() error
+	closed  bool
+}
+
+func createDataFile(dir, format string) (*dataFile, error) {
+	name := "messages." + format
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	f := &dataFile{
+		name: name,
+		file: file,
+		hash: sha256.New(),
+	}
+	f.counter = &countWriter{w: io.MultiWriter(file, f.hash)}
+	buf := bufio.NewWriter(f.counter)
+
+	switch format {
+	case JSONLines:
+		encoder := json.NewEncoder(buf)
+		f.write = func(r Record) error {
+			f.records++
+			return encoder.Encode(r)
+		}
+		f.flush = buf.Flush
+	case CSV:
+		w := csv.NewWriter(buf)
+		f.write = func(r Record) error {
+			f.records++
+			return w.Write(r.csv())
+		}
+		f.flush = func() error {
+			w.Flush()
+			if err := w.Error(); err != nil {
+				return err
+			}
+			return buf.Flush()
+		}
+		if err := w.Write(csvHeader); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Close flushes the records, it can be called more than once
+func (f *dataFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+
+	if err := f.flush(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// countWriter counts the bytes written to a writer
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
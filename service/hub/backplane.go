@@ -0,0 +1,261 @@
+package hub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+// ErrEventTooLarge is returned when an event does not fit in a backplane
+// notification
+var ErrEventTooLarge = errors.New("hub: event too large for the backplane")
+
+// Event is a message posted on an instance, fanned out to the others
+type Event struct {
+	// Unique ID, used to drop duplicated deliveries
+	ID string `json:"id"`
+	// Instance the message was posted on
+	Origin  string                 `json:"origin"`
+	Message viewmodels.MessageView `json:"message"`
+	// Set instead of Message when the message is too large for the
+	// backplane, so subscribers load it from the repository
+	MessageID uint `json:"message_id,omitempty"`
+}
+
+// Backplane delivers the events published by every instance to all of them
+type Backplane interface {
+	// Publish an event to every instance
+	Publish(e Event) error
+	// Deliver the events published by every instance to fn until ctx is
+	// done. It returns an error when the subscription is lost.
+	Subscribe(ctx context.Context, fn func(Event)) error
+}
+
+const (
+	// Number of recent event IDs kept to drop duplicates
+	seenEvents = 1024
+	// Events waiting to be published. Broadcasting blocks when the
+	// backplane falls further behind.
+	publishQueue = 256
+	// Backoff between the attempts to publish an event, doubled up to
+	// maxPublishBackoff while the backplane keeps failing
+	minPublishBackoff = 100 * time.Millisecond
+	maxPublishBackoff = 5 * time.Second
+	// Time given to Close to publish the queued events
+	drainTimeout = 10 * time.Second
+)
+
+// DistributedHub is a Hub whose messages reach the clients of every
+// instance sharing the backplane. Messages are delivered to the local
+// clients right away and to the other instances through the backplane.
+type DistributedHub struct {
+	*Hub
+	backplane Backplane
+	messages  repository.MessageRepository
+	instance  string
+	events    chan Event
+	// Initial backoff of failed publishes, and time given to Close to
+	// publish the queued events
+	backoff      time.Duration
+	drainTimeout time.Duration
+	// Closed by Close to stop queueing events and drain the queue
+	closing   chan struct{}
+	closeOnce sync.Once
+	// Closed when the drain times out, to give up retrying
+	abort chan struct{}
+	// Closed once the publisher stops
+	published chan struct{}
+
+	mu   sync.Mutex
+	seen map[string]bool
+	// Seen IDs in arrival order, the oldest is forgotten when it is full
+	order []string
+}
+
+// NewDistributedHub returns a hub fanned out through the given backplane.
+// Messages too large for the backplane are loaded from the repository by
+// the other instances. Subscribe must run for messages of other instances to
+// be delivered.
+func NewDistributedHub(backplane Backplane, messages repository.MessageRepository) *DistributedHub {
+	return &DistributedHub{
+		Hub:          NewHub(),
+		backplane:    backplane,
+		messages:     messages,
+		instance:     newID(),
+		events:       make(chan Event, publishQueue),
+		backoff:      minPublishBackoff,
+		drainTimeout: drainTimeout,
+		closing:      make(chan struct{}),
+		abort:        make(chan struct{}),
+		published:    make(chan struct{}),
+		seen:         make(map[string]bool),
+	}
+}
+
+// Run the hub and the publishing of its messages to the backplane
+func (d *DistributedHub) Run() {
+	d.Hub.Run()
+	go d.publish()
+}
+
+// BroadcastMessage delivers a message to the local clients and queues it to
+// be published to the other instances, so a slow backplane does not block
+// the poster until the queue is full. Messages broadcast after Close only
+// reach the local clients.
+func (d *DistributedHub) BroadcastMessage(m viewmodels.MessageView) {
+	d.Hub.BroadcastMessage(m)
+
+	select {
+	case d.events <- Event{ID: newID(), Origin: d.instance, Message: m}:
+	case <-d.closing:
+		log.Printf("Hub closed, message %d only delivered locally\n", m.ID)
+	}
+}
+
+// Close publishes the queued messages, waiting up to drainTimeout (10s)
+// for the backplane, and then closes the local clients
+func (d *DistributedHub) Close() {
+	d.closeOnce.Do(func() {
+		close(d.closing)
+		select {
+		case <-d.published:
+		case <-time.After(d.drainTimeout):
+			close(d.abort)
+			<-d.published
+		}
+	})
+	d.Hub.Close()
+}
+
+// publish sends the queued events to the backplane in order, retrying each
+// one until it is published. Once the hub is closing it publishes the
+// events left on the queue and stops.
+func (d *DistributedHub) publish() {
+	defer close(d.published)
+
+	for {
+		select {
+		case e := <-d.events:
+			if !d.publishEvent(e) {
+				d.dropQueued()
+				return
+			}
+		case <-d.closing:
+			for {
+				select {
+				case e := <-d.events:
+					if !d.publishEvent(e) {
+						d.dropQueued()
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// publishEvent publishes an event, with backoff between failed attempts.
+// Messages too large for the backplane are published by ID. It returns false
+// if the event could not be published before the drain timed out.
+func (d *DistributedHub) publishEvent(e Event) bool {
+	id := e.Message.ID
+	backoff := d.backoff
+	for {
+		err := d.backplane.Publish(e)
+		if err == ErrEventTooLarge {
+			e = Event{ID: e.ID, Origin: e.Origin, MessageID: e.Message.ID}
+			err = d.backplane.Publish(e)
+		}
+		if err == nil {
+			return true
+		}
+
+		log.Printf("Error publishing message %d to the backplane, retrying in %s: %s\n", id, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-d.abort:
+			log.Printf("Message %d not published to the backplane before closing\n", id)
+			return false
+		}
+		if backoff *= 2; backoff > maxPublishBackoff {
+			backoff = maxPublishBackoff
+		}
+	}
+}
+
+// dropQueued logs the events left on the queue when the drain timed out
+func (d *DistributedHub) dropQueued() {
+	for {
+		select {
+		case e := <-d.events:
+			log.Printf("Message %d not published to the backplane before closing\n", e.Message.ID)
+		default:
+			return
+		}
+	}
+}
+
+// Subscribe delivers the messages posted on other instances to the local
+// clients until ctx is done
+func (d *DistributedHub) Subscribe(ctx context.Context) error {
+	log.Printf("Subscribing hub %s to the backplane\n", d.instance)
+	return d.backplane.Subscribe(ctx, d.receive)
+}
+
+func (d *DistributedHub) receive(e Event) {
+	// Local messages were already delivered
+	if e.Origin == d.instance || !d.firstSeen(e.ID) {
+		return
+	}
+
+	if e.MessageID != 0 {
+		m, err := d.messages.Find(e.MessageID)
+		if err != nil {
+			log.Printf("Error loading message %d from the backplane: %s\n", e.MessageID, err)
+			return
+		}
+		e.Message = viewmodels.MessageView{
+			ID:        m.ID,
+			Text:      m.Text,
+			RoomID:    m.RoomID,
+			Username:  m.User.Username,
+			CreatedAt: m.CreatedAt,
+			Quotes:    json.RawMessage(m.Result),
+		}
+	}
+	d.Hub.BroadcastRemoteMessage(e.Message)
+}
+
+// firstSeen records an event ID, returning false if it was already seen
+func (d *DistributedHub) firstSeen(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.seen[id] {
+		return false
+	}
+
+	if len(d.order) == seenEvents {
+		delete(d.seen, d.order[0])
+		d.order = d.order[1:]
+	}
+	d.seen[id] = true
+	d.order = append(d.order, id)
+	return true
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
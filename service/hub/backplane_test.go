@@ -0,0 +1,385 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/viewmodels"
+)
+
+// fakeBackplane delivers the published events to every subscriber
+type fakeBackplane struct {
+	mu          sync.Mutex
+	subscribers []chan Event
+	err         error
+	// Number of publishes failing with err before it is cleared
+	failures int
+	// Larger events are rejected when set
+	maxPayload int
+	// Publishing waits on it when set
+	blocked chan struct{}
+}
+
+func (b *fakeBackplane) Publish(e Event) error {
+	if b.blocked != nil {
+		<-b.blocked
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.err != nil {
+		err := b.err
+		if b.failures--; b.failures == 0 {
+			b.err = nil
+		}
+		return err
+	}
+	if payload, _ := json.Marshal(e); b.maxPayload > 0 && len(payload) > b.maxPayload {
+		return ErrEventTooLarge
+	}
+	for _, s := range b.subscribers {
+		s <- e
+	}
+	return nil
+}
+
+func (b *fakeBackplane) Subscribe(ctx context.Context, fn func(Event)) error {
+	events := make(chan Event, 10)
+	b.mu.Lock()
+	b.subscribers = append(b.subscribers, events)
+	b.mu.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-events:
+			fn(e)
+		}
+	}
+}
+
+func (b *fakeBackplane) waitSubscribers(n int) {
+	for {
+		b.mu.Lock()
+		count := len(b.subscribers)
+		b.mu.Unlock()
+		if count == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// recordingHandler collects the messages it receives
+type recordingHandler struct {
+	id       string
+	local    bool
+	messages chan viewmodels.MessageView
+}
+
+func newRecordingHandler(id string, local bool) *recordingHandler {
+	return &recordingHandler{id: id, local: local, messages: make(chan viewmodels.MessageView, 10)}
+}
+
+func (h *recordingHandler) GetID() string {
+	return h.id
+}
+
+func (h *recordingHandler) HandleMessage(msg viewmodels.MessageView) error {
+	h.messages <- msg
+	return nil
+}
+
+func (h *recordingHandler) LocalOnly() bool {
+	return h.local
+}
+
+// received returns the messages delivered to the handler so far
+func (h *recordingHandler) received() []string {
+	time.Sleep(20 * time.Millisecond)
+
+	var texts []string
+	for {
+		select {
+		case msg := <-h.messages:
+			texts = append(texts, msg.Text)
+		default:
+			return texts
+		}
+	}
+}
+
+func TestDistributedHub(t *testing.T) {
+	backplane := &fakeBackplane{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := NewDistributedHub(backplane, nil)
+	b := NewDistributedHub(backplane, nil)
+	for _, h := range []*DistributedHub{a, b} {
+		h.Run()
+		go h.Subscribe(ctx)
+	}
+	backplane.waitSubscribers(2)
+
+	socketA, commandsA := newRecordingHandler("socket-a", false), newRecordingHandler("commands-a", true)
+	socketB, commandsB := newRecordingHandler("socket-b", false), newRecordingHandler("commands-b", true)
+	a.AddClient(socketA)
+	a.AddClient(commandsA)
+	b.AddClient(socketB)
+	b.AddClient(commandsB)
+
+	a.BroadcastMessage(viewmodels.MessageView{Text: "from a"})
+	b.BroadcastMessage(viewmodels.MessageView{Text: "from b"})
+
+	// Every socket gets every message once, local handlers only their own
+	assert.ElementsMatch(t, []string{"from a", "from b"}, socketA.received())
+	assert.ElementsMatch(t, []string{"from a", "from b"}, socketB.received())
+	assert.Equal(t, []string{"from a"}, commandsA.received())
+	assert.Equal(t, []string{"from b"}, commandsB.received())
+}
+
+func TestDistributedHubLargeMessages(t *testing.T) {
+	repos := repository.NewMemory()
+	user := models.User{Username: "jdoe", Email: "jdoe@mail.com"}
+	require.NoError(t, repos.Users.Create(&user))
+	room := models.Room{Name: "General"}
+	require.NoError(t, repos.Rooms.Create(&room))
+	message := models.Message{Text: strings.Repeat("a", 300), UserID: user.ID, RoomID: room.ID}
+	require.NoError(t, repos.Messages.Create(&message))
+
+	backplane := &fakeBackplane{maxPayload: 300}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := NewDistributedHub(backplane, repos.Messages)
+	b := NewDistributedHub(backplane, repos.Messages)
+	for _, h := range []*DistributedHub{a, b} {
+		h.Run()
+		go h.Subscribe(ctx)
+	}
+	backplane.waitSubscribers(2)
+
+	socket := newRecordingHandler("socket-b", false)
+	b.AddClient(socket)
+
+	// Published by ID and loaded from the repository
+	a.BroadcastMessage(viewmodels.MessageView{ID: message.ID, Text: message.Text, RoomID: room.ID, Username: "jdoe"})
+	a.BroadcastMessage(viewmodels.MessageView{ID: message.ID + 1, Text: strings.Repeat("b", 300), RoomID: room.ID})
+
+	select {
+	case msg := <-socket.messages:
+		assert.Equal(t, message.ID, msg.ID)
+		assert.Equal(t, message.Text, msg.Text)
+		assert.Equal(t, "jdoe", msg.Username)
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered")
+	}
+	// Unknown messages are dropped
+	assert.Empty(t, socket.received())
+}
+
+func TestDistributedHubSlowBackplane(t *testing.T) {
+	backplane := &fakeBackplane{blocked: make(chan struct{})}
+	h := NewDistributedHub(backplane, nil)
+	h.Run()
+
+	// Broadcasting does not wait for the backplane until the queue is full,
+	// and then blocks instead of dropping messages
+	queued := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < publishQueue+1; i++ {
+			h.BroadcastMessage(viewmodels.MessageView{ID: uint(i)})
+		}
+		close(queued)
+		h.BroadcastMessage(viewmodels.MessageView{ID: publishQueue + 1})
+		close(done)
+	}()
+
+	select {
+	case <-queued:
+	case <-time.After(time.Second):
+		t.Fatal("broadcast blocked by the backplane")
+	}
+	select {
+	case <-done:
+		t.Fatal("message dropped from a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(backplane.blocked)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("broadcast still blocked")
+	}
+}
+
+func TestDistributedHubDuplicates(t *testing.T) {
+	h := NewDistributedHub(&fakeBackplane{}, nil)
+	h.Run()
+
+	socket := newRecordingHandler("socket", false)
+	h.AddClient(socket)
+
+	e := Event{ID: "1", Origin: "other", Message: viewmodels.MessageView{Text: "remote"}}
+	h.receive(e)
+	h.receive(e)
+	h.receive(Event{ID: "2", Origin: h.instance, Message: viewmodels.MessageView{Text: "own"}})
+
+	assert.Equal(t, []string{"remote"}, socket.received())
+}
+
+func TestDistributedHubForgetsOldEvents(t *testing.T) {
+	h := NewDistributedHub(&fakeBackplane{}, nil)
+
+	assert.True(t, h.firstSeen("first"))
+	for i := 0; i < seenEvents; i++ {
+		h.firstSeen(newID())
+	}
+	assert.Len(t, h.seen, seenEvents)
+	assert.True(t, h.firstSeen("first"))
+}
+
+func TestDistributedHubPublishError(t *testing.T) {
+	h := NewDistributedHub(&fakeBackplane{err: errors.New("connection refused")}, nil)
+	h.Run()
+
+	handler := NewMockMessageHandler()
+	handler.On("GetID").Return("mock")
+	handler.On("HandleMessage", mock.AnythingOfType("viewmodels.MessageView")).Return(nil).Once()
+	h.AddClient(handler)
+
+	// Local clients still get the message
+	h.BroadcastMessage(viewmodels.MessageView{Text: "Text"})
+	h.RemoveClient(handler)
+
+	handler.AssertExpectations(t)
+}
+
+func TestDistributedHubPublishRetry(t *testing.T) {
+	backplane := &fakeBackplane{err: errors.New("connection refused"), failures: 3}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := NewDistributedHub(backplane, nil)
+	b := NewDistributedHub(backplane, nil)
+	for _, h := range []*DistributedHub{a, b} {
+		h.backoff = time.Millisecond
+		h.Run()
+		go h.Subscribe(ctx)
+	}
+	backplane.waitSubscribers(2)
+
+	socket := newRecordingHandler("socket-b", false)
+	b.AddClient(socket)
+
+	// Failed publishes are retried until the backplane is back
+	a.BroadcastMessage(viewmodels.MessageView{Text: "first"})
+	a.BroadcastMessage(viewmodels.MessageView{Text: "second"})
+
+	for _, text := range []string{"first", "second"} {
+		select {
+		case msg := <-socket.messages:
+			assert.Equal(t, text, msg.Text)
+		case <-time.After(time.Second):
+			t.Fatal("message not delivered")
+		}
+	}
+}
+
+func TestDistributedHubCloseDrains(t *testing.T) {
+	backplane := &fakeBackplane{blocked: make(chan struct{})}
+	events := make(chan Event, 10)
+	backplane.subscribers = append(backplane.subscribers, events)
+	h := NewDistributedHub(backplane, nil)
+	h.Run()
+
+	for i := 1; i <= 3; i++ {
+		h.BroadcastMessage(viewmodels.MessageView{ID: uint(i)})
+	}
+
+	// The queued messages are published before closing
+	closed := make(chan struct{})
+	go func() {
+		h.Close()
+		close(closed)
+	}()
+	close(backplane.blocked)
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("hub not closed")
+	}
+	require.Len(t, events, 3)
+	for i := 1; i <= 3; i++ {
+		assert.Equal(t, uint(i), (<-events).Message.ID)
+	}
+
+	// Later messages only reach the local clients
+	h.BroadcastMessage(viewmodels.MessageView{ID: 4})
+	assert.Empty(t, events)
+}
+
+func TestDistributedHubCloseTimeout(t *testing.T) {
+	h := NewDistributedHub(&fakeBackplane{err: errors.New("connection refused")}, nil)
+	h.backoff, h.drainTimeout = time.Millisecond, 20*time.Millisecond
+	h.Run()
+	h.BroadcastMessage(viewmodels.MessageView{ID: 1})
+	h.BroadcastMessage(viewmodels.MessageView{ID: 2})
+
+	// Closing gives up on a backplane that stays down
+	closed := make(chan struct{})
+	go func() {
+		h.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("hub not closed")
+	}
+}
+
+func TestPostgresBackplanePublish(t *testing.T) {
+	db, mockDb, err := sqlmock.New()
+	require.NoError(t, err)
+	p := NewPostgresBackplane(db, "")
+
+	mockDb.ExpectExec("SELECT pg_notify").
+		WithArgs("fin_chat_hub", `{"id":"1","origin":"a","message":{"id":2,"text":"Text","username":"jdoe","created_at":"0001-01-01T00:00:00Z","room_id":3}}`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	e := Event{ID: "1", Origin: "a", Message: viewmodels.MessageView{ID: 2, Text: "Text", Username: "jdoe", RoomID: 3}}
+	assert.Nil(t, p.Publish(e))
+
+	// Notifications are limited to 8000 bytes
+	e.Message.Text = strings.Repeat("a", 8000)
+	assert.Equal(t, ErrEventTooLarge, p.Publish(e))
+
+	assert.NoError(t, mockDb.ExpectationsWereMet())
+}
+
+func TestRedisBackplaneUnreachable(t *testing.T) {
+	r := NewRedisBackplane("redis://127.0.0.1:1/0")
+
+	assert.NotNil(t, r.Publish(Event{ID: "1"}))
+	assert.NotNil(t, r.Subscribe(context.Background(), func(Event) {}))
+}
@@ -1,34 +1,53 @@
 package handler
 
 import (
+	"fmt"
 	"log"
 	"strings"
+	"sync"
+	"unicode"
 
-	"github.com/jinzhu/gorm"
-
+	"github.com/hernanrocha/fin-chat/contract"
 	"github.com/hernanrocha/fin-chat/messenger"
 	"github.com/hernanrocha/fin-chat/service/hub"
 	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
 	"github.com/hernanrocha/fin-chat/service/viewmodels"
 )
 
+// DefaultBotName is the user posting the responses of bots without identity
+const DefaultBotName = "Bot"
+
 type CmdMessageHandler struct {
-	ID   string
-	msg  messenger.BotCommandMessenger
-	db   *gorm.DB
-	hub  hub.HubInterface
-	user models.User
+	ID       string
+	msg      messenger.BotCommandMessenger
+	users    repository.UserRepository
+	messages repository.MessageRepository
+	hub      hub.HubInterface
+	commands map[string]bool
+
+	// Bot users by name
+	mu   sync.Mutex
+	bots map[string]models.User
 }
 
-func NewCmdMessageHandler(ID string, msg messenger.BotCommandMessenger, hub hub.HubInterface, db *gorm.DB) (*CmdMessageHandler, error) {
+// NewCmdMessageHandler returns a handler publishing the given commands
+// (e.g. "stock") and posting the bot responses on their rooms
+func NewCmdMessageHandler(ID string, msg messenger.BotCommandMessenger, hub hub.HubInterface, users repository.UserRepository, messages repository.MessageRepository, commands []string) (*CmdMessageHandler, error) {
 	handler := &CmdMessageHandler{
-		ID:  ID,
-		msg: msg,
-		hub: hub,
-		db:  db,
+		ID:       ID,
+		msg:      msg,
+		hub:      hub,
+		users:    users,
+		messages: messages,
+		commands: make(map[string]bool),
+		bots:     make(map[string]models.User),
+	}
+	for _, command := range commands {
+		handler.commands[command] = true
 	}
 
-	if err := handler.setup(); err != nil {
+	if _, err := handler.botUser(DefaultBotName); err != nil {
 		return nil, err
 	}
 
@@ -36,10 +55,11 @@ func NewCmdMessageHandler(ID string, msg messenger.BotCommandMessenger, hub hub.
 }
 
 func (h *CmdMessageHandler) HandleMessage(msg viewmodels.MessageView) error {
-	if strings.HasPrefix(msg.Text, "/stock=") {
-		cmd := msg.Text[7:]
-		log.Printf("Sending command '%s' to StockBot...\n", cmd)
-		if err := h.msg.Publish(msg.RoomID, cmd); err != nil {
+	// Both "/stock=AAPL" and "/stock AAPL,MSFT" are supported
+	if command, args, ok := h.parseCommand(msg.Text); ok {
+		req := contract.NewRequest(command, args, contract.Requester{Username: msg.Username}, msg.RoomID)
+		log.Printf("Sending command %s /%s %v...\n", req.CorrelationID, command, args)
+		if err := h.msg.Publish(req); err != nil {
 			log.Printf("Error: %s", err)
 		}
 	}
@@ -48,18 +68,73 @@ func (h *CmdMessageHandler) HandleMessage(msg viewmodels.MessageView) error {
 	return nil
 }
 
+// parseCommand parses a "/command=args" or "/command args" message of a
+// known command
+func (h *CmdMessageHandler) parseCommand(text string) (string, []string, bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", nil, false
+	}
+
+	command, args := text[1:], ""
+	if i := strings.IndexAny(command, "= "); i >= 0 {
+		command, args = command[:i], command[i+1:]
+	}
+	if !h.commands[command] {
+		return "", nil, false
+	}
+
+	return command, parseArgs(args), true
+}
+
+// parseArgs splits command arguments separated by commas or spaces
+func parseArgs(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
 func (h *CmdMessageHandler) GetID() string {
 	return h.ID
 }
 
-func (h *CmdMessageHandler) CmdResponseHandler(botMsg messenger.BotMessage) error {
+// LocalOnly makes the handler ignore messages posted on other instances,
+// which publish their own commands
+func (h *CmdMessageHandler) LocalOnly() bool {
+	return true
+}
+
+func (h *CmdMessageHandler) CmdResponseHandler(res contract.Response) error {
+	if res.Error != nil {
+		log.Printf("Command %s failed (%s): %s\n", res.CorrelationID, res.Error.Code, res.Error.Message)
+	}
+
+	name := res.Bot
+	if name == "" {
+		name = DefaultBotName
+	}
+	user, err := h.botUser(name)
+	if err != nil {
+		log.Printf("Error getting bot user %s: %s\n", name, err)
+		return err
+	}
+
 	message := &models.Message{
-		Text:   botMsg.Message,
-		RoomID: botMsg.RoomID,
-		UserID: h.user.ID,
+		Text:   res.Text,
+		RoomID: res.RoomID,
+		UserID: user.ID,
+		Result: string(res.Result),
+	}
+	if res.CorrelationID != "" {
+		message.CorrelationID = &res.CorrelationID
 	}
 
-	if err := h.db.Create(message).Error; err != nil {
+	err = h.messages.Create(message)
+	if err == repository.ErrDuplicated {
+		// Delivered again, e.g. after a visibility timeout
+		log.Printf("Response %s already posted\n", res.CorrelationID)
+		return nil
+	}
+	if err != nil {
 		log.Println("Error creating new message from bot: ", err)
 		return err
 	}
@@ -68,8 +143,9 @@ func (h *CmdMessageHandler) CmdResponseHandler(botMsg messenger.BotMessage) erro
 		ID:        message.ID,
 		Text:      message.Text,
 		RoomID:    message.RoomID,
-		Username:  h.user.Username,
+		Username:  user.Username,
 		CreatedAt: message.CreatedAt,
+		Quotes:    res.Result,
 	}
 
 	// Broadcast message to Hub
@@ -78,22 +154,30 @@ func (h *CmdMessageHandler) CmdResponseHandler(botMsg messenger.BotMessage) erro
 	return nil
 }
 
-func (h *CmdMessageHandler) setup() error {
-	h.user = models.User{
-		Username: "Bot",
-		Email:    "bot@mail.com",
+// botUser returns the user of a bot, registering it on its first response.
+// Bots cannot post as human users.
+func (h *CmdMessageHandler) botUser(name string) (models.User, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if user, ok := h.bots[name]; ok {
+		return user, nil
 	}
 
-	if err := h.db.Where("username = ?", h.user.Username).First(&h.user).Error; err != nil {
-		if gorm.IsRecordNotFoundError(err) {
-			log.Println("Creating bot user")
-			if err := h.db.Create(&h.user).Error; err != nil {
-				return err
-			}
-		} else {
-			return err
+	user, err := h.users.FindByUsername(name)
+	switch {
+	case err == repository.ErrNotFound:
+		log.Printf("Creating bot user %s\n", name)
+		user = models.NewBotUser(name)
+		if err := h.users.Create(&user); err != nil {
+			return models.User{}, err
 		}
+	case err != nil:
+		return models.User{}, err
+	case !user.Bot:
+		return models.User{}, fmt.Errorf("username %q belongs to a user", name)
 	}
 
-	return nil
+	h.bots[name] = user
+	return user, nil
 }
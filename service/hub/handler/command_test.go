@@ -1,24 +1,26 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
 
-	"github.com/DATA-DOG/go-sqlmock"
-	"github.com/jinzhu/gorm"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
-	"github.com/hernanrocha/fin-chat/messenger"
+	"github.com/hernanrocha/fin-chat/contract"
 	"github.com/hernanrocha/fin-chat/service/hub/mocks"
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
 	"github.com/hernanrocha/fin-chat/service/viewmodels"
 )
 
 type CommandMessageHandlerSuite struct {
 	suite.Suite
-	mockDb        sqlmock.Sqlmock
-	DB            *gorm.DB
+	repos         repository.Repositories
+	room          models.Room
 	mockHub       *mocks.MockHub
 	mockMessenger *MockBotCommandMessenger
 }
@@ -28,37 +30,27 @@ func TestCommandMessageHandlerSuite(t *testing.T) {
 }
 
 func (suite *CommandMessageHandlerSuite) SetupTest() {
-	sqlDb, mock, err := sqlmock.New()
-	require.NoError(suite.T(), err)
-
-	DB, err := gorm.Open("postgres", sqlDb)
-	require.NoError(suite.T(), err)
-
-	suite.mockDb = mock
-	suite.DB = DB
+	suite.repos = repository.NewMemory()
+	suite.room = models.Room{Name: "General"}
+	require.NoError(suite.T(), suite.repos.Rooms.Create(&suite.room))
 
 	suite.mockHub = mocks.NewMockHub()
 	suite.mockMessenger = NewMockBotCommandMessenger()
 }
 
 func (suite *CommandMessageHandlerSuite) TestGetID() {
-	expectTestUser(suite.mockDb)
-
 	ID := "random-id"
-	handler, err := NewCmdMessageHandler(ID, suite.mockMessenger, suite.mockHub, suite.DB)
+	handler, err := NewCmdMessageHandler(ID, suite.mockMessenger, suite.mockHub, suite.repos.Users, suite.repos.Messages, testCommands)
 	require.Nil(suite.T(), err)
 	assert.Equal(suite.T(), ID, handler.GetID())
 
-	assert.NoError(suite.T(), suite.mockDb.ExpectationsWereMet())
 	suite.mockHub.AssertExpectations(suite.T())
 	suite.mockMessenger.AssertExpectations(suite.T())
 }
 
 func (suite *CommandMessageHandlerSuite) TestHandleMessageNotCommand() {
-	expectTestUser(suite.mockDb)
-
 	ID := "random-id"
-	handler, err := NewCmdMessageHandler(ID, suite.mockMessenger, suite.mockHub, suite.DB)
+	handler, err := NewCmdMessageHandler(ID, suite.mockMessenger, suite.mockHub, suite.repos.Users, suite.repos.Messages, testCommands)
 	require.Nil(suite.T(), err)
 
 	msg := viewmodels.MessageView{
@@ -67,65 +59,157 @@ func (suite *CommandMessageHandlerSuite) TestHandleMessageNotCommand() {
 	err = handler.HandleMessage(msg)
 	assert.NoError(suite.T(), err)
 
-	assert.NoError(suite.T(), suite.mockDb.ExpectationsWereMet())
 	suite.mockHub.AssertExpectations(suite.T())
 	suite.mockMessenger.AssertExpectations(suite.T())
 }
 
 func (suite *CommandMessageHandlerSuite) TestHandleMessageCommand() {
-	expectTestUser(suite.mockDb)
-	suite.mockMessenger.On("Publish", uint(100), "AAPL").Once()
+	suite.mockMessenger.On("Publish", commandRequest(100, "jdoe", "AAPL")).Once()
 
 	ID := "random-id"
-	handler, err := NewCmdMessageHandler(ID, suite.mockMessenger, suite.mockHub, suite.DB)
+	handler, err := NewCmdMessageHandler(ID, suite.mockMessenger, suite.mockHub, suite.repos.Users, suite.repos.Messages, testCommands)
 	require.Nil(suite.T(), err)
 
 	msg := viewmodels.MessageView{
-		RoomID: 100,
-		Text:   "/stock=AAPL",
+		RoomID:   100,
+		Username: "jdoe",
+		Text:     "/stock=AAPL",
 	}
 	err = handler.HandleMessage(msg)
 	assert.NoError(suite.T(), err)
 
-	assert.NoError(suite.T(), suite.mockDb.ExpectationsWereMet())
 	suite.mockHub.AssertExpectations(suite.T())
 	suite.mockMessenger.AssertExpectations(suite.T())
 }
 
-func (suite *CommandMessageHandlerSuite) TestCmdResponseHandler() {
-	expectTestUser(suite.mockDb)
-	suite.mockDb.ExpectBegin()
-	suite.mockDb.ExpectQuery(`INSERT INTO "messages" (.+)`).
-		WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1).AddRow(1))
-	suite.mockDb.ExpectCommit()
+func (suite *CommandMessageHandlerSuite) TestHandleMessageCommandList() {
+	suite.mockMessenger.On("Publish", commandRequest(100, "jdoe", "AAPL", "MSFT", "TSLA")).Once()
+
+	ID := "random-id"
+	handler, err := NewCmdMessageHandler(ID, suite.mockMessenger, suite.mockHub, suite.repos.Users, suite.repos.Messages, testCommands)
+	require.Nil(suite.T(), err)
+
+	msg := viewmodels.MessageView{
+		RoomID:   100,
+		Username: "jdoe",
+		Text:     "/stock AAPL, MSFT,TSLA",
+	}
+	err = handler.HandleMessage(msg)
+	assert.NoError(suite.T(), err)
 
+	suite.mockHub.AssertExpectations(suite.T())
+	suite.mockMessenger.AssertExpectations(suite.T())
+}
+
+func (suite *CommandMessageHandlerSuite) TestCmdResponseHandler() {
+	quotes := json.RawMessage(`[{"symbol":"AAPL.US","close":279.74}]`)
 	suite.mockHub.On("BroadcastMessage", mock.AnythingOfType("viewmodels.MessageView")).
+		Run(func(args mock.Arguments) {
+			mv := args.Get(0).(viewmodels.MessageView)
+			assert.Equal(suite.T(), "Bot Message", mv.Text)
+			assert.Equal(suite.T(), DefaultBotName, mv.Username)
+			assert.Equal(suite.T(), quotes, mv.Quotes)
+		}).
 		Return().Once()
 
 	ID := "random-id"
-	handler, err := NewCmdMessageHandler(ID, suite.mockMessenger, suite.mockHub, suite.DB)
+	handler, err := NewCmdMessageHandler(ID, suite.mockMessenger, suite.mockHub, suite.repos.Users, suite.repos.Messages, testCommands)
 	require.Nil(suite.T(), err)
 
-	msg := messenger.BotMessage{
-		RoomID:  10,
-		Message: "Bot Message",
+	res := contract.Response{
+		Version:       contract.Version,
+		CorrelationID: "c1",
+		Command:       "stock",
+		RoomID:        suite.room.ID,
+		Text:          "Bot Message",
+		Result:        quotes,
 	}
-	err = handler.CmdResponseHandler(msg)
+	err = handler.CmdResponseHandler(res)
 	assert.NoError(suite.T(), err)
 
-	assert.NoError(suite.T(), suite.mockDb.ExpectationsWereMet())
+	// Responses delivered again are posted once
+	err = handler.CmdResponseHandler(res)
+	assert.NoError(suite.T(), err)
+
+	messages, err := suite.repos.Messages.ListByRoom(suite.room.ID, 10)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), messages, 1)
+	assert.Equal(suite.T(), "Bot Message", messages[0].Text)
+	assert.True(suite.T(), messages[0].User.Bot)
+	assert.JSONEq(suite.T(), string(quotes), messages[0].Result)
+
 	suite.mockHub.AssertExpectations(suite.T())
 	suite.mockMessenger.AssertExpectations(suite.T())
 }
 
-var userRows = []string{"username", "password", "email", "first_name", "last_name"}
+// commandRequest matches a published request, which has a random correlation ID
+func commandRequest(roomID uint, username string, args ...string) interface{} {
+	return mock.MatchedBy(func(req contract.Request) bool {
+		return req.Version == contract.Version &&
+			req.CorrelationID != "" &&
+			req.Command == "stock" &&
+			req.RoomID == roomID &&
+			req.Requester.Username == username &&
+			assert.ObjectsAreEqual(args, req.Args)
+	})
+}
+
+func (suite *CommandMessageHandlerSuite) TestHandleMessageRoutedCommands() {
+	suite.mockMessenger.On("Publish", mock.MatchedBy(func(req contract.Request) bool {
+		return req.Command == "fx" && assert.ObjectsAreEqual([]string{"EURUSD"}, req.Args)
+	})).Once()
+
+	handler, err := NewCmdMessageHandler("random-id", suite.mockMessenger, suite.mockHub, suite.repos.Users, suite.repos.Messages, testCommands)
+	require.Nil(suite.T(), err)
+
+	// Only known commands are published
+	for _, text := range []string{"/fx EURUSD", "/news AAPL", "/me waves", "/"} {
+		err = handler.HandleMessage(viewmodels.MessageView{RoomID: 100, Text: text})
+		assert.NoError(suite.T(), err)
+	}
+
+	suite.mockMessenger.AssertExpectations(suite.T())
+}
+
+func (suite *CommandMessageHandlerSuite) TestCmdResponseHandlerNewBot() {
+	suite.mockHub.On("BroadcastMessage", mock.AnythingOfType("viewmodels.MessageView")).
+		Run(func(args mock.Arguments) {
+			mv := args.Get(0).(viewmodels.MessageView)
+			assert.Equal(suite.T(), "FxBot", mv.Username)
+		}).
+		Return().Twice()
+
+	handler, err := NewCmdMessageHandler("random-id", suite.mockMessenger, suite.mockHub, suite.repos.Users, suite.repos.Messages, testCommands)
+	require.Nil(suite.T(), err)
+
+	// The bot user is created on the first response
+	res := contract.Response{Version: contract.Version, Command: "fx", RoomID: suite.room.ID, Bot: "FxBot", Text: "EURUSD is 1.10"}
+	assert.NoError(suite.T(), handler.CmdResponseHandler(res))
+	assert.NoError(suite.T(), handler.CmdResponseHandler(res))
+
+	user, err := suite.repos.Users.FindByUsername("FxBot")
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), user.Bot)
+	assert.Equal(suite.T(), "fxbot@bots.invalid", user.Email)
+
+	suite.mockHub.AssertExpectations(suite.T())
+}
+
+func (suite *CommandMessageHandlerSuite) TestCmdResponseHandlerHumanUsername() {
+	human := models.User{Username: "jdoe", Password: "hash", Email: "jdoe@mail.com"}
+	require.NoError(suite.T(), suite.repos.Users.Create(&human))
+
+	handler, err := NewCmdMessageHandler("random-id", suite.mockMessenger, suite.mockHub, suite.repos.Users, suite.repos.Messages, testCommands)
+	require.Nil(suite.T(), err)
 
-func expectTestUser(mockDb sqlmock.Sqlmock) {
-	mockDb.ExpectQuery(`SELECT (.+) FROM "users" (.+)`).
-		WillReturnRows(sqlmock.NewRows(userRows).
-			AddRow("Bot", "password", "bot@email.com", "First", "Last"))
+	res := contract.Response{Version: contract.Version, Command: "fx", RoomID: suite.room.ID, Bot: "jdoe", Text: "Hi"}
+	assert.EqualError(suite.T(), handler.CmdResponseHandler(res), `username "jdoe" belongs to a user`)
+
+	suite.mockHub.AssertExpectations(suite.T())
 }
 
+var testCommands = []string{"stock", "fx"}
+
 type MockBotCommandMessenger struct {
 	mock.Mock
 }
@@ -134,15 +218,11 @@ func NewMockBotCommandMessenger() *MockBotCommandMessenger {
 	return &MockBotCommandMessenger{}
 }
 
-func (m *MockBotCommandMessenger) Publish(roomID uint, message string) error {
-	m.Called(roomID, message)
-	return nil
-}
-
-func (m *MockBotCommandMessenger) StartHandler(func(string) (string, error)) error {
+func (m *MockBotCommandMessenger) Publish(req contract.Request) error {
+	m.Called(req)
 	return nil
 }
 
-func (m *MockBotCommandMessenger) StartConsumer(func(messenger.BotMessage) error) error {
+func (m *MockBotCommandMessenger) StartConsumer(ctx context.Context, fn func(contract.Response) error) error {
 	return nil
 }
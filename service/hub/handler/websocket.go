@@ -1,17 +1,28 @@
 package handler
 
 import (
+	"time"
+
 	"github.com/gorilla/websocket"
+
+	"github.com/hernanrocha/fin-chat/service/hub"
 	"github.com/hernanrocha/fin-chat/service/viewmodels"
 )
 
+// Time allowed to send the close message to the peer
+const closeWriteWait = time.Second
+
 type WebSocketMessageHandler struct {
-	ws *websocket.Conn
+	ws          *websocket.Conn
+	userAgent   string
+	connectedAt time.Time
 }
 
-func NewWebSocketMessageHandler(ws *websocket.Conn) *WebSocketMessageHandler {
+func NewWebSocketMessageHandler(ws *websocket.Conn, userAgent string) *WebSocketMessageHandler {
 	return &WebSocketMessageHandler{
-		ws: ws,
+		ws:          ws,
+		userAgent:   userAgent,
+		connectedAt: time.Now(),
 	}
 }
 
@@ -22,3 +33,19 @@ func (h *WebSocketMessageHandler) HandleMessage(msg viewmodels.MessageView) erro
 func (h *WebSocketMessageHandler) GetID() string {
 	return h.ws.RemoteAddr().String()
 }
+
+// Session returns the session of the WebSocket, listed by the hub
+func (h *WebSocketMessageHandler) Session() hub.Session {
+	return hub.Session{
+		ID:          h.GetID(),
+		UserAgent:   h.userAgent,
+		ConnectedAt: h.connectedAt,
+	}
+}
+
+// Close tells the peer the server is going away and closes the connection
+func (h *WebSocketMessageHandler) Close() error {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	h.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeWriteWait))
+	return h.ws.Close()
+}
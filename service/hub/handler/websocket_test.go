@@ -48,10 +48,15 @@ func TestWebSocketMessageHandler(t *testing.T) {
 	}
 	defer ws.Close()
 
-	wsh := NewWebSocketMessageHandler(ws)
+	wsh := NewWebSocketMessageHandler(ws, "test-agent")
 	require.NotNil(t, wsh)
 	assert.NotEmpty(t, wsh.GetID())
 
+	session := wsh.Session()
+	assert.Equal(t, wsh.GetID(), session.ID)
+	assert.Equal(t, "test-agent", session.UserAgent)
+	assert.False(t, session.ConnectedAt.IsZero())
+
 	msg := viewmodels.MessageView{
 		RoomID:   100,
 		Text:     "Sample message",
@@ -67,3 +72,21 @@ func TestWebSocketMessageHandler(t *testing.T) {
 	err = json.Unmarshal(wsMsg, &msgReply)
 	assert.Equal(t, msg, msgReply)
 }
+
+func TestWebSocketMessageHandlerClose(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		NewWebSocketMessageHandler(c, r.UserAgent()).Close()
+	}))
+	defer s.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	require.Nil(t, err)
+	defer ws.Close()
+
+	_, _, err = ws.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway))
+}
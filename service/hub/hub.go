@@ -1,7 +1,10 @@
 package hub
 
 import (
+	"io"
 	"log"
+	"sort"
+	"time"
 
 	"github.com/hernanrocha/fin-chat/service/viewmodels"
 )
@@ -11,6 +14,28 @@ type MessageHandler interface {
 	HandleMessage(msg viewmodels.MessageView) error
 }
 
+// LocalHandler is implemented by clients only handling the messages posted
+// on this instance, e.g. the command handler, so that a command is published
+// once however many instances share a backplane
+type LocalHandler interface {
+	MessageHandler
+	LocalOnly() bool
+}
+
+// Session of a client connected to the hub
+type Session struct {
+	ID          string
+	UserAgent   string
+	ConnectedAt time.Time
+}
+
+// SessionHandler is implemented by the clients of users (e.g. WebSockets),
+// listed by Sessions
+type SessionHandler interface {
+	MessageHandler
+	Session() Session
+}
+
 type HubInterface interface {
 	AddClient(h MessageHandler)
 	RemoveClient(h MessageHandler)
@@ -22,14 +47,23 @@ type Hub struct {
 	AddClientChan    chan MessageHandler
 	RemoveClientChan chan MessageHandler
 	BroadcastChan    chan viewmodels.MessageView
+	// Messages posted on other instances
+	RemoteBroadcastChan chan viewmodels.MessageView
+	SessionsChan        chan chan []Session
+	CloseChan           chan chan struct{}
+	// Set once the hub is closed. Clients added later are closed right away.
+	closed bool
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		clients:          make(map[string]MessageHandler),
-		AddClientChan:    make(chan MessageHandler),
-		RemoveClientChan: make(chan MessageHandler),
-		BroadcastChan:    make(chan viewmodels.MessageView),
+		clients:             make(map[string]MessageHandler),
+		AddClientChan:       make(chan MessageHandler),
+		RemoveClientChan:    make(chan MessageHandler),
+		BroadcastChan:       make(chan viewmodels.MessageView),
+		RemoteBroadcastChan: make(chan viewmodels.MessageView),
+		SessionsChan:        make(chan chan []Session),
+		CloseChan:           make(chan chan struct{}),
 	}
 }
 
@@ -49,6 +83,28 @@ func (h *Hub) BroadcastMessage(m viewmodels.MessageView) {
 	h.BroadcastChan <- m
 }
 
+// BroadcastRemoteMessage delivers a message posted on another instance to
+// the clients not implementing LocalHandler
+func (h *Hub) BroadcastRemoteMessage(m viewmodels.MessageView) {
+	h.RemoteBroadcastChan <- m
+}
+
+// Sessions returns the sessions of the clients connected to this instance,
+// oldest first
+func (h *Hub) Sessions() []Session {
+	sessions := make(chan []Session)
+	h.SessionsChan <- sessions
+	return <-sessions
+}
+
+// Close removes all clients, closing the ones implementing io.Closer (e.g.
+// WebSockets). It returns once they are closed.
+func (h *Hub) Close() {
+	done := make(chan struct{})
+	h.CloseChan <- done
+	<-done
+}
+
 func (h *Hub) run() {
 	for {
 		select {
@@ -57,12 +113,25 @@ func (h *Hub) run() {
 		case handler := <-h.RemoveClientChan:
 			h.removeClient(handler)
 		case m := <-h.BroadcastChan:
-			h.broadcastMessage(m)
+			h.broadcastMessage(m, false)
+		case m := <-h.RemoteBroadcastChan:
+			h.broadcastMessage(m, true)
+		case sessions := <-h.SessionsChan:
+			sessions <- h.sessions()
+		case done := <-h.CloseChan:
+			h.close()
+			close(done)
 		}
 	}
 }
 
 func (h *Hub) addClient(handler MessageHandler) {
+	if h.closed {
+		log.Println("Hub closed, closing client...")
+		closeClient(handler)
+		return
+	}
+
 	log.Println("Adding client...")
 	h.clients[handler.GetID()] = handler
 }
@@ -72,12 +141,46 @@ func (h *Hub) removeClient(handler MessageHandler) {
 	delete(h.clients, handler.GetID())
 }
 
-func (h *Hub) broadcastMessage(msg viewmodels.MessageView) {
+func (h *Hub) broadcastMessage(msg viewmodels.MessageView, remote bool) {
 	log.Printf("Broadcasting message: %s\n", msg.Text)
 	for _, handler := range h.clients {
+		if l, ok := handler.(LocalHandler); ok && remote && l.LocalOnly() {
+			continue
+		}
+
 		if err := handler.HandleMessage(msg); err != nil {
 			log.Printf("Error broadcasting message: %s\n", err)
 			delete(h.clients, handler.GetID())
 		}
 	}
 }
+
+func (h *Hub) sessions() []Session {
+	sessions := []Session{}
+	for _, handler := range h.clients {
+		if s, ok := handler.(SessionHandler); ok {
+			sessions = append(sessions, s.Session())
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].ConnectedAt.Before(sessions[j].ConnectedAt)
+	})
+	return sessions
+}
+
+func (h *Hub) close() {
+	log.Printf("Closing %d clients...\n", len(h.clients))
+	for id, handler := range h.clients {
+		closeClient(handler)
+		delete(h.clients, id)
+	}
+	h.closed = true
+}
+
+func closeClient(handler MessageHandler) {
+	if c, ok := handler.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Printf("Error closing client: %s\n", err)
+		}
+	}
+}
@@ -65,12 +65,33 @@ func TestSendMessage(t *testing.T) {
 	hub := NewHub()
 	hub.addClient(mock1)
 	hub.addClient(mock2)
-	hub.broadcastMessage(msg)
+	hub.broadcastMessage(msg, false)
 
 	mock1.AssertExpectations(t)
 	mock2.AssertExpectations(t)
 }
 
+func TestSendRemoteMessage(t *testing.T) {
+	mock1 := NewMockMessageHandler()
+	local := NewMockLocalMessageHandler()
+
+	mock1.On("GetID").Return("mock1")
+	local.On("GetID").Return("local")
+	mock1.On("HandleMessage", mock.AnythingOfType("viewmodels.MessageView")).Return(nil).Twice()
+	local.On("HandleMessage", mock.AnythingOfType("viewmodels.MessageView")).Return(nil).Once()
+
+	hub := NewHub()
+	hub.addClient(mock1)
+	hub.addClient(local)
+
+	// Local handlers only get the messages posted on this instance
+	hub.broadcastMessage(viewmodels.MessageView{Text: "local"}, false)
+	hub.broadcastMessage(viewmodels.MessageView{Text: "remote"}, true)
+
+	mock1.AssertExpectations(t)
+	local.AssertExpectations(t)
+}
+
 func TestHubChannels(t *testing.T) {
 	mock := NewMockMessageHandler()
 	mock.On("GetID").Return("mock")
@@ -92,6 +113,9 @@ func TestHubChannels(t *testing.T) {
 	}
 	go hub.BroadcastMessage(msg)
 	<-hub.BroadcastChan
+
+	go hub.BroadcastRemoteMessage(msg)
+	<-hub.RemoteBroadcastChan
 }
 
 func TestHubRun(t *testing.T) {
@@ -117,6 +141,52 @@ func TestHubRun(t *testing.T) {
 	hub.RemoveClient(mock1)
 }
 
+func TestHubSessions(t *testing.T) {
+	start := time.Now()
+	handler := NewMockMessageHandler()
+	handler.On("GetID").Return("handler")
+	newer := &mockSessionHandler{session: Session{ID: "newer", ConnectedAt: start.Add(time.Second)}}
+	newer.On("GetID").Return("newer")
+	older := &mockSessionHandler{session: Session{ID: "older", UserAgent: "Firefox", ConnectedAt: start}}
+	older.On("GetID").Return("older")
+
+	hub := NewHub()
+	hub.Run()
+	assert.Empty(t, hub.Sessions())
+
+	// Only clients with a session are listed
+	hub.AddClient(handler)
+	hub.AddClient(newer)
+	hub.AddClient(older)
+	assert.Equal(t, []Session{older.session, newer.session}, hub.Sessions())
+
+	hub.RemoveClient(older)
+	assert.Equal(t, []Session{newer.session}, hub.Sessions())
+}
+
+func TestHubClose(t *testing.T) {
+	mock1 := NewMockMessageHandler()
+	mock1.On("GetID").Return("mock")
+	closer := NewMockClosingMessageHandler()
+	closer.On("GetID").Return("closer")
+	closer.On("Close").Return(nil).Twice()
+
+	hub := NewHub()
+	hub.Run()
+
+	hub.AddClient(mock1)
+	hub.AddClient(closer)
+	hub.Close()
+	assert.Len(t, hub.clients, 0)
+
+	// Clients connecting after the hub is closed are closed right away
+	hub.AddClient(closer)
+	hub.BroadcastMessage(viewmodels.MessageView{Text: "Text"})
+
+	mock1.AssertExpectations(t)
+	closer.AssertExpectations(t)
+}
+
 type MockMessageHandler struct {
 	mock.Mock
 }
@@ -134,3 +204,37 @@ func (h *MockMessageHandler) HandleMessage(msg viewmodels.MessageView) error {
 	args := h.Called(msg)
 	return args.Error(0)
 }
+
+type mockSessionHandler struct {
+	MockMessageHandler
+	session Session
+}
+
+func (h *mockSessionHandler) Session() Session {
+	return h.session
+}
+
+type MockClosingMessageHandler struct {
+	MockMessageHandler
+}
+
+func NewMockClosingMessageHandler() *MockClosingMessageHandler {
+	return &MockClosingMessageHandler{}
+}
+
+func (h *MockClosingMessageHandler) Close() error {
+	args := h.Called()
+	return args.Error(0)
+}
+
+type MockLocalMessageHandler struct {
+	MockMessageHandler
+}
+
+func NewMockLocalMessageHandler() *MockLocalMessageHandler {
+	return &MockLocalMessageHandler{}
+}
+
+func (h *MockLocalMessageHandler) LocalOnly() bool {
+	return true
+}
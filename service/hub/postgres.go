@@ -0,0 +1,81 @@
+package hub
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// Channel of the hub events
+	postgresChannel = "fin_chat_hub"
+	// Maximum payload of a notification
+	postgresMaxPayload = 7999
+)
+
+// NewPostgresBackplane returns a backplane using LISTEN/NOTIFY. db is used
+// to notify and dsn to listen. Events larger than a notification (8000
+// bytes) are rejected with ErrEventTooLarge.
+func NewPostgresBackplane(db *sql.DB, dsn string) *postgresBackplane {
+	return &postgresBackplane{
+		db:  db,
+		dsn: dsn,
+	}
+}
+
+type postgresBackplane struct {
+	db  *sql.DB
+	dsn string
+}
+
+// Publish notifies an event to the listening instances
+func (p *postgresBackplane) Publish(e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if len(payload) > postgresMaxPayload {
+		return ErrEventTooLarge
+	}
+
+	_, err = p.db.Exec(`SELECT pg_notify($1, $2)`, postgresChannel, string(payload))
+	return err
+}
+
+// Subscribe listens for events until ctx is done. The listener reconnects
+// on its own; events notified while it is disconnected are lost.
+func (p *postgresBackplane) Subscribe(ctx context.Context, fn func(Event)) error {
+	listener := pq.NewListener(p.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Backplane listener error: %s\n", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(postgresChannel); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// nil after reconnecting
+			if n == nil {
+				continue
+			}
+
+			var e Event
+			if err := json.Unmarshal([]byte(n.Extra), &e); err != nil {
+				log.Printf("Error decoding backplane event: %s\n", err)
+				continue
+			}
+			fn(e)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Channel of the hub events
+const redisChannel = "fin-chat.hub"
+
+// NewRedisBackplane returns a backplane using Redis pub/sub on the server
+// at url (e.g. redis://localhost:6379/0)
+func NewRedisBackplane(url string) *redisBackplane {
+	dial := func() (redis.Conn, error) {
+		return redis.DialURL(url, redis.DialConnectTimeout(5*time.Second))
+	}
+
+	return &redisBackplane{
+		dial: dial,
+		pool: &redis.Pool{
+			Dial:        dial,
+			MaxIdle:     4,
+			IdleTimeout: 4 * time.Minute,
+		},
+	}
+}
+
+type redisBackplane struct {
+	dial func() (redis.Conn, error)
+	// Connections used for publishing
+	pool *redis.Pool
+}
+
+// Publish sends an event to the subscribed instances
+func (r *redisBackplane) Publish(e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	_, err = conn.Do("PUBLISH", redisChannel, payload)
+	return err
+}
+
+// Subscribe receives events until ctx is done, on a dedicated connection.
+// It returns an error when the connection is lost.
+func (r *redisBackplane) Subscribe(ctx context.Context, fn func(Event)) error {
+	conn, err := r.dial()
+	if err != nil {
+		return err
+	}
+
+	psc := redis.PubSubConn{Conn: conn}
+	if err := psc.Subscribe(redisChannel); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// Closing the connection unblocks Receive
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			var e Event
+			if err := json.Unmarshal(v.Data, &e); err != nil {
+				log.Printf("Error decoding backplane event: %s\n", err)
+				continue
+			}
+			fn(e)
+		case error:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return v
+		}
+	}
+}
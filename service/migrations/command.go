@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// ErrUsage is returned for invalid migrate subcommands
+var ErrUsage = errors.New("usage: migrate up|down|status")
+
+// Command runs the migrate subcommand given by args (up, down or status),
+// writing its report to out
+func Command(m *Migrator, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return ErrUsage
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := m.Up()
+		for _, migration := range done {
+			fmt.Fprintf(out, "Applied %s\n", migration)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(out, "Schema is up to date")
+		}
+		return err
+	case "down":
+		migration, err := m.Down()
+		if err != nil {
+			return err
+		}
+		if migration == nil {
+			fmt.Fprintln(out, "No migration to revert")
+			return nil
+		}
+		fmt.Fprintf(out, "Reverted %s\n", migration)
+		return nil
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		return writeStatus(out, statuses, m.Latest())
+	}
+
+	return ErrUsage
+}
+
+func writeStatus(out io.Writer, statuses []Status, latest int) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MIGRATION\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		status, appliedAt := "pending", ""
+		if s.AppliedAt != nil {
+			status, appliedAt = "applied", s.AppliedAt.Format(time.RFC3339)
+		}
+		if s.Version > latest {
+			status = "unknown"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Migration, status, appliedAt)
+	}
+	return w.Flush()
+}
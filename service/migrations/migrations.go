@@ -0,0 +1,507 @@
+// Package migrations manages the database schema with ordered migrations.
+//
+// Migrations are never edited once released. Schema changes are made by
+// appending a new migration to All, with a Down script reverting it, and
+// SQLite scripts when its SQL differs from Postgres.
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/hernanrocha/fin-chat/service/storage"
+)
+
+// Migration is a versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	// Empty if the migration cannot be reverted
+	Down string
+	// Nil if the Postgres scripts also run on SQLite
+	SQLite *Scripts
+}
+
+// Scripts of a migration for a dialect
+type Scripts struct {
+	Up   string
+	Down string
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// scripts returns the scripts of a dialect
+func (m Migration) scripts(dialect string) Scripts {
+	if dialect == storage.SQLite && m.SQLite != nil {
+		return *m.SQLite
+	}
+	return Scripts{Up: m.Up, Down: m.Down}
+}
+
+// No-op script, for changes not needed on a dialect
+const noop = `SELECT 1`
+
+// All migrations in version order
+var All = []Migration{
+	{
+		Version: 1,
+		Name:    "create_chat_tables",
+		Up:      createChatTables,
+		Down:    dropChatTables,
+		SQLite: &Scripts{
+			Up:   createSQLiteChatTables,
+			Down: dropChatTables,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add_users_bot",
+		Up:      `ALTER TABLE users ADD COLUMN IF NOT EXISTS bot BOOLEAN NOT NULL DEFAULT false`,
+		Down:    `ALTER TABLE users DROP COLUMN bot`,
+		// The SQLite of the driver (3.25) cannot drop columns
+		SQLite: &Scripts{
+			Up: `ALTER TABLE users ADD COLUMN bot BOOLEAN NOT NULL DEFAULT false`,
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_command_jobs",
+		Up:      createCommandJobs,
+		Down:    `DROP TABLE command_jobs`,
+		// The Postgres messenger is not available on SQLite
+		SQLite: &Scripts{Up: noop, Down: noop},
+	},
+	{
+		Version: 4,
+		Name:    "flag_default_bot",
+		// Older versions created the default bot user without the bot flag.
+		// The users it flagged cannot be told apart, so it cannot be reverted.
+		Up: `UPDATE users SET bot = true WHERE username = 'Bot' AND password = '' AND NOT bot`,
+	},
+	{
+		Version: 5,
+		Name:    "add_retention",
+		Up:      addRetention,
+		Down:    dropRetention,
+		// The SQLite of the driver (3.25) cannot drop columns
+		SQLite: &Scripts{
+			Up: addSQLiteRetention,
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create_audit_log",
+		Up:      createAuditLog,
+		Down:    dropAuditLog,
+		SQLite: &Scripts{
+			Up:   createSQLiteAuditLog,
+			Down: `DROP TABLE audit_log`,
+		},
+	},
+	{
+		Version: 7,
+		Name:    "create_imported_records",
+		Up:      createImportedRecords,
+		Down:    `DROP TABLE imported_records`,
+		SQLite: &Scripts{
+			Up:   createSQLiteImportedRecords,
+			Down: `DROP TABLE imported_records`,
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add_admin_fields",
+		Up:      addAdminFields,
+		Down:    dropAdminFields,
+		// The SQLite of the driver (3.25) cannot drop columns
+		SQLite: &Scripts{
+			Up: addAdminFields,
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add_user_roles",
+		Up:      addUserRoles,
+		Down:    dropUserRoles,
+		// The SQLite of the driver (3.25) cannot drop columns
+		SQLite: &Scripts{
+			Up: addUserRoles,
+		},
+	},
+	{
+		Version: 10,
+		Name:    "create_export_jobs",
+		Up:      createExportJobs,
+		Down:    `DROP TABLE export_jobs`,
+		SQLite: &Scripts{
+			Up:   createSQLiteExportJobs,
+			Down: `DROP TABLE export_jobs`,
+		},
+	},
+	{
+		Version: 11,
+		Name:    "add_message_results",
+		Up:      addMessageResults,
+		Down:    dropMessageResults,
+		// The SQLite of the driver (3.25) cannot drop columns
+		SQLite: &Scripts{
+			Up: addMessageResults,
+		},
+	},
+	{
+		Version: 12,
+		Name:    "add_message_correlation_ids",
+		Up:      addMessageCorrelationIDs,
+		Down:    dropMessageCorrelationIDs,
+		// The SQLite of the driver (3.25) cannot drop columns
+		SQLite: &Scripts{
+			Up: addMessageCorrelationIDs,
+		},
+	},
+	{
+		Version: 13,
+		Name:    "add_export_heartbeats",
+		Up:      `ALTER TABLE export_jobs ADD COLUMN heartbeat_at TIMESTAMPTZ`,
+		Down:    `ALTER TABLE export_jobs DROP COLUMN heartbeat_at`,
+		// The SQLite of the driver (3.25) cannot drop columns
+		SQLite: &Scripts{
+			Up: `ALTER TABLE export_jobs ADD COLUMN heartbeat_at DATETIME`,
+		},
+	},
+}
+
+// Tables created by gorm AutoMigrate before migrations were introduced,
+// so existing databases are adopted as they are
+const createChatTables = `
+CREATE TABLE IF NOT EXISTS users (
+	id         SERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ,
+	updated_at TIMESTAMPTZ,
+	deleted_at TIMESTAMPTZ,
+	username   VARCHAR(100),
+	password   TEXT,
+	email      VARCHAR(100),
+	first_name TEXT,
+	last_name  TEXT
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_users_username ON users (username);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_users_email ON users (email);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS rooms (
+	id         SERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ,
+	updated_at TIMESTAMPTZ,
+	deleted_at TIMESTAMPTZ,
+	name       TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_rooms_deleted_at ON rooms (deleted_at);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id         SERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ,
+	updated_at TIMESTAMPTZ,
+	deleted_at TIMESTAMPTZ,
+	text       TEXT,
+	user_id    INTEGER,
+	room_id    INTEGER
+);
+CREATE INDEX IF NOT EXISTS idx_messages_deleted_at ON messages (deleted_at);
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'messages_user_id_users_id_foreign') THEN
+		ALTER TABLE messages ADD CONSTRAINT messages_user_id_users_id_foreign
+			FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE;
+	END IF;
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'messages_room_id_rooms_id_foreign') THEN
+		ALTER TABLE messages ADD CONSTRAINT messages_room_id_rooms_id_foreign
+			FOREIGN KEY (room_id) REFERENCES rooms (id) ON DELETE CASCADE ON UPDATE CASCADE;
+	END IF;
+END
+$$;
+`
+
+// SQLite version of createChatTables, with the foreign keys inline
+const createSQLiteChatTables = `
+CREATE TABLE users (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at DATETIME,
+	updated_at DATETIME,
+	deleted_at DATETIME,
+	username   VARCHAR(100),
+	password   TEXT,
+	email      VARCHAR(100),
+	first_name TEXT,
+	last_name  TEXT
+);
+CREATE UNIQUE INDEX uix_users_username ON users (username);
+CREATE UNIQUE INDEX uix_users_email ON users (email);
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE rooms (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at DATETIME,
+	updated_at DATETIME,
+	deleted_at DATETIME,
+	name       TEXT
+);
+CREATE INDEX idx_rooms_deleted_at ON rooms (deleted_at);
+
+CREATE TABLE messages (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at DATETIME,
+	updated_at DATETIME,
+	deleted_at DATETIME,
+	text       TEXT,
+	user_id    INTEGER REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	room_id    INTEGER REFERENCES rooms (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX idx_messages_deleted_at ON messages (deleted_at);
+`
+
+const dropChatTables = `
+DROP TABLE messages;
+DROP TABLE rooms;
+DROP TABLE users;
+`
+
+// Job queue of the Postgres messenger
+const createCommandJobs = `
+CREATE TABLE IF NOT EXISTS command_jobs (
+	id         BIGSERIAL PRIMARY KEY,
+	queue      TEXT NOT NULL,
+	payload    JSONB NOT NULL,
+	status     TEXT NOT NULL DEFAULT 'pending',
+	attempts   INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	reason     TEXT,
+	visible_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS command_jobs_claim_idx ON command_jobs (queue, status, visible_at, id);
+`
+
+// Room retention settings, and the archive of purged messages. Archived
+// messages have no foreign keys, so they outlive their users and rooms.
+const addRetention = `
+ALTER TABLE rooms
+	ADD COLUMN retention_days INTEGER,
+	ADD COLUMN retention_messages INTEGER,
+	ADD COLUMN legal_hold BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX messages_room_id_id_idx ON messages (room_id, id);
+
+CREATE TABLE archived_messages (
+	id          INTEGER PRIMARY KEY,
+	created_at  TIMESTAMPTZ,
+	updated_at  TIMESTAMPTZ,
+	deleted_at  TIMESTAMPTZ,
+	text        TEXT,
+	user_id     INTEGER,
+	room_id     INTEGER,
+	archived_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+`
+
+const dropRetention = `
+DROP TABLE archived_messages;
+DROP INDEX messages_room_id_id_idx;
+ALTER TABLE rooms
+	DROP COLUMN retention_days,
+	DROP COLUMN retention_messages,
+	DROP COLUMN legal_hold;
+`
+
+const addSQLiteRetention = `
+ALTER TABLE rooms ADD COLUMN retention_days INTEGER;
+ALTER TABLE rooms ADD COLUMN retention_messages INTEGER;
+ALTER TABLE rooms ADD COLUMN legal_hold BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX messages_room_id_id_idx ON messages (room_id, id);
+
+CREATE TABLE archived_messages (
+	id          INTEGER PRIMARY KEY,
+	created_at  DATETIME,
+	updated_at  DATETIME,
+	deleted_at  DATETIME,
+	text        TEXT,
+	user_id     INTEGER,
+	room_id     INTEGER,
+	archived_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+// The unique previous hash keeps the chain linear when several instances
+// append at once, and the triggers reject changes to recorded entries
+const createAuditLog = `
+CREATE TABLE audit_log (
+	id         SERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	actor      TEXT NOT NULL,
+	action     TEXT NOT NULL,
+	target     TEXT NOT NULL,
+	ip         TEXT NOT NULL,
+	user_agent TEXT NOT NULL,
+	details    TEXT NOT NULL,
+	prev_hash  CHAR(64) NOT NULL,
+	hash       CHAR(64) NOT NULL
+);
+CREATE UNIQUE INDEX audit_log_prev_hash_idx ON audit_log (prev_hash);
+CREATE INDEX audit_log_actor_idx ON audit_log (actor);
+CREATE INDEX audit_log_action_idx ON audit_log (action);
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_change BEFORE UPDATE OR DELETE ON audit_log
+	FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+	FOR EACH STATEMENT EXECUTE PROCEDURE audit_log_append_only();
+`
+
+const dropAuditLog = `
+DROP TABLE audit_log;
+DROP FUNCTION audit_log_append_only();
+`
+
+const createSQLiteAuditLog = `
+CREATE TABLE audit_log (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at DATETIME NOT NULL,
+	actor      TEXT NOT NULL,
+	action     TEXT NOT NULL,
+	target     TEXT NOT NULL,
+	ip         TEXT NOT NULL,
+	user_agent TEXT NOT NULL,
+	details    TEXT NOT NULL,
+	prev_hash  CHAR(64) NOT NULL,
+	hash       CHAR(64) NOT NULL
+);
+CREATE UNIQUE INDEX audit_log_prev_hash_idx ON audit_log (prev_hash);
+CREATE INDEX audit_log_actor_idx ON audit_log (actor);
+CREATE INDEX audit_log_action_idx ON audit_log (action);
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+`
+
+// Models created by imports, by the source and ID of their records
+const createImportedRecords = `
+CREATE TABLE imported_records (
+	source      TEXT NOT NULL,
+	external_id TEXT NOT NULL,
+	local_id    INTEGER NOT NULL,
+	imported_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (source, external_id)
+);
+`
+
+const createSQLiteImportedRecords = `
+CREATE TABLE imported_records (
+	source      TEXT NOT NULL,
+	external_id TEXT NOT NULL,
+	local_id    INTEGER NOT NULL,
+	imported_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (source, external_id)
+);
+`
+
+const addAdminFields = `
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE rooms ADD COLUMN archived BOOLEAN NOT NULL DEFAULT false;
+`
+
+const dropAdminFields = `
+ALTER TABLE users DROP COLUMN disabled;
+ALTER TABLE rooms DROP COLUMN archived;
+`
+
+// Existing bot users get the bot role
+const addUserRoles = `
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user';
+
+UPDATE users SET role = 'bot' WHERE bot;
+`
+
+const dropUserRoles = `
+ALTER TABLE users DROP COLUMN role;
+`
+
+// Compliance exports, claimed by the instances in creation order
+const createExportJobs = `
+CREATE TABLE export_jobs (
+	id           VARCHAR(32) PRIMARY KEY,
+	room_ids     TEXT NOT NULL,
+	formats      TEXT NOT NULL,
+	since        TIMESTAMPTZ,
+	until        TIMESTAMPTZ NOT NULL,
+	requested_by TEXT NOT NULL,
+	status       VARCHAR(20) NOT NULL,
+	exported     INTEGER NOT NULL DEFAULT 0,
+	total        INTEGER NOT NULL DEFAULT 0,
+	error        TEXT NOT NULL DEFAULT '',
+	created_at   TIMESTAMPTZ NOT NULL,
+	finished_at  TIMESTAMPTZ,
+	checksum     TEXT NOT NULL DEFAULT '',
+	size         BIGINT NOT NULL DEFAULT 0
+);
+CREATE INDEX export_jobs_status_created_at_idx ON export_jobs (status, created_at);
+`
+
+const createSQLiteExportJobs = `
+CREATE TABLE export_jobs (
+	id           VARCHAR(32) PRIMARY KEY,
+	room_ids     TEXT NOT NULL,
+	formats      TEXT NOT NULL,
+	since        DATETIME,
+	until        DATETIME NOT NULL,
+	requested_by TEXT NOT NULL,
+	status       VARCHAR(20) NOT NULL,
+	exported     INTEGER NOT NULL DEFAULT 0,
+	total        INTEGER NOT NULL DEFAULT 0,
+	error        TEXT NOT NULL DEFAULT '',
+	created_at   DATETIME NOT NULL,
+	finished_at  DATETIME,
+	checksum     TEXT NOT NULL DEFAULT '',
+	size         BIGINT NOT NULL DEFAULT 0
+);
+CREATE INDEX export_jobs_status_created_at_idx ON export_jobs (status, created_at);
+`
+
+// Structured results of the bot responses, archived with their messages
+const addMessageResults = `
+ALTER TABLE messages ADD COLUMN result TEXT NOT NULL DEFAULT '';
+ALTER TABLE archived_messages ADD COLUMN result TEXT NOT NULL DEFAULT '';
+`
+
+const dropMessageResults = `
+ALTER TABLE messages DROP COLUMN result;
+ALTER TABLE archived_messages DROP COLUMN result;
+`
+
+// Bot responses are posted once per command request, even when they are
+// delivered more than once
+const addMessageCorrelationIDs = `
+ALTER TABLE messages ADD COLUMN correlation_id TEXT;
+CREATE UNIQUE INDEX messages_correlation_id_idx ON messages (correlation_id);
+`
+
+const dropMessageCorrelationIDs = `
+DROP INDEX messages_correlation_id_idx;
+ALTER TABLE messages DROP COLUMN correlation_id;
+`
@@ -0,0 +1,252 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hernanrocha/fin-chat/service/storage"
+)
+
+// ErrSchemaTooNew is returned when the database has migrations unknown to
+// this binary, i.e. it was migrated by a newer version
+var ErrSchemaTooNew = errors.New("migrations: database schema is newer than this binary")
+
+// IrreversibleError is returned when reverting a migration without a down
+// script for the dialect of the database
+type IrreversibleError struct {
+	Migration Migration
+	Dialect   string
+}
+
+func (e *IrreversibleError) Error() string {
+	return fmt.Sprintf("migrations: %s cannot be reverted on %s, restore a backup taken before it was applied instead", e.Migration, e.Dialect)
+}
+
+// Advisory lock serializing the migrations of concurrent instances. SQLite
+// transactions are already serialized.
+const lockKey = 72530042
+
+var createMigrationsTable = map[string]string{
+	storage.Postgres: `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`,
+	storage.SQLite: `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`,
+}
+
+// Status of a migration
+type Status struct {
+	Migration
+	// Nil if it is pending
+	AppliedAt *time.Time
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+// New returns a migrator of All migrations for a database of the given
+// dialect (storage.Postgres or storage.SQLite)
+func New(db *sql.DB, dialect string) *Migrator {
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: All,
+	}
+}
+
+// Latest returns the version of the last known migration
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status lists the known migrations, and the applied ones unknown to this
+// binary
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, migration := range m.migrations {
+		s := Status{Migration: migration}
+		if a, ok := applied[migration.Version]; ok {
+			s.AppliedAt = a.AppliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, s)
+	}
+	// Migrations of a newer binary
+	var unknown []Status
+	for _, a := range applied {
+		unknown = append(unknown, a)
+	}
+	sort.Slice(unknown, func(i, j int) bool {
+		return unknown[i].Version < unknown[j].Version
+	})
+
+	return append(statuses, unknown...), nil
+}
+
+// Check returns ErrSchemaTooNew if the database was migrated by a newer
+// binary
+func (m *Migrator) Check() error {
+	_, err := m.current()
+	return err
+}
+
+// Up applies the pending migrations in order and returns them
+func (m *Migrator) Up() ([]Migration, error) {
+	applied, err := m.current()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		ok, err := m.apply(migration, true)
+		if err != nil {
+			return done, fmt.Errorf("applying %s: %s", migration, err)
+		}
+		if ok {
+			done = append(done, migration)
+		}
+	}
+
+	return done, nil
+}
+
+// Down reverts the last applied migration and returns it. It returns nil
+// if there is none, and an IrreversibleError without changing the database
+// if it has no down script.
+func (m *Migrator) Down() (*Migration, error) {
+	applied, err := m.current()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		if migration.scripts(m.dialect).Down == "" {
+			return nil, &IrreversibleError{Migration: migration, Dialect: m.dialect}
+		}
+		if _, err := m.apply(migration, false); err != nil {
+			return nil, fmt.Errorf("reverting %s: %s", migration, err)
+		}
+		return &migration, nil
+	}
+
+	return nil, nil
+}
+
+// current returns the applied migrations, or ErrSchemaTooNew if some of
+// them are unknown
+func (m *Migrator) current() (map[int]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	for version := range applied {
+		if version > m.Latest() {
+			return nil, ErrSchemaTooNew
+		}
+	}
+	return applied, nil
+}
+
+// applied returns the applied migrations by version, creating the
+// migrations table if needed
+func (m *Migrator) applied() (map[int]Status, error) {
+	if _, err := m.db.Exec(createMigrationsTable[m.dialect]); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.Query(`SELECT version, name, applied_at FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]Status)
+	for rows.Next() {
+		var s Status
+		var appliedAt time.Time
+		if err := rows.Scan(&s.Version, &s.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+		s.AppliedAt = &appliedAt
+		applied[s.Version] = s
+	}
+
+	return applied, rows.Err()
+}
+
+// apply runs the up or down script of a migration in a transaction. It
+// returns false if another instance already did it.
+func (m *Migrator) apply(migration Migration, up bool) (bool, error) {
+	scripts := migration.scripts(m.dialect)
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if m.dialect == storage.Postgres {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, lockKey); err != nil {
+			return false, err
+		}
+	}
+
+	var applied bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, migration.Version).Scan(&applied)
+	if err != nil {
+		return false, err
+	}
+	if applied == up {
+		return false, tx.Commit()
+	}
+
+	if up {
+		if _, err := tx.Exec(scripts.Up); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name)
+	} else {
+		if _, err := tx.Exec(scripts.Down); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
@@ -0,0 +1,219 @@
+package migrations
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/storage"
+)
+
+var testMigrations = []Migration{
+	{Version: 1, Name: "create_a", Up: "CREATE TABLE a", Down: "DROP TABLE a"},
+	{Version: 2, Name: "create_b", Up: "CREATE TABLE b", Down: "DROP TABLE b"},
+}
+
+var appliedAt = time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock, *sql.DB) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	return &Migrator{db: db, dialect: storage.Postgres, migrations: testMigrations}, mock, db
+}
+
+// expectApplied expects the applied migrations to be read
+func expectApplied(mock sqlmock.Sqlmock, versions ...int) {
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "name", "applied_at"})
+	for _, v := range versions {
+		rows.AddRow(v, "migration", appliedAt)
+	}
+	mock.ExpectQuery("SELECT version, name, applied_at FROM schema_migrations").WillReturnRows(rows)
+}
+
+// expectLocked expects a transaction holding the migrations lock
+func expectLocked(mock sqlmock.Sqlmock, version int, applied bool) {
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs(lockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS").WithArgs(version).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(applied))
+}
+
+func TestUp(t *testing.T) {
+	m, mock, db := newTestMigrator(t)
+	defer db.Close()
+
+	expectApplied(mock, 1)
+	expectLocked(mock, 2, false)
+	mock.ExpectExec("CREATE TABLE b").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(2, "create_b").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	done, err := m.Up()
+	assert.NoError(t, err)
+	assert.Equal(t, []Migration{testMigrations[1]}, done)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpAppliedConcurrently(t *testing.T) {
+	m, mock, db := newTestMigrator(t)
+	defer db.Close()
+
+	// Another instance applied the first migration after it was read
+	expectApplied(mock)
+	expectLocked(mock, 1, true)
+	mock.ExpectCommit()
+	expectLocked(mock, 2, false)
+	mock.ExpectExec("CREATE TABLE b").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(2, "create_b").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	done, err := m.Up()
+	assert.NoError(t, err)
+	assert.Equal(t, []Migration{testMigrations[1]}, done)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpFailure(t *testing.T) {
+	m, mock, db := newTestMigrator(t)
+	defer db.Close()
+
+	expectApplied(mock)
+	expectLocked(mock, 1, false)
+	mock.ExpectExec("CREATE TABLE a").WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	done, err := m.Up()
+	assert.EqualError(t, err, "applying 0001_create_a: sql: connection is already closed")
+	assert.Empty(t, done)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSchemaTooNew(t *testing.T) {
+	m, mock, db := newTestMigrator(t)
+	defer db.Close()
+
+	expectApplied(mock, 1, 2, 3)
+	expectApplied(mock, 1, 2, 3)
+	expectApplied(mock, 1, 2, 3)
+
+	assert.Equal(t, ErrSchemaTooNew, m.Check())
+	_, err := m.Up()
+	assert.Equal(t, ErrSchemaTooNew, err)
+	_, err = m.Down()
+	assert.Equal(t, ErrSchemaTooNew, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDown(t *testing.T) {
+	m, mock, db := newTestMigrator(t)
+	defer db.Close()
+
+	expectApplied(mock, 1, 2)
+	expectLocked(mock, 2, true)
+	mock.ExpectExec("DROP TABLE b").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM schema_migrations").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	migration, err := m.Down()
+	assert.NoError(t, err)
+	assert.Equal(t, &testMigrations[1], migration)
+
+	// Nothing to revert
+	expectApplied(mock)
+	migration, err = m.Down()
+	assert.NoError(t, err)
+	assert.Nil(t, migration)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDownIrreversible(t *testing.T) {
+	m, mock, db := newTestMigrator(t)
+	defer db.Close()
+	m.migrations = []Migration{{Version: 1, Name: "fill_a", Up: "INSERT INTO a"}}
+
+	expectApplied(mock, 1)
+
+	_, err := m.Down()
+	assert.EqualError(t, err, "migrations: 0001_fill_a cannot be reverted on postgres, restore a backup taken before it was applied instead")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLite(t *testing.T) {
+	db, err := storage.Open("sqlite::memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	m := New(db.DB(), storage.SQLite)
+
+	done, err := m.Up()
+	require.NoError(t, err)
+	assert.Equal(t, All, done)
+
+	statuses, err := m.Status()
+	require.NoError(t, err)
+	require.Len(t, statuses, len(All))
+	for _, s := range statuses {
+		assert.NotNil(t, s.AppliedAt, "migration %s", s.Migration)
+	}
+
+	// Foreign keys are enforced
+	_, err = db.DB().Exec(`INSERT INTO messages (text, user_id, room_id) VALUES ('Hi', 1, 1)`)
+	assert.Error(t, err)
+
+	// Migrations SQLite cannot revert are refused, leaving them applied
+	_, err = m.Down()
+	assert.Equal(t, &IrreversibleError{Migration: All[len(All)-1], Dialect: storage.SQLite}, err)
+	statuses, err = m.Status()
+	require.NoError(t, err)
+	assert.NotNil(t, statuses[len(All)-1].AppliedAt)
+}
+
+func TestCommandStatus(t *testing.T) {
+	m, mock, db := newTestMigrator(t)
+	defer db.Close()
+
+	expectApplied(mock, 1, 3)
+
+	var out bytes.Buffer
+	assert.NoError(t, Command(m, []string{"status"}, &out))
+	assert.Equal(t, ""+
+		"MIGRATION       STATUS   APPLIED AT\n"+
+		"0001_create_a   applied  2019-10-01T12:00:00Z\n"+
+		"0002_create_b   pending  \n"+
+		"0003_migration  unknown  2019-10-01T12:00:00Z\n", out.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCommandUsage(t *testing.T) {
+	m, _, db := newTestMigrator(t)
+	defer db.Close()
+
+	tests := [][]string{
+		nil,
+		{"sideways"},
+		{"up", "2"},
+	}
+
+	for _, args := range tests {
+		assert.Equal(t, ErrUsage, Command(m, args, &bytes.Buffer{}), "args %v", args)
+	}
+}
+
+func TestAllMigrations(t *testing.T) {
+	// Data migrations that cannot be reverted
+	irreversible := map[int]bool{4: true}
+
+	for i, migration := range All {
+		assert.Equal(t, i+1, migration.Version, "migration %s", migration)
+		assert.NotEmpty(t, migration.Up, "migration %s", migration)
+		assert.Equal(t, irreversible[migration.Version], migration.Down == "", "migration %s", migration)
+		if migration.SQLite != nil {
+			assert.NotEmpty(t, migration.SQLite.Up, "migration %s", migration)
+		}
+	}
+}
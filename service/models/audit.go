@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditEntry is an event of the append-only audit log. Each entry holds the
+// hash of the previous one, so changing or removing an entry breaks the
+// chain.
+type AuditEntry struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	// Username acting, or attempting to log in
+	Actor     string
+	Action    string
+	Target    string
+	IP        string
+	UserAgent string
+	Details   string
+	PrevHash  string
+	Hash      string
+}
+
+// TableName of the audit log
+func (AuditEntry) TableName() string {
+	return "audit_log"
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// Statuses of the export jobs
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+)
+
+// ExportJob is a compliance export of the history of rooms, run by any
+// instance
+type ExportJob struct {
+	ID string `gorm:"primary_key"`
+	// Comma separated room IDs and formats
+	RoomIDs string `gorm:"column:room_ids"`
+	Formats string
+	// Messages created in the period, Since is nil if it is unbounded
+	Since       *time.Time
+	Until       time.Time
+	RequestedBy string
+	Status      string
+	// Messages written, out of the messages found when the export started
+	Exported int
+	Total    int
+	// Last time the instance running the job reported it alive. Running
+	// jobs whose instance stopped are failed once it is too old.
+	HeartbeatAt *time.Time
+	// Failure reason of failed jobs
+	Error      string
+	CreatedAt  time.Time
+	FinishedAt *time.Time
+	// SHA-256 checksum and size of the archive of done jobs
+	Checksum string
+	Size     int64
+}
@@ -9,6 +9,11 @@ type Message struct {
 	Text   string
 	UserID uint
 	RoomID uint
+	// Structured result of a bot response as JSON, empty on other messages
+	Result string `gorm:"not null;default:''"`
+	// Command request answered by a bot response, unique, nil on other
+	// messages
+	CorrelationID *string
 
 	User *User
 }
@@ -0,0 +1,49 @@
+package models
+
+// Global roles of the users
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleUser      = "user"
+	RoleBot       = "bot"
+)
+
+// Roles are the valid roles
+var Roles = []string{RoleAdmin, RoleModerator, RoleUser, RoleBot}
+
+// ValidRole returns true for the roles in Roles
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Permission to use a group of endpoints
+type Permission string
+
+const (
+	// Create rooms and post messages
+	PermissionPost Permission = "post"
+	// Archive and unarchive rooms
+	PermissionModerate Permission = "moderate"
+	// Use the admin endpoints (users, room deletion, audit log, ...)
+	PermissionAdmin Permission = "admin"
+)
+
+// Permissions granted by each role
+var rolePermissions = map[string][]Permission{
+	RoleAdmin:     {PermissionPost, PermissionModerate, PermissionAdmin},
+	RoleModerator: {PermissionPost, PermissionModerate},
+	RoleUser:      {PermissionPost},
+	RoleBot:       {PermissionPost},
+}
+
+// HasPermission returns true if a role grants a permission. Unknown roles
+// grant none.
+func HasPermission(role string, permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -7,4 +7,13 @@ import (
 type Room struct {
 	gorm.Model
 	Name string
+
+	// Retention overriding the global policy, nil to inherit it. Zero keeps
+	// messages forever.
+	RetentionDays     *int
+	RetentionMessages *int
+	// Rooms on legal hold are never purged
+	LegalHold bool `gorm:"not null;default:false"`
+	// Archived rooms are read only
+	Archived bool `gorm:"not null;default:false"`
 }
@@ -1,9 +1,20 @@
 package models
 
 import (
+	"errors"
+	"strings"
+
 	"github.com/jinzhu/gorm"
 )
 
+// Domain of the bot user emails. The .invalid TLD is reserved (RFC 2606),
+// so the emails can never reach a real mailbox.
+const botEmailDomain = "bots.invalid"
+
+// ErrBotRole is returned when granting the bot role to a user who is not a
+// bot, or another role to a bot
+var ErrBotRole = errors.New("only bot users have the bot role")
+
 type User struct {
 	gorm.Model
 	Username  string `gorm:"type:varchar(100);unique_index"`
@@ -11,4 +22,30 @@ type User struct {
 	Email     string `gorm:"type:varchar(100);unique_index"`
 	FirstName string
 	LastName  string
+	// Bot users post the command responses
+	Bot bool `gorm:"not null;default:false"`
+	// Global role, granting the permissions of the API (see HasPermission)
+	Role string `gorm:"type:varchar(20);not null;default:'user'"`
+	// Disabled users cannot log in or post messages
+	Disabled bool `gorm:"not null;default:false"`
+}
+
+// NewBotUser returns a new bot user, with an email on a reserved domain
+func NewBotUser(name string) User {
+	return User{
+		Username: name,
+		Email:    strings.ToLower(name) + "@" + botEmailDomain,
+		Bot:      true,
+		Role:     RoleBot,
+	}
+}
+
+// GrantRole sets the role of the user. The bot role is kept for bot users,
+// which cannot log in, so that it matches the Bot flag.
+func (u *User) GrantRole(role string) error {
+	if u.Bot != (role == RoleBot) {
+		return ErrBotRole
+	}
+	u.Role = role
+	return nil
 }
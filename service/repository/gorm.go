@@ -0,0 +1,480 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+)
+
+// NewGorm returns the repositories of a gorm database
+func NewGorm(db *gorm.DB) Repositories {
+	return Repositories{
+		Users:    &gormUsers{db},
+		Rooms:    &gormRooms{db},
+		Messages: &gormMessages{db},
+		Audit:    &gormAudit{db},
+		Imports:  &gormImports{db},
+		Exports:  &gormExports{db},
+	}
+}
+
+// notFound translates the gorm not found error
+func notFound(err error) error {
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// duplicated translates the unique violation errors of the drivers
+func duplicated(err error) error {
+	switch e := err.(type) {
+	case *pq.Error:
+		if e.Code == "23505" {
+			return ErrDuplicated
+		}
+	default:
+		if sqliteDuplicated(err) {
+			return ErrDuplicated
+		}
+	}
+	return err
+}
+
+type gormUsers struct {
+	db *gorm.DB
+}
+
+func (r *gormUsers) Create(user *models.User) error {
+	return duplicated(r.db.Create(user).Error)
+}
+
+func (r *gormUsers) FindByUsername(username string) (models.User, error) {
+	var user models.User
+	err := r.db.Where("username = ?", username).First(&user).Error
+	return user, notFound(err)
+}
+
+func (r *gormUsers) FindByEmail(email string) (models.User, error) {
+	var user models.User
+	err := r.db.Where("lower(email) = ?", strings.ToLower(email)).First(&user).Error
+	return user, notFound(err)
+}
+
+func (r *gormUsers) List() ([]models.User, error) {
+	var users []models.User
+	err := r.db.Order("id").Find(&users).Error
+	return users, err
+}
+
+func (r *gormUsers) Update(user *models.User) error {
+	db := r.db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"username":   user.Username,
+		"password":   user.Password,
+		"email":      user.Email,
+		"first_name": user.FirstName,
+		"last_name":  user.LastName,
+		"bot":        user.Bot,
+		"role":       user.Role,
+		"disabled":   user.Disabled,
+	})
+	if db.Error != nil {
+		return duplicated(db.Error)
+	}
+	if db.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type gormRooms struct {
+	db *gorm.DB
+}
+
+func (r *gormRooms) Create(room *models.Room) error {
+	return r.db.Create(room).Error
+}
+
+func (r *gormRooms) Find(id uint) (models.Room, error) {
+	var room models.Room
+	err := r.db.Where("id = ?", id).First(&room).Error
+	return room, notFound(err)
+}
+
+func (r *gormRooms) List() ([]models.Room, error) {
+	var rooms []models.Room
+	err := r.db.Find(&rooms).Error
+	return rooms, err
+}
+
+func (r *gormRooms) ListAll() ([]models.Room, error) {
+	var rooms []models.Room
+	err := r.db.Unscoped().Order("id").Find(&rooms).Error
+	return rooms, err
+}
+
+func (r *gormRooms) UpdateRetention(id uint, days, messages *int, legalHold bool) error {
+	db := r.db.Model(&models.Room{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"retention_days":     days,
+		"retention_messages": messages,
+		"legal_hold":         legalHold,
+	})
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormRooms) Update(room *models.Room) error {
+	db := r.db.Model(&models.Room{}).Where("id = ?", room.ID).Updates(map[string]interface{}{
+		"name":     room.Name,
+		"archived": room.Archived,
+	})
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormRooms) Delete(id uint) error {
+	db := r.db.Where("id = ?", id).Delete(&models.Room{})
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type gormMessages struct {
+	db *gorm.DB
+}
+
+func (r *gormMessages) Create(message *models.Message) error {
+	return duplicated(r.db.Create(message).Error)
+}
+
+func (r *gormMessages) Find(id uint) (models.Message, error) {
+	var message models.Message
+	err := r.db.Where("id = ?", id).Preload("User").First(&message).Error
+	return message, notFound(err)
+}
+
+func (r *gormMessages) ListByRoom(roomID uint, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	err := r.db.Where("room_id = ?", roomID).Preload("User").Limit(limit).Order("created_at desc").Find(&messages).Error
+	return messages, err
+}
+
+func (r *gormMessages) CountExpired(roomID uint, cutoff Cutoff) (int, error) {
+	expired, err := r.expired(roomID, cutoff)
+	if err != nil || expired == nil {
+		return 0, err
+	}
+
+	var count int
+	err = expired.Count(&count).Error
+	return count, err
+}
+
+func (r *gormMessages) ExpiredIDs(roomID uint, cutoff Cutoff, limit int) ([]uint, error) {
+	expired, err := r.expired(roomID, cutoff)
+	if err != nil || expired == nil {
+		return nil, err
+	}
+
+	var ids []uint
+	err = expired.Order("id").Limit(limit).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// expired returns the query of the messages of a room past a cutoff, nil if
+// there are none
+func (r *gormMessages) expired(roomID uint, cutoff Cutoff) (*gorm.DB, error) {
+	var conditions []string
+	var args []interface{}
+
+	if !cutoff.Before.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, cutoff.Before)
+	}
+	if cutoff.Keep > 0 {
+		// Oldest kept message
+		var kept []uint
+		err := r.db.Model(&models.Message{}).Where("room_id = ?", roomID).
+			Order("id desc").Offset(cutoff.Keep-1).Limit(1).Pluck("id", &kept).Error
+		if err != nil {
+			return nil, err
+		}
+		if len(kept) > 0 {
+			conditions = append(conditions, "id < ?")
+			args = append(args, kept[0])
+		}
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	return r.db.Unscoped().Model(&models.Message{}).
+		Where("room_id = ?", roomID).
+		Where(strings.Join(conditions, " OR "), args...), nil
+}
+
+func (r *gormMessages) Purge(ids []uint, archive bool) error {
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	if archive {
+		err := tx.Exec(`INSERT INTO archived_messages (id, created_at, updated_at, deleted_at, text, user_id, room_id, result)
+			SELECT id, created_at, updated_at, deleted_at, text, user_id, room_id, result FROM messages WHERE id IN (?)`, ids).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Unscoped().Where("id IN (?)", ids).Delete(&models.Message{}).Error; err != nil {
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func (r *gormMessages) History(roomID uint, period Period, afterID uint, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	err := r.history(roomID, period).Where("id > ?", afterID).
+		Preload("User").Order("id").Limit(limit).Find(&messages).Error
+	return messages, err
+}
+
+func (r *gormMessages) CountHistory(roomID uint, period Period) (int, error) {
+	var count int
+	err := r.history(roomID, period).Count(&count).Error
+	return count, err
+}
+
+// history returns the query of the messages of a room created in a period
+func (r *gormMessages) history(roomID uint, period Period) *gorm.DB {
+	db := r.db.Unscoped().Model(&models.Message{}).Where("room_id = ?", roomID)
+	if !period.Since.IsZero() {
+		db = db.Where("created_at >= ?", period.Since)
+	}
+	if !period.Until.IsZero() {
+		db = db.Where("created_at < ?", period.Until)
+	}
+	return db
+}
+
+func (r *gormMessages) ArchivedHistory(roomID uint, period Period, afterID uint, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	err := r.archivedHistory(roomID, period).Where("id > ?", afterID).
+		Preload("User").Order("id").Limit(limit).Find(&messages).Error
+	return messages, err
+}
+
+func (r *gormMessages) CountArchivedHistory(roomID uint, period Period) (int, error) {
+	var count int
+	err := r.archivedHistory(roomID, period).Count(&count).Error
+	return count, err
+}
+
+// archivedHistory returns the query of the archived messages of a room
+// created in a period
+func (r *gormMessages) archivedHistory(roomID uint, period Period) *gorm.DB {
+	db := r.db.Unscoped().Table("archived_messages").Where("room_id = ?", roomID)
+	if !period.Since.IsZero() {
+		db = db.Where("created_at >= ?", period.Since)
+	}
+	if !period.Until.IsZero() {
+		db = db.Where("created_at < ?", period.Until)
+	}
+	return db
+}
+
+type gormAudit struct {
+	db *gorm.DB
+}
+
+func (r *gormAudit) Append(entry *models.AuditEntry) error {
+	return duplicated(r.db.Create(entry).Error)
+}
+
+func (r *gormAudit) Last() (models.AuditEntry, error) {
+	var entry models.AuditEntry
+	err := r.db.Order("id desc").First(&entry).Error
+	return entry, notFound(err)
+}
+
+func (r *gormAudit) List(filter AuditFilter) ([]models.AuditEntry, error) {
+	db := r.db
+	if filter.Actor != "" {
+		db = db.Where("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		db = db.Where("action = ?", filter.Action)
+	}
+	if filter.Target != "" {
+		db = db.Where("target = ?", filter.Target)
+	}
+	if !filter.Since.IsZero() {
+		db = db.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		db = db.Where("created_at < ?", filter.Until)
+	}
+	if filter.BeforeID > 0 {
+		db = db.Where("id < ?", filter.BeforeID)
+	}
+	if filter.Limit > 0 {
+		db = db.Limit(filter.Limit)
+	}
+
+	var entries []models.AuditEntry
+	err := db.Order("id desc").Find(&entries).Error
+	return entries, err
+}
+
+func (r *gormAudit) Chain(afterID uint, limit int) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	err := r.db.Where("id > ?", afterID).Order("id").Limit(limit).Find(&entries).Error
+	return entries, err
+}
+
+type gormImports struct {
+	db *gorm.DB
+}
+
+func (r *gormImports) Find(source, externalID string) (uint, error) {
+	var id uint
+	err := r.db.Table("imported_records").Where("source = ? AND external_id = ?", source, externalID).
+		Select("local_id").Row().Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
+
+func (r *gormImports) Save(source, externalID string, id uint) error {
+	err := r.db.Exec(`INSERT INTO imported_records (source, external_id, local_id) VALUES (?, ?, ?)`,
+		source, externalID, id).Error
+	return duplicated(err)
+}
+
+type gormExports struct {
+	db *gorm.DB
+}
+
+func (r *gormExports) Create(job *models.ExportJob) error {
+	return duplicated(r.db.Create(job).Error)
+}
+
+func (r *gormExports) Find(id string) (models.ExportJob, error) {
+	var job models.ExportJob
+	err := r.db.Where("id = ?", id).First(&job).Error
+	return job, notFound(err)
+}
+
+func (r *gormExports) List() ([]models.ExportJob, error) {
+	var jobs []models.ExportJob
+	err := r.db.Order("created_at desc, id").Find(&jobs).Error
+	return jobs, err
+}
+
+func (r *gormExports) CountPending() (int, error) {
+	var count int
+	err := r.db.Model(&models.ExportJob{}).Where("status = ?", models.ExportPending).Count(&count).Error
+	return count, err
+}
+
+func (r *gormExports) Claim(now time.Time) (models.ExportJob, error) {
+	for {
+		var job models.ExportJob
+		err := r.db.Where("status = ?", models.ExportPending).Order("created_at, id").First(&job).Error
+		if err != nil {
+			return job, notFound(err)
+		}
+
+		db := r.db.Model(&models.ExportJob{}).Where("id = ? AND status = ?", job.ID, models.ExportPending).
+			Updates(map[string]interface{}{"status": models.ExportRunning, "heartbeat_at": now})
+		if db.Error != nil {
+			return job, db.Error
+		}
+		if db.RowsAffected == 1 {
+			job.Status = models.ExportRunning
+			job.HeartbeatAt = &now
+			return job, nil
+		}
+		// Claimed by another instance meanwhile
+	}
+}
+
+func (r *gormExports) Heartbeat(id string, now time.Time) error {
+	db := r.db.Model(&models.ExportJob{}).Where("id = ? AND status = ?", id, models.ExportRunning).
+		Update("heartbeat_at", now)
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormExports) FailStale(since, now time.Time) ([]string, error) {
+	stale := r.db.Model(&models.ExportJob{}).
+		Where("status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)", models.ExportRunning, since)
+
+	var ids []string
+	if err := stale.Pluck("id", &ids).Error; err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	// Jobs reporting a heartbeat meanwhile are kept running
+	err := r.db.Model(&models.ExportJob{}).
+		Where("id IN (?) AND status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)", ids, models.ExportRunning, since).
+		Updates(map[string]interface{}{"status": models.ExportFailed, "error": staleError, "finished_at": now}).Error
+	return ids, err
+}
+
+func (r *gormExports) Update(job *models.ExportJob) error {
+	db := r.db.Model(&models.ExportJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"status":      job.Status,
+		"exported":    job.Exported,
+		"total":       job.Total,
+		"error":       job.Error,
+		"finished_at": job.FinishedAt,
+		"checksum":    job.Checksum,
+		"size":        job.Size,
+	})
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormExports) DeleteFinished(before time.Time) ([]string, error) {
+	finished := r.db.Model(&models.ExportJob{}).
+		Where("status IN (?) AND finished_at < ?", []string{models.ExportDone, models.ExportFailed}, before)
+
+	var ids []string
+	if err := finished.Pluck("id", &ids).Error; err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	err := r.db.Where("id IN (?)", ids).Delete(&models.ExportJob{}).Error
+	return ids, err
+}
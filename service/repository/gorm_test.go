@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/storage/storagetest"
+)
+
+func newGormTest(t *testing.T) (Repositories, sqlmock.Sqlmock) {
+	sqlDb, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	db, err := gorm.Open("postgres", sqlDb)
+	require.NoError(t, err)
+
+	return NewGorm(db), mock
+}
+
+func TestGormFindByUsername(t *testing.T) {
+	repos, mock := newGormTest(t)
+
+	mock.ExpectQuery(`SELECT (.+) FROM "users" WHERE (.+)username = \$1`).
+		WithArgs("jdoe").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "bot"}).AddRow(2, "jdoe", false))
+	mock.ExpectQuery(`SELECT (.+) FROM "users" WHERE (.+)username = \$1`).
+		WithArgs("nobody").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	user, err := repos.Users.FindByUsername("jdoe")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, user.ID)
+	assert.Equal(t, "jdoe", user.Username)
+
+	_, err = repos.Users.FindByUsername("nobody")
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGormFindByEmail(t *testing.T) {
+	repos, mock := newGormTest(t)
+
+	mock.ExpectQuery(`SELECT (.+) FROM "users" WHERE (.+)lower\(email\) = \$1`).
+		WithArgs("jdoe@mail.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email"}).AddRow(2, "jdoe", "JDoe@mail.com"))
+	mock.ExpectQuery(`SELECT (.+) FROM "users" WHERE (.+)lower\(email\) = \$1`).
+		WithArgs("nobody@mail.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	user, err := repos.Users.FindByEmail("JDoe@Mail.com")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, user.ID)
+
+	_, err = repos.Users.FindByEmail("nobody@mail.com")
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGormListByRoom(t *testing.T) {
+	repos, mock := newGormTest(t)
+
+	mock.ExpectQuery(`SELECT (.+) FROM "messages" WHERE (.+)room_id = \$1(.+) ORDER BY created_at desc LIMIT 50`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "text", "user_id", "room_id"}).AddRow(7, "Hi", 2, 3))
+	mock.ExpectQuery(`SELECT (.+) FROM "users" WHERE (.+)id" IN \(\$1\)`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(2, "jdoe"))
+
+	messages, err := repos.Messages.ListByRoom(3, 50)
+	assert.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "Hi", messages[0].Text)
+	assert.Equal(t, "jdoe", messages[0].User.Username)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGormSQLite(t *testing.T) {
+	db := storagetest.SQLite(t)
+	defer db.Close()
+	repos := NewGorm(db)
+
+	user := models.User{Username: "jdoe", Email: "jdoe@mail.com"}
+	require.NoError(t, repos.Users.Create(&user))
+	assert.Error(t, repos.Users.Create(&models.User{Username: "jdoe", Email: "other@mail.com"}))
+
+	room := models.Room{Name: "General"}
+	require.NoError(t, repos.Rooms.Create(&room))
+	found, err := repos.Rooms.Find(room.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "General", found.Name)
+	_, err = repos.Rooms.Find(room.ID + 1)
+	assert.Equal(t, ErrNotFound, err)
+
+	for _, text := range []string{"first", "second"} {
+		require.NoError(t, repos.Messages.Create(&models.Message{Text: text, UserID: user.ID, RoomID: room.ID}))
+	}
+	assert.Error(t, repos.Messages.Create(&models.Message{Text: "orphan", UserID: user.ID, RoomID: room.ID + 1}))
+
+	messages, err := repos.Messages.ListByRoom(room.ID, 50)
+	assert.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, "jdoe", messages[0].User.Username)
+
+	message, err := repos.Messages.Find(messages[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, messages[0].Text, message.Text)
+	assert.Equal(t, "jdoe", message.User.Username)
+	_, err = repos.Messages.Find(messages[0].ID + 10)
+	assert.Equal(t, ErrNotFound, err)
+
+	// Bot results are kept with their messages, and archived with them.
+	// Responses are posted once per correlation ID.
+	correlationID := "c1"
+	quote := models.Message{Text: "AAPL.US quote is $279.74 per share", UserID: user.ID, RoomID: room.ID, Result: `[{"symbol":"AAPL.US"}]`, CorrelationID: &correlationID}
+	require.NoError(t, repos.Messages.Create(&quote))
+	assert.Equal(t, ErrDuplicated, repos.Messages.Create(&models.Message{Text: "again", UserID: user.ID, RoomID: room.ID, CorrelationID: &correlationID}))
+	message, err = repos.Messages.Find(quote.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, quote.Result, message.Result)
+
+	require.NoError(t, repos.Messages.Purge([]uint{quote.ID}, true))
+	archived, err := repos.Messages.ArchivedHistory(room.ID, Period{}, 0, 10)
+	assert.NoError(t, err)
+	require.Len(t, archived, 1)
+	assert.Equal(t, quote.Result, archived[0].Result)
+}
+
+func TestGormAuditSQLite(t *testing.T) {
+	db := storagetest.SQLite(t)
+	defer db.Close()
+
+	testAuditRepository(t, NewGorm(db).Audit)
+}
+
+func TestGormImportsSQLite(t *testing.T) {
+	db := storagetest.SQLite(t)
+	defer db.Close()
+
+	testImportRepository(t, NewGorm(db).Imports)
+}
+
+func TestGormExportsSQLite(t *testing.T) {
+	db := storagetest.SQLite(t)
+	defer db.Close()
+
+	testExportRepository(t, NewGorm(db).Exports)
+}
+
+func TestGormUpdateSQLite(t *testing.T) {
+	db := storagetest.SQLite(t)
+	defer db.Close()
+
+	testUpdates(t, NewGorm(db))
+}
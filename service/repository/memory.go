@@ -0,0 +1,691 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+)
+
+// NewMemory returns repositories keeping the models in memory, enforcing
+// the unique fields and references of the database schema
+func NewMemory() Repositories {
+	s := &memoryStore{}
+	return Repositories{
+		Users:    &memoryUsers{s},
+		Rooms:    &memoryRooms{s},
+		Messages: &memoryMessages{s},
+		Audit:    &memoryAudit{s},
+		Imports:  &memoryImports{s},
+		Exports:  &memoryExports{s},
+	}
+}
+
+// memoryStore holds the models of every repository, in creation order
+type memoryStore struct {
+	mu       sync.RWMutex
+	users    []models.User
+	rooms    []models.Room
+	messages []models.Message
+	// Purged messages with archive
+	archived []models.Message
+	// Messages are purged, so their IDs are not their positions
+	lastMessageID uint
+	audit         []models.AuditEntry
+	// Imported model IDs by source and external ID
+	imports map[[2]string]uint
+	exports []models.ExportJob
+}
+
+func (s *memoryStore) user(id uint) (models.User, bool) {
+	// IDs are assigned sequentially from 1
+	if id == 0 || int(id) > len(s.users) {
+		return models.User{}, false
+	}
+	return s.users[id-1], true
+}
+
+// room returns a room not soft deleted, like gorm
+func (s *memoryStore) room(id uint) (models.Room, bool) {
+	if id == 0 || int(id) > len(s.rooms) || s.rooms[id-1].DeletedAt != nil {
+		return models.Room{}, false
+	}
+	return s.rooms[id-1], true
+}
+
+// setCreatedAt sets the creation and update times of a new model, unless
+// they are given like gorm does
+func setCreatedAt(model *gorm.Model) {
+	now := time.Now()
+	if model.CreatedAt.IsZero() {
+		model.CreatedAt = now
+	}
+	if model.UpdatedAt.IsZero() {
+		model.UpdatedAt = now
+	}
+}
+
+type memoryUsers struct {
+	s *memoryStore
+}
+
+func (r *memoryUsers) Create(user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, u := range r.s.users {
+		if u.Username == user.Username || u.Email == user.Email {
+			return ErrDuplicated
+		}
+	}
+
+	user.ID = uint(len(r.s.users) + 1)
+	setCreatedAt(&user.Model)
+	// Default of the column
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	r.s.users = append(r.s.users, *user)
+	return nil
+}
+
+func (r *memoryUsers) FindByUsername(username string) (models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, u := range r.s.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r *memoryUsers) FindByEmail(email string) (models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, u := range r.s.users {
+		if strings.EqualFold(u.Email, email) {
+			return u, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r *memoryUsers) List() ([]models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	return append([]models.User(nil), r.s.users...), nil
+}
+
+func (r *memoryUsers) Update(user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.user(user.ID)
+	if !ok {
+		return ErrNotFound
+	}
+	for _, u := range r.s.users {
+		if u.ID != user.ID && (u.Username == user.Username || u.Email == user.Email) {
+			return ErrDuplicated
+		}
+	}
+
+	// Only the fields of the user are updated, like gorm
+	updated := *user
+	updated.CreatedAt = stored.CreatedAt
+	updated.DeletedAt = stored.DeletedAt
+	updated.UpdatedAt = time.Now()
+	r.s.users[user.ID-1] = updated
+	return nil
+}
+
+type memoryRooms struct {
+	s *memoryStore
+}
+
+func (r *memoryRooms) Create(room *models.Room) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	room.ID = uint(len(r.s.rooms) + 1)
+	setCreatedAt(&room.Model)
+	r.s.rooms = append(r.s.rooms, *room)
+	return nil
+}
+
+func (r *memoryRooms) Find(id uint) (models.Room, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	room, ok := r.s.room(id)
+	if !ok {
+		return models.Room{}, ErrNotFound
+	}
+	return room, nil
+}
+
+func (r *memoryRooms) List() ([]models.Room, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var rooms []models.Room
+	for _, room := range r.s.rooms {
+		if room.DeletedAt == nil {
+			rooms = append(rooms, room)
+		}
+	}
+	return rooms, nil
+}
+
+func (r *memoryRooms) ListAll() ([]models.Room, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	return append([]models.Room(nil), r.s.rooms...), nil
+}
+
+func (r *memoryRooms) UpdateRetention(id uint, days, messages *int, legalHold bool) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.room(id); !ok {
+		return ErrNotFound
+	}
+
+	room := &r.s.rooms[id-1]
+	room.RetentionDays = copyInt(days)
+	room.RetentionMessages = copyInt(messages)
+	room.LegalHold = legalHold
+	room.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *memoryRooms) Update(room *models.Room) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.room(room.ID); !ok {
+		return ErrNotFound
+	}
+
+	stored := &r.s.rooms[room.ID-1]
+	stored.Name = room.Name
+	stored.Archived = room.Archived
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *memoryRooms) Delete(id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.room(id); !ok {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	r.s.rooms[id-1].DeletedAt = &now
+	return nil
+}
+
+func copyInt(i *int) *int {
+	if i == nil {
+		return nil
+	}
+	v := *i
+	return &v
+}
+
+type memoryMessages struct {
+	s *memoryStore
+}
+
+func (r *memoryMessages) Create(message *models.Message) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.user(message.UserID); !ok {
+		return fmt.Errorf("user %d does not exist", message.UserID)
+	}
+	if _, ok := r.s.room(message.RoomID); !ok {
+		return fmt.Errorf("room %d does not exist", message.RoomID)
+	}
+	if message.CorrelationID != nil {
+		for _, m := range r.s.messages {
+			if m.CorrelationID != nil && *m.CorrelationID == *message.CorrelationID {
+				return ErrDuplicated
+			}
+		}
+	}
+
+	r.s.lastMessageID++
+	message.ID = r.s.lastMessageID
+	setCreatedAt(&message.Model)
+	stored := *message
+	stored.User = nil
+	r.s.messages = append(r.s.messages, stored)
+	return nil
+}
+
+func (r *memoryMessages) Find(id uint) (models.Message, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, m := range r.s.messages {
+		if m.ID == id && m.DeletedAt == nil {
+			user, _ := r.s.user(m.UserID)
+			m.User = &user
+			return m, nil
+		}
+	}
+	return models.Message{}, ErrNotFound
+}
+
+func (r *memoryMessages) ListByRoom(roomID uint, limit int) ([]models.Message, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var messages []models.Message
+	for i := len(r.s.messages) - 1; i >= 0 && len(messages) < limit; i-- {
+		m := r.s.messages[i]
+		if m.RoomID != roomID || m.DeletedAt != nil {
+			continue
+		}
+		user, _ := r.s.user(m.UserID)
+		m.User = &user
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+func (r *memoryMessages) CountExpired(roomID uint, cutoff Cutoff) (int, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	return len(r.expired(roomID, cutoff, 0)), nil
+}
+
+func (r *memoryMessages) ExpiredIDs(roomID uint, cutoff Cutoff, limit int) ([]uint, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	return r.expired(roomID, cutoff, limit), nil
+}
+
+// expired returns the IDs of up to limit (all if zero) messages of a room
+// past a cutoff
+func (r *memoryMessages) expired(roomID uint, cutoff Cutoff, limit int) []uint {
+	// Messages before the oldest kept one, counting visible messages from
+	// the newest
+	var keptID uint
+	if cutoff.Keep > 0 {
+		visible := 0
+		for i := len(r.s.messages) - 1; i >= 0 && visible < cutoff.Keep; i-- {
+			m := r.s.messages[i]
+			if m.RoomID == roomID && m.DeletedAt == nil {
+				visible++
+				keptID = m.ID
+			}
+		}
+		if visible < cutoff.Keep {
+			keptID = 0
+		}
+	}
+
+	var ids []uint
+	for _, m := range r.s.messages {
+		if limit > 0 && len(ids) == limit {
+			break
+		}
+		if m.RoomID != roomID {
+			continue
+		}
+		if (!cutoff.Before.IsZero() && m.CreatedAt.Before(cutoff.Before)) || m.ID < keptID {
+			ids = append(ids, m.ID)
+		}
+	}
+	return ids
+}
+
+func (r *memoryMessages) Purge(ids []uint, archive bool) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	purged := make(map[uint]bool)
+	for _, id := range ids {
+		purged[id] = true
+	}
+
+	kept := r.s.messages[:0]
+	for _, m := range r.s.messages {
+		if !purged[m.ID] {
+			kept = append(kept, m)
+			continue
+		}
+		if archive {
+			r.s.archived = append(r.s.archived, m)
+		}
+	}
+	r.s.messages = kept
+	return nil
+}
+
+func (r *memoryMessages) History(roomID uint, period Period, afterID uint, limit int) ([]models.Message, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var messages []models.Message
+	for _, m := range r.s.messages {
+		if len(messages) == limit {
+			break
+		}
+		if m.ID <= afterID || !inHistory(m, roomID, period) {
+			continue
+		}
+		user, _ := r.s.user(m.UserID)
+		m.User = &user
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+func (r *memoryMessages) CountHistory(roomID uint, period Period) (int, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	count := 0
+	for _, m := range r.s.messages {
+		if inHistory(m, roomID, period) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryMessages) ArchivedHistory(roomID uint, period Period, afterID uint, limit int) ([]models.Message, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	// Messages are archived by purge, not by ID
+	archived := append([]models.Message(nil), r.s.archived...)
+	sort.Slice(archived, func(i, j int) bool { return archived[i].ID < archived[j].ID })
+
+	var messages []models.Message
+	for _, m := range archived {
+		if len(messages) == limit {
+			break
+		}
+		if m.ID <= afterID || !inHistory(m, roomID, period) {
+			continue
+		}
+		user, _ := r.s.user(m.UserID)
+		m.User = &user
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+func (r *memoryMessages) CountArchivedHistory(roomID uint, period Period) (int, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	count := 0
+	for _, m := range r.s.archived {
+		if inHistory(m, roomID, period) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// inHistory returns true if a message belongs to a room and was created in
+// a period
+func inHistory(m models.Message, roomID uint, period Period) bool {
+	return m.RoomID == roomID &&
+		(period.Since.IsZero() || !m.CreatedAt.Before(period.Since)) &&
+		(period.Until.IsZero() || m.CreatedAt.Before(period.Until))
+}
+
+type memoryAudit struct {
+	s *memoryStore
+}
+
+func (r *memoryAudit) Append(entry *models.AuditEntry) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, e := range r.s.audit {
+		if e.PrevHash == entry.PrevHash {
+			return ErrDuplicated
+		}
+	}
+
+	entry.ID = uint(len(r.s.audit) + 1)
+	r.s.audit = append(r.s.audit, *entry)
+	return nil
+}
+
+func (r *memoryAudit) Last() (models.AuditEntry, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	if len(r.s.audit) == 0 {
+		return models.AuditEntry{}, ErrNotFound
+	}
+	return r.s.audit[len(r.s.audit)-1], nil
+}
+
+func (r *memoryAudit) List(filter AuditFilter) ([]models.AuditEntry, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var entries []models.AuditEntry
+	for i := len(r.s.audit) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+		e := r.s.audit[i]
+		if (filter.Actor != "" && e.Actor != filter.Actor) ||
+			(filter.Action != "" && e.Action != filter.Action) ||
+			(filter.Target != "" && e.Target != filter.Target) ||
+			(!filter.Since.IsZero() && e.CreatedAt.Before(filter.Since)) ||
+			(!filter.Until.IsZero() && !e.CreatedAt.Before(filter.Until)) ||
+			(filter.BeforeID > 0 && e.ID >= filter.BeforeID) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (r *memoryAudit) Chain(afterID uint, limit int) ([]models.AuditEntry, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	// IDs are assigned sequentially from 1
+	if int(afterID) >= len(r.s.audit) {
+		return nil, nil
+	}
+	entries := r.s.audit[afterID:]
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return append([]models.AuditEntry(nil), entries...), nil
+}
+
+type memoryImports struct {
+	s *memoryStore
+}
+
+func (r *memoryImports) Find(source, externalID string) (uint, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	id, ok := r.s.imports[[2]string{source, externalID}]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return id, nil
+}
+
+func (r *memoryImports) Save(source, externalID string, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	key := [2]string{source, externalID}
+	if _, ok := r.s.imports[key]; ok {
+		return ErrDuplicated
+	}
+	if r.s.imports == nil {
+		r.s.imports = make(map[[2]string]uint)
+	}
+	r.s.imports[key] = id
+	return nil
+}
+
+type memoryExports struct {
+	s *memoryStore
+}
+
+func (r *memoryExports) Create(job *models.ExportJob) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, j := range r.s.exports {
+		if j.ID == job.ID {
+			return ErrDuplicated
+		}
+	}
+	r.s.exports = append(r.s.exports, *job)
+	return nil
+}
+
+func (r *memoryExports) Find(id string) (models.ExportJob, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, j := range r.s.exports {
+		if j.ID == id {
+			return j, nil
+		}
+	}
+	return models.ExportJob{}, ErrNotFound
+}
+
+func (r *memoryExports) List() ([]models.ExportJob, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	jobs := append([]models.ExportJob(nil), r.s.exports...)
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+func (r *memoryExports) CountPending() (int, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	count := 0
+	for _, j := range r.s.exports {
+		if j.Status == models.ExportPending {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryExports) Claim(now time.Time) (models.ExportJob, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	oldest := -1
+	for i, j := range r.s.exports {
+		if j.Status == models.ExportPending && (oldest < 0 || j.CreatedAt.Before(r.s.exports[oldest].CreatedAt)) {
+			oldest = i
+		}
+	}
+	if oldest < 0 {
+		return models.ExportJob{}, ErrNotFound
+	}
+	r.s.exports[oldest].Status = models.ExportRunning
+	r.s.exports[oldest].HeartbeatAt = &now
+	return r.s.exports[oldest], nil
+}
+
+func (r *memoryExports) Heartbeat(id string, now time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for i, j := range r.s.exports {
+		if j.ID == id && j.Status == models.ExportRunning {
+			r.s.exports[i].HeartbeatAt = &now
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryExports) FailStale(since, now time.Time) ([]string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var ids []string
+	for i, j := range r.s.exports {
+		if j.Status == models.ExportRunning && (j.HeartbeatAt == nil || j.HeartbeatAt.Before(since)) {
+			r.s.exports[i].Status = models.ExportFailed
+			r.s.exports[i].Error = staleError
+			r.s.exports[i].FinishedAt = &now
+			ids = append(ids, j.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (r *memoryExports) Update(job *models.ExportJob) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for i, j := range r.s.exports {
+		if j.ID == job.ID {
+			j.Status = job.Status
+			j.Exported = job.Exported
+			j.Total = job.Total
+			j.Error = job.Error
+			j.FinishedAt = job.FinishedAt
+			j.Checksum = job.Checksum
+			j.Size = job.Size
+			r.s.exports[i] = j
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryExports) DeleteFinished(before time.Time) ([]string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var ids []string
+	kept := r.s.exports[:0]
+	for _, j := range r.s.exports {
+		finished := j.Status == models.ExportDone || j.Status == models.ExportFailed
+		if finished && j.FinishedAt != nil && j.FinishedAt.Before(before) {
+			ids = append(ids, j.ID)
+			continue
+		}
+		kept = append(kept, j)
+	}
+	r.s.exports = kept
+	return ids, nil
+}
@@ -0,0 +1,461 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+)
+
+func TestMemoryUsers(t *testing.T) {
+	users := NewMemory().Users
+
+	user := models.User{Username: "jdoe", Email: "jdoe@mail.com"}
+	require.NoError(t, users.Create(&user))
+	assert.EqualValues(t, 1, user.ID)
+	assert.False(t, user.CreatedAt.IsZero())
+
+	found, err := users.FindByUsername("jdoe")
+	assert.NoError(t, err)
+	assert.Equal(t, user, found)
+
+	_, err = users.FindByUsername("nobody")
+	assert.Equal(t, ErrNotFound, err)
+
+	found, err = users.FindByEmail("JDoe@Mail.com")
+	assert.NoError(t, err)
+	assert.Equal(t, user, found)
+
+	_, err = users.FindByEmail("nobody@mail.com")
+	assert.Equal(t, ErrNotFound, err)
+
+	// Usernames and emails are unique
+	assert.Equal(t, ErrDuplicated, users.Create(&models.User{Username: "jdoe", Email: "other@mail.com"}))
+	assert.Equal(t, ErrDuplicated, users.Create(&models.User{Username: "other", Email: "jdoe@mail.com"}))
+}
+
+func TestMemoryRooms(t *testing.T) {
+	rooms := NewMemory().Rooms
+
+	list, err := rooms.List()
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+
+	general, random := models.Room{Name: "General"}, models.Room{Name: "Random"}
+	require.NoError(t, rooms.Create(&general))
+	require.NoError(t, rooms.Create(&random))
+
+	found, err := rooms.Find(random.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, random, found)
+
+	_, err = rooms.Find(3)
+	assert.Equal(t, ErrNotFound, err)
+
+	list, err = rooms.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Room{general, random}, list)
+}
+
+func TestMemoryMessages(t *testing.T) {
+	repos := NewMemory()
+
+	user := models.User{Username: "jdoe", Email: "jdoe@mail.com"}
+	require.NoError(t, repos.Users.Create(&user))
+	general, random := models.Room{Name: "General"}, models.Room{Name: "Random"}
+	require.NoError(t, repos.Rooms.Create(&general))
+	require.NoError(t, repos.Rooms.Create(&random))
+
+	for _, m := range []models.Message{
+		{Text: "first", UserID: user.ID, RoomID: general.ID},
+		{Text: "elsewhere", UserID: user.ID, RoomID: random.ID},
+		{Text: "second", UserID: user.ID, RoomID: general.ID},
+		{Text: "third", UserID: user.ID, RoomID: general.ID},
+	} {
+		require.NoError(t, repos.Messages.Create(&m))
+		assert.NotZero(t, m.ID)
+	}
+
+	// Newest first, with their users
+	messages, err := repos.Messages.ListByRoom(general.ID, 2)
+	assert.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, "third", messages[0].Text)
+	assert.Equal(t, "second", messages[1].Text)
+	assert.Equal(t, "jdoe", messages[0].User.Username)
+
+	found, err := repos.Messages.Find(messages[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", found.Text)
+	assert.Equal(t, "jdoe", found.User.Username)
+	_, err = repos.Messages.Find(5)
+	assert.Equal(t, ErrNotFound, err)
+
+	// Users and rooms must exist
+	assert.EqualError(t, repos.Messages.Create(&models.Message{UserID: 2, RoomID: general.ID}), "user 2 does not exist")
+	assert.EqualError(t, repos.Messages.Create(&models.Message{UserID: user.ID, RoomID: 3}), "room 3 does not exist")
+
+	// Correlation IDs are unique
+	correlationID := "c1"
+	require.NoError(t, repos.Messages.Create(&models.Message{Text: "quote", UserID: user.ID, RoomID: general.ID, CorrelationID: &correlationID}))
+	assert.Equal(t, ErrDuplicated, repos.Messages.Create(&models.Message{Text: "quote", UserID: user.ID, RoomID: general.ID, CorrelationID: &correlationID}))
+}
+
+func TestMemoryPurge(t *testing.T) {
+	repos := NewMemory()
+	messages := repos.Messages.(*memoryMessages)
+
+	user := models.User{Username: "jdoe", Email: "jdoe@mail.com"}
+	require.NoError(t, repos.Users.Create(&user))
+	general, random := models.Room{Name: "General"}, models.Room{Name: "Random"}
+	require.NoError(t, repos.Rooms.Create(&general))
+	require.NoError(t, repos.Rooms.Create(&random))
+	for _, room := range []models.Room{general, random, general, general, general} {
+		require.NoError(t, repos.Messages.Create(&models.Message{UserID: user.ID, RoomID: room.ID}))
+	}
+
+	// The newest message of General is soft deleted
+	deletedAt := time.Now()
+	messages.s.messages[4].DeletedAt = &deletedAt
+
+	count, err := repos.Messages.CountExpired(general.ID, Cutoff{Keep: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	count, err = repos.Messages.CountExpired(general.ID, Cutoff{Before: time.Now().Add(time.Minute)})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+	count, err = repos.Messages.CountExpired(general.ID, Cutoff{})
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+
+	ids, err := repos.Messages.ExpiredIDs(general.ID, Cutoff{Keep: 1}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{1}, ids)
+
+	require.NoError(t, repos.Messages.Purge([]uint{1, 3}, true))
+	assert.Len(t, messages.s.messages, 3)
+	assert.Len(t, messages.s.archived, 2)
+
+	// Archived messages of General, with their users
+	archived, err := repos.Messages.ArchivedHistory(general.ID, Period{}, 0, 10)
+	assert.NoError(t, err)
+	require.Len(t, archived, 2)
+	assert.EqualValues(t, 1, archived[0].ID)
+	assert.Equal(t, "jdoe", archived[1].User.Username)
+	count, err = repos.Messages.CountArchivedHistory(random.ID, Period{})
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+
+	// IDs are not reused after a purge
+	m := models.Message{UserID: user.ID, RoomID: random.ID}
+	require.NoError(t, repos.Messages.Create(&m))
+	assert.EqualValues(t, 6, m.ID)
+}
+
+func TestMemoryUpdateRetention(t *testing.T) {
+	rooms := NewMemory().Rooms
+
+	room := models.Room{Name: "General"}
+	require.NoError(t, rooms.Create(&room))
+
+	days := 30
+	require.NoError(t, rooms.UpdateRetention(room.ID, &days, nil, true))
+	days = 1
+
+	found, err := rooms.Find(room.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 30, *found.RetentionDays)
+	assert.Nil(t, found.RetentionMessages)
+	assert.True(t, found.LegalHold)
+
+	assert.Equal(t, ErrNotFound, rooms.UpdateRetention(2, nil, nil, false))
+}
+
+func TestMemoryAudit(t *testing.T) {
+	testAuditRepository(t, NewMemory().Audit)
+}
+
+// testAuditRepository checks an empty audit repository
+func testAuditRepository(t *testing.T, audit AuditRepository) {
+	_, err := audit.Last()
+	assert.Equal(t, ErrNotFound, err)
+
+	start := time.Date(2019, 12, 20, 12, 0, 0, 0, time.UTC)
+	for i, e := range []models.AuditEntry{
+		{Actor: "jdoe", Action: "auth.login", PrevHash: "", Hash: "a"},
+		{Actor: "jane", Action: "auth.login", PrevHash: "a", Hash: "b"},
+		{Actor: "jdoe", Action: "room.create", Target: "room:1", PrevHash: "b", Hash: "c"},
+	} {
+		e.CreatedAt = start.Add(time.Duration(i) * time.Hour)
+		require.NoError(t, audit.Append(&e))
+		assert.EqualValues(t, i+1, e.ID)
+	}
+
+	// Entries cannot fork the chain
+	assert.Equal(t, ErrDuplicated, audit.Append(&models.AuditEntry{Action: "auth.login", PrevHash: "b", Hash: "d"}))
+
+	last, err := audit.Last()
+	assert.NoError(t, err)
+	assert.Equal(t, "c", last.Hash)
+
+	tests := []struct {
+		filter AuditFilter
+		hashes []string
+	}{
+		{AuditFilter{}, []string{"c", "b", "a"}},
+		{AuditFilter{Actor: "jdoe"}, []string{"c", "a"}},
+		{AuditFilter{Action: "auth.login", Limit: 1}, []string{"b"}},
+		{AuditFilter{Target: "room:1"}, []string{"c"}},
+		{AuditFilter{Since: start.Add(time.Hour)}, []string{"c", "b"}},
+		{AuditFilter{Until: start.Add(time.Hour)}, []string{"a"}},
+		{AuditFilter{BeforeID: 3, Limit: 1}, []string{"b"}},
+		{AuditFilter{Actor: "nobody"}, nil},
+	}
+	for _, test := range tests {
+		entries, err := audit.List(test.filter)
+		assert.NoError(t, err)
+		var hashes []string
+		for _, e := range entries {
+			hashes = append(hashes, e.Hash)
+		}
+		assert.Equal(t, test.hashes, hashes, "%+v", test.filter)
+	}
+
+	chain, err := audit.Chain(1, 10)
+	assert.NoError(t, err)
+	require.Len(t, chain, 2)
+	assert.Equal(t, "b", chain[0].Hash)
+	assert.Equal(t, "room:1", chain[1].Target)
+	chain, err = audit.Chain(0, 1)
+	assert.NoError(t, err)
+	require.Len(t, chain, 1)
+	assert.Equal(t, "a", chain[0].Hash)
+	chain, err = audit.Chain(3, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, chain)
+}
+
+func TestMemoryHistory(t *testing.T) {
+	repos := NewMemory()
+	messages := repos.Messages.(*memoryMessages)
+
+	user := models.User{Username: "jdoe", Email: "jdoe@mail.com"}
+	require.NoError(t, repos.Users.Create(&user))
+	general, random := models.Room{Name: "General"}, models.Room{Name: "Random"}
+	require.NoError(t, repos.Rooms.Create(&general))
+	require.NoError(t, repos.Rooms.Create(&random))
+	for _, room := range []models.Room{general, random, general, general} {
+		require.NoError(t, repos.Messages.Create(&models.Message{UserID: user.ID, RoomID: room.ID}))
+	}
+
+	// Soft deleted messages are included
+	deletedAt := time.Now()
+	messages.s.messages[3].DeletedAt = &deletedAt
+	// The first message is a day old
+	messages.s.messages[0].CreatedAt = messages.s.messages[0].CreatedAt.AddDate(0, 0, -1)
+
+	count, err := repos.Messages.CountHistory(general.ID, Period{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	count, err = repos.Messages.CountHistory(general.ID, Period{Since: time.Now().Add(-time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	count, err = repos.Messages.CountHistory(general.ID, Period{Until: time.Now().Add(-time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	history, err := repos.Messages.History(general.ID, Period{}, 1, 10)
+	assert.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.EqualValues(t, 3, history[0].ID)
+	assert.EqualValues(t, 4, history[1].ID)
+	assert.NotNil(t, history[1].DeletedAt)
+	assert.Equal(t, "jdoe", history[1].User.Username)
+
+	history, err = repos.Messages.History(general.ID, Period{}, 0, 1)
+	assert.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.EqualValues(t, 1, history[0].ID)
+}
+
+func TestMemoryImports(t *testing.T) {
+	testImportRepository(t, NewMemory().Imports)
+}
+
+// testImportRepository checks an empty import repository
+func testImportRepository(t *testing.T, imports ImportRepository) {
+	_, err := imports.Find("slack:user", "U01")
+	assert.Equal(t, ErrNotFound, err)
+
+	require.NoError(t, imports.Save("slack:user", "U01", 3))
+	require.NoError(t, imports.Save("slack:channel", "U01", 1))
+	assert.Equal(t, ErrDuplicated, imports.Save("slack:user", "U01", 4))
+
+	id, err := imports.Find("slack:user", "U01")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, id)
+	id, err = imports.Find("slack:channel", "U01")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, id)
+}
+
+func TestMemoryUpdate(t *testing.T) {
+	testUpdates(t, NewMemory())
+}
+
+// testUpdates checks the updates of users and rooms, and the deletion of
+// rooms, on empty repositories
+func testUpdates(t *testing.T, repos Repositories) {
+	user := models.User{Username: "jdoe", Email: "jdoe@mail.com", Password: "secret"}
+	require.NoError(t, repos.Users.Create(&user))
+	assert.Equal(t, models.RoleUser, user.Role)
+	require.NoError(t, repos.Users.Create(&models.User{Username: "jane", Email: "jane@mail.com"}))
+
+	user.Password = "changed"
+	user.Role = models.RoleModerator
+	user.Disabled = true
+	require.NoError(t, repos.Users.Update(&user))
+
+	found, err := repos.Users.FindByUsername("jdoe")
+	require.NoError(t, err)
+	assert.Equal(t, "changed", found.Password)
+	assert.Equal(t, models.RoleModerator, found.Role)
+	assert.True(t, found.Disabled)
+	assert.Equal(t, user.CreatedAt.Unix(), found.CreatedAt.Unix())
+
+	user.Username = "jane"
+	assert.Equal(t, ErrDuplicated, repos.Users.Update(&user))
+	assert.Equal(t, ErrNotFound, repos.Users.Update(&models.User{Model: gorm.Model{ID: 3}, Username: "nobody", Email: "nobody@mail.com"}))
+
+	users, err := repos.Users.List()
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, "jdoe", users[0].Username)
+	assert.Equal(t, "jane", users[1].Username)
+
+	room := models.Room{Name: "General"}
+	require.NoError(t, repos.Rooms.Create(&room))
+	days := 30
+	require.NoError(t, repos.Rooms.UpdateRetention(room.ID, &days, nil, false))
+
+	// Retention settings are kept
+	room.Name = "Lobby"
+	room.Archived = true
+	require.NoError(t, repos.Rooms.Update(&room))
+	foundRoom, err := repos.Rooms.Find(room.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Lobby", foundRoom.Name)
+	assert.True(t, foundRoom.Archived)
+	assert.Equal(t, 30, *foundRoom.RetentionDays)
+
+	assert.Equal(t, ErrNotFound, repos.Rooms.Update(&models.Room{Model: gorm.Model{ID: 2}, Name: "Random"}))
+
+	// Deleted rooms are not found
+	require.NoError(t, repos.Rooms.Delete(room.ID))
+	_, err = repos.Rooms.Find(room.ID)
+	assert.Equal(t, ErrNotFound, err)
+	rooms, err := repos.Rooms.List()
+	require.NoError(t, err)
+	assert.Empty(t, rooms)
+	rooms, err = repos.Rooms.ListAll()
+	require.NoError(t, err)
+	require.Len(t, rooms, 1)
+	assert.Equal(t, room.ID, rooms[0].ID)
+	assert.NotNil(t, rooms[0].DeletedAt)
+	assert.Equal(t, ErrNotFound, repos.Rooms.Delete(room.ID))
+	assert.Equal(t, ErrNotFound, repos.Rooms.Update(&room))
+}
+
+func TestMemoryExports(t *testing.T) {
+	testExportRepository(t, NewMemory().Exports)
+}
+
+// testExportRepository checks an empty export repository
+func testExportRepository(t *testing.T, exports ExportRepository) {
+	start := time.Date(2019, 12, 20, 12, 0, 0, 0, time.UTC)
+
+	_, err := exports.Claim(start)
+	assert.Equal(t, ErrNotFound, err)
+
+	for i, id := range []string{"a", "b", "c"} {
+		job := models.ExportJob{
+			ID:        id,
+			RoomIDs:   "1,2",
+			Formats:   "jsonl",
+			Until:     start,
+			Status:    models.ExportPending,
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		}
+		require.NoError(t, exports.Create(&job))
+	}
+	assert.Equal(t, ErrDuplicated, exports.Create(&models.ExportJob{ID: "a", Status: models.ExportPending, CreatedAt: start}))
+
+	count, err := exports.CountPending()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	// Oldest first, once
+	job, err := exports.Claim(start)
+	require.NoError(t, err)
+	assert.Equal(t, "a", job.ID)
+	assert.Equal(t, models.ExportRunning, job.Status)
+	require.NotNil(t, job.HeartbeatAt)
+	assert.True(t, start.Equal(*job.HeartbeatAt))
+	job, err = exports.Claim(start)
+	require.NoError(t, err)
+	assert.Equal(t, "b", job.ID)
+
+	// Running jobs without a recent heartbeat are failed
+	require.NoError(t, exports.Heartbeat("b", start.Add(10*time.Minute)))
+	assert.Equal(t, ErrNotFound, exports.Heartbeat("c", start))
+	ids, err := exports.FailStale(start.Add(5*time.Minute), start.Add(10*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, ids)
+	stale, err := exports.Find("a")
+	require.NoError(t, err)
+	assert.Equal(t, models.ExportFailed, stale.Status)
+	assert.Contains(t, stale.Error, "interrupted")
+	require.NotNil(t, stale.FinishedAt)
+	assert.Equal(t, ErrNotFound, exports.Heartbeat("a", start))
+
+	finishedAt := start.Add(time.Hour)
+	job.Status = models.ExportDone
+	job.Exported, job.Total = 5, 5
+	job.FinishedAt = &finishedAt
+	job.Checksum, job.Size = "abc", 10
+	require.NoError(t, exports.Update(&job))
+	assert.Equal(t, ErrNotFound, exports.Update(&models.ExportJob{ID: "d"}))
+
+	found, err := exports.Find("b")
+	require.NoError(t, err)
+	assert.Equal(t, models.ExportDone, found.Status)
+	assert.Equal(t, 5, found.Exported)
+	assert.Equal(t, "abc", found.Checksum)
+	assert.Equal(t, "1,2", found.RoomIDs)
+	require.NotNil(t, found.FinishedAt)
+	assert.True(t, finishedAt.Equal(*found.FinishedAt))
+	_, err = exports.Find("d")
+	assert.Equal(t, ErrNotFound, err)
+
+	// Newest first
+	jobs, err := exports.List()
+	require.NoError(t, err)
+	require.Len(t, jobs, 3)
+	assert.Equal(t, "c", jobs[0].ID)
+	assert.Equal(t, "a", jobs[2].ID)
+
+	// Only finished jobs expire
+	ids, err = exports.DeleteFinished(start.Add(10 * time.Minute))
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+	ids, err = exports.DeleteFinished(finishedAt.Add(time.Second))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b"}, ids)
+	jobs, err = exports.List()
+	require.NoError(t, err)
+	assert.Len(t, jobs, 1)
+}
@@ -0,0 +1,186 @@
+// Package repository stores the chat models. Controllers and handlers
+// depend on its interfaces, implemented with gorm and in memory.
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+)
+
+var (
+	// ErrNotFound is returned when a record does not exist
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicated is returned when a unique field is already taken
+	ErrDuplicated = errors.New("record already exists")
+)
+
+// UserRepository stores the users
+type UserRepository interface {
+	// Create stores a new user, setting its ID
+	Create(user *models.User) error
+	// FindByUsername returns ErrNotFound if there is no such user
+	FindByUsername(username string) (models.User, error)
+	// FindByEmail returns ErrNotFound if there is no such user, comparing
+	// emails case insensitively
+	FindByEmail(email string) (models.User, error)
+	// List returns every user, by ID
+	List() ([]models.User, error)
+	// Update stores the fields of an existing user. Returns ErrNotFound if
+	// there is no such user, ErrDuplicated if its username or email is taken.
+	Update(user *models.User) error
+}
+
+// RoomRepository stores the rooms
+type RoomRepository interface {
+	// Create stores a new room, setting its ID
+	Create(room *models.Room) error
+	// Find returns ErrNotFound if there is no such room
+	Find(id uint) (models.Room, error)
+	List() ([]models.Room, error)
+	// ListAll returns every room, soft deleted ones included
+	ListAll() ([]models.Room, error)
+	// UpdateRetention sets the retention settings of a room
+	UpdateRetention(id uint, days, messages *int, legalHold bool) error
+	// Update stores the name and archived state of an existing room.
+	// Returns ErrNotFound if there is no such room.
+	Update(room *models.Room) error
+	// Delete soft deletes a room, keeping its messages. Returns ErrNotFound
+	// if there is no such room.
+	Delete(id uint) error
+}
+
+// MessageRepository stores the messages
+type MessageRepository interface {
+	// Create stores a new message, setting its ID and creation time.
+	// Returns ErrDuplicated if its correlation ID is taken.
+	Create(message *models.Message) error
+	// Find returns a message with its user. Returns ErrNotFound if there
+	// is no such message.
+	Find(id uint) (models.Message, error)
+	// ListByRoom returns the last messages of a room, newest first, with
+	// their users
+	ListByRoom(roomID uint, limit int) ([]models.Message, error)
+	// CountExpired counts the messages of a room past a cutoff, soft
+	// deleted ones included
+	CountExpired(roomID uint, cutoff Cutoff) (int, error)
+	// ExpiredIDs returns up to limit messages of a room past a cutoff,
+	// oldest first
+	ExpiredIDs(roomID uint, cutoff Cutoff, limit int) ([]uint, error)
+	// Purge deletes messages for good, copying them to the archive first
+	// if archive is set
+	Purge(ids []uint, archive bool) error
+	// History returns up to limit messages of a room created in a period,
+	// with IDs after afterID, oldest first. Soft deleted messages are
+	// included, with their users.
+	History(roomID uint, period Period, afterID uint, limit int) ([]models.Message, error)
+	// CountHistory counts the messages of a room created in a period, soft
+	// deleted ones included
+	CountHistory(roomID uint, period Period) (int, error)
+	// ArchivedHistory is History on the messages purged with archive
+	ArchivedHistory(roomID uint, period Period, afterID uint, limit int) ([]models.Message, error)
+	// CountArchivedHistory is CountHistory on the messages purged with
+	// archive
+	CountArchivedHistory(roomID uint, period Period) (int, error)
+}
+
+// Period of time, from Since up to Until excluded. Zero times are
+// unbounded.
+type Period struct {
+	Since time.Time
+	Until time.Time
+}
+
+// Cutoff of the messages expired by a retention policy
+type Cutoff struct {
+	// Messages created before are expired. Zero for no age limit.
+	Before time.Time
+	// Older messages than the Keep newest visible ones are expired. Zero
+	// for no count limit.
+	Keep int
+}
+
+// IsZero returns true if no message is expired
+func (c Cutoff) IsZero() bool {
+	return c.Before.IsZero() && c.Keep == 0
+}
+
+// AuditRepository stores the audit log. Entries are never changed or
+// deleted.
+type AuditRepository interface {
+	// Append stores an entry, setting its ID. Returns ErrDuplicated if
+	// another entry already follows its previous one.
+	Append(entry *models.AuditEntry) error
+	// Last returns ErrNotFound if the log is empty
+	Last() (models.AuditEntry, error)
+	// List returns the entries matching a filter, newest first
+	List(filter AuditFilter) ([]models.AuditEntry, error)
+	// Chain returns up to limit entries after an ID, oldest first
+	Chain(afterID uint, limit int) ([]models.AuditEntry, error)
+}
+
+// AuditFilter selects audit entries. Zero fields match every entry.
+type AuditFilter struct {
+	Actor  string
+	Action string
+	Target string
+	// Entries created at or after Since, and before Until
+	Since time.Time
+	Until time.Time
+	// Entries older than BeforeID, to page through the log
+	BeforeID uint
+	Limit    int
+}
+
+// ImportRepository maps the records of other chats to the models imported
+// from them
+type ImportRepository interface {
+	// Find returns the ID of the model imported from a record of a source
+	// (e.g. "slack:user"), ErrNotFound if it was not imported
+	Find(source, externalID string) (uint, error)
+	// Save records the model imported from a record
+	Save(source, externalID string, id uint) error
+}
+
+// Failure reason of the running jobs failed by FailStale
+const staleError = "export interrupted: its instance stopped"
+
+// ExportRepository stores the compliance export jobs, so every instance
+// can run and report them
+type ExportRepository interface {
+	// Create stores a new job
+	Create(job *models.ExportJob) error
+	// Find returns ErrNotFound if there is no such job
+	Find(id string) (models.ExportJob, error)
+	// List returns every job, newest first
+	List() ([]models.ExportJob, error)
+	// CountPending counts the jobs waiting to run
+	CountPending() (int, error)
+	// Claim marks the oldest pending job as running with a heartbeat at now
+	// and returns it, or ErrNotFound if there is none. Each job is claimed
+	// once.
+	Claim(now time.Time) (models.ExportJob, error)
+	// Heartbeat records that a running job is alive at now. Returns
+	// ErrNotFound if there is no such running job.
+	Heartbeat(id string, now time.Time) error
+	// FailStale fails the running jobs without a heartbeat since a time,
+	// whose instance stopped, finishing them at now. It returns their IDs.
+	FailStale(since, now time.Time) ([]string, error)
+	// Update stores the status, progress and outcome of a job. Returns
+	// ErrNotFound if there is no such job.
+	Update(job *models.ExportJob) error
+	// DeleteFinished deletes the done and failed jobs finished before a
+	// time, returning their IDs
+	DeleteFinished(before time.Time) ([]string, error)
+}
+
+// Repositories of every model
+type Repositories struct {
+	Users    UserRepository
+	Rooms    RoomRepository
+	Messages MessageRepository
+	Audit    AuditRepository
+	Imports  ImportRepository
+	Exports  ExportRepository
+}
@@ -0,0 +1,14 @@
+//go:build cgo
+// +build cgo
+
+package repository
+
+import (
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDuplicated reports whether err is a unique violation of SQLite
+func sqliteDuplicated(err error) bool {
+	e, ok := err.(sqlite3.Error)
+	return ok && (e.ExtendedCode == sqlite3.ErrConstraintUnique || e.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
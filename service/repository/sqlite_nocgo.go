@@ -0,0 +1,10 @@
+//go:build !cgo
+// +build !cgo
+
+package repository
+
+// sqliteDuplicated reports whether err is a unique violation of SQLite,
+// whose driver is not available without cgo
+func sqliteDuplicated(err error) bool {
+	return false
+}
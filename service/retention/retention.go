@@ -0,0 +1,197 @@
+// Package retention purges the messages expired by the retention policies
+// of their rooms.
+//
+// A message is expired when it is older than the age limit of its room, or
+// older than the newest messages kept by its count limit. Soft deleted
+// messages do not count towards the count limit, but are purged with the
+// others once expired. Rooms on legal hold are never purged.
+package retention
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+)
+
+// Policy limits the messages kept in a room. Zero values keep messages
+// forever.
+type Policy struct {
+	// Days messages are kept
+	Days int
+	// Newest messages kept
+	Messages int
+}
+
+// Of returns the policy of a room, overriding the global one with its own
+// settings
+func (p Policy) Of(room models.Room) Policy {
+	if room.RetentionDays != nil {
+		p.Days = *room.RetentionDays
+	}
+	if room.RetentionMessages != nil {
+		p.Messages = *room.RetentionMessages
+	}
+	return p
+}
+
+// cutoff returns the cutoff of the policy at a given time
+func (p Policy) cutoff(now time.Time) repository.Cutoff {
+	cutoff := repository.Cutoff{Keep: p.Messages}
+	if p.Days > 0 {
+		cutoff.Before = now.AddDate(0, 0, -p.Days)
+	}
+	return cutoff
+}
+
+// Config of the purge
+type Config struct {
+	// Policy of the rooms without their own settings
+	Global Policy
+	// Copy the messages to the archive before deleting them
+	Archive bool
+	// Messages deleted per transaction
+	BatchSize int
+	// Time between purges
+	Interval time.Duration
+	// Only report the expired messages on scheduled purges
+	DryRun bool
+}
+
+// RoomReport is the outcome of the purge of a room
+type RoomReport struct {
+	RoomID    uint
+	Name      string
+	Policy    Policy
+	LegalHold bool
+	// Messages purged, or that would be purged on dry runs
+	Expired int
+}
+
+// Report is the outcome of a purge
+type Report struct {
+	DryRun  bool
+	Archive bool
+	Rooms   []RoomReport
+	// Messages purged, or that would be purged on dry runs
+	Total int
+}
+
+// Purger deletes or archives the expired messages
+type Purger struct {
+	rooms    repository.RoomRepository
+	messages repository.MessageRepository
+	config   Config
+	now      func() time.Time
+}
+
+// NewPurger returns a purger of the messages of every room
+func NewPurger(rooms repository.RoomRepository, messages repository.MessageRepository, config Config) *Purger {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 500
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Hour
+	}
+
+	return &Purger{
+		rooms:    rooms,
+		messages: messages,
+		config:   config,
+		now:      time.Now,
+	}
+}
+
+// Run purges the expired messages every interval until ctx is done
+func (p *Purger) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := p.Purge(p.config.DryRun)
+		if err != nil {
+			return err
+		}
+		if report.Total > 0 {
+			p.log(report)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Purger) log(report Report) {
+	action := "Purged"
+	if report.DryRun {
+		action = "Would purge"
+	}
+	for _, room := range report.Rooms {
+		if room.Expired > 0 {
+			log.Printf("%s %d expired messages of room %d (%s)\n", action, room.Expired, room.RoomID, room.Name)
+		}
+	}
+}
+
+// Purge deletes or archives the expired messages of every room in batches.
+// With dryRun it only counts them.
+func (p *Purger) Purge(dryRun bool) (Report, error) {
+	report := Report{
+		DryRun:  dryRun,
+		Archive: p.config.Archive,
+	}
+
+	// Messages of soft deleted rooms are kept, and expire as well
+	rooms, err := p.rooms.ListAll()
+	if err != nil {
+		return report, err
+	}
+
+	now := p.now()
+	for _, room := range rooms {
+		r := RoomReport{
+			RoomID:    room.ID,
+			Name:      room.Name,
+			Policy:    p.config.Global.Of(room),
+			LegalHold: room.LegalHold,
+		}
+
+		cutoff := r.Policy.cutoff(now)
+		if !room.LegalHold && !cutoff.IsZero() {
+			if dryRun {
+				r.Expired, err = p.messages.CountExpired(room.ID, cutoff)
+			} else {
+				r.Expired, err = p.purgeRoom(room.ID, cutoff)
+			}
+		}
+
+		report.Total += r.Expired
+		report.Rooms = append(report.Rooms, r)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// purgeRoom purges the expired messages of a room and returns their count
+func (p *Purger) purgeRoom(roomID uint, cutoff repository.Cutoff) (int, error) {
+	purged := 0
+	for {
+		ids, err := p.messages.ExpiredIDs(roomID, cutoff, p.config.BatchSize)
+		if err != nil || len(ids) == 0 {
+			return purged, err
+		}
+
+		if err := p.messages.Purge(ids, p.config.Archive); err != nil {
+			return purged, err
+		}
+		purged += len(ids)
+	}
+}
@@ -0,0 +1,186 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/storage/storagetest"
+)
+
+var now = time.Date(2019, 12, 20, 12, 0, 0, 0, time.UTC)
+
+func intp(i int) *int {
+	return &i
+}
+
+// retentionTest has an SQLite database with 6 messages of 1 to 6 days ago
+// on each room: "General" (1), "Legal" (2) on legal hold, and "Keep5" (3)
+// keeping the newest 5 messages without age limit
+type retentionTest struct {
+	db    *gorm.DB
+	repos repository.Repositories
+}
+
+func newRetentionTest(t *testing.T) *retentionTest {
+	db := storagetest.SQLite(t)
+	rt := &retentionTest{db: db, repos: repository.NewGorm(db)}
+
+	user := models.User{Username: "jdoe", Email: "jdoe@mail.com"}
+	require.NoError(t, rt.repos.Users.Create(&user))
+
+	for _, name := range []string{"General", "Legal", "Keep5"} {
+		room := models.Room{Name: name}
+		require.NoError(t, rt.repos.Rooms.Create(&room))
+		for days := 6; days > 0; days-- {
+			require.NoError(t, db.Create(&models.Message{
+				Model:  gorm.Model{CreatedAt: now.AddDate(0, 0, -days)},
+				Text:   name,
+				UserID: user.ID,
+				RoomID: room.ID,
+			}).Error)
+		}
+	}
+	require.NoError(t, rt.repos.Rooms.UpdateRetention(2, nil, nil, true))
+	require.NoError(t, rt.repos.Rooms.UpdateRetention(3, intp(0), intp(5), false))
+
+	return rt
+}
+
+func (rt *retentionTest) purger(config Config) *Purger {
+	p := NewPurger(rt.repos.Rooms, rt.repos.Messages, config)
+	p.now = func() time.Time { return now }
+	return p
+}
+
+// remaining counts the messages of a table by room name, soft deleted ones
+// included
+func (rt *retentionTest) remaining(t *testing.T, table string) map[string]int {
+	rows, err := rt.db.DB().Query(`SELECT text, COUNT(*) FROM ` + table + ` GROUP BY text`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var text string
+		var count int
+		require.NoError(t, rows.Scan(&text, &count))
+		counts[text] = count
+	}
+	return counts
+}
+
+func TestPurge(t *testing.T) {
+	rt := newRetentionTest(t)
+	defer rt.db.Close()
+	p := rt.purger(Config{Global: Policy{Days: 3}, BatchSize: 2})
+
+	report, err := p.Purge(false)
+	require.NoError(t, err)
+	assert.Equal(t, Report{
+		Rooms: []RoomReport{
+			{RoomID: 1, Name: "General", Policy: Policy{Days: 3}, Expired: 3},
+			{RoomID: 2, Name: "Legal", Policy: Policy{Days: 3}, LegalHold: true},
+			{RoomID: 3, Name: "Keep5", Policy: Policy{Messages: 5}, Expired: 1},
+		},
+		Total: 4,
+	}, report)
+
+	assert.Equal(t, map[string]int{"General": 3, "Legal": 6, "Keep5": 5}, rt.remaining(t, "messages"))
+	assert.Empty(t, rt.remaining(t, "archived_messages"))
+
+	// Nothing left to purge
+	report, err = p.Purge(false)
+	require.NoError(t, err)
+	assert.Zero(t, report.Total)
+}
+
+func TestPurgeDryRun(t *testing.T) {
+	rt := newRetentionTest(t)
+	defer rt.db.Close()
+	p := rt.purger(Config{Global: Policy{Days: 3}})
+
+	report, err := p.Purge(true)
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 4, report.Total)
+
+	assert.Equal(t, map[string]int{"General": 6, "Legal": 6, "Keep5": 6}, rt.remaining(t, "messages"))
+}
+
+func TestPurgeArchive(t *testing.T) {
+	rt := newRetentionTest(t)
+	defer rt.db.Close()
+	p := rt.purger(Config{Global: Policy{Messages: 4}, Archive: true})
+
+	report, err := p.Purge(false)
+	require.NoError(t, err)
+	assert.True(t, report.Archive)
+	assert.Equal(t, 3, report.Total)
+
+	assert.Equal(t, map[string]int{"General": 4, "Legal": 6, "Keep5": 5}, rt.remaining(t, "messages"))
+	assert.Equal(t, map[string]int{"General": 2, "Keep5": 1}, rt.remaining(t, "archived_messages"))
+}
+
+func TestPurgeSoftDeleted(t *testing.T) {
+	rt := newRetentionTest(t)
+	defer rt.db.Close()
+	p := rt.purger(Config{Global: Policy{Messages: 3}})
+
+	// The newest message is soft deleted: it does not count towards the
+	// limit, and is only purged once expired
+	require.NoError(t, rt.db.Delete(&models.Message{Model: gorm.Model{ID: 6}}).Error)
+
+	report, err := p.Purge(false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Rooms[0].Expired)
+
+	var visible int
+	require.NoError(t, rt.db.Model(&models.Message{}).Where("room_id = 1").Count(&visible).Error)
+	assert.Equal(t, 3, visible)
+	assert.Equal(t, 4, rt.remaining(t, "messages")["General"])
+}
+
+func TestPurgeDeletedRoom(t *testing.T) {
+	rt := newRetentionTest(t)
+	defer rt.db.Close()
+	p := rt.purger(Config{Global: Policy{Days: 3}})
+
+	// The messages of deleted rooms are kept, so they expire as well
+	require.NoError(t, rt.repos.Rooms.Delete(1))
+	require.NoError(t, rt.repos.Rooms.Delete(2))
+
+	report, err := p.Purge(false)
+	require.NoError(t, err)
+	assert.Equal(t, 4, report.Total)
+	assert.Equal(t, map[string]int{"General": 3, "Legal": 6, "Keep5": 5}, rt.remaining(t, "messages"))
+}
+
+func TestRunStops(t *testing.T) {
+	rt := newRetentionTest(t)
+	defer rt.db.Close()
+	p := rt.purger(Config{Global: Policy{Days: 3}, Interval: time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Equal(t, 3, rt.remaining(t, "messages")["General"])
+}
+
+func TestPolicyOf(t *testing.T) {
+	global := Policy{Days: 30, Messages: 1000}
+
+	assert.Equal(t, global, global.Of(models.Room{}))
+	assert.Equal(t, Policy{Days: 0, Messages: 1000}, global.Of(models.Room{RetentionDays: intp(0)}))
+	assert.Equal(t, Policy{Days: 30, Messages: 10}, global.Of(models.Room{RetentionMessages: intp(10)}))
+}
@@ -0,0 +1,102 @@
+package slack
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/hernanrocha/fin-chat/service/repository"
+)
+
+// ErrUsage is returned for invalid import-slack arguments
+var ErrUsage = errors.New("usage: import-slack [-dry-run] [-link] <export directory or zip>")
+
+// Command runs the import-slack subcommand given by args, importing an
+// export in a transaction and writing its report to out. Dry runs roll the
+// import back, reporting what it would change.
+func Command(db *gorm.DB, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("import-slack", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	dryRun := flags.Bool("dry-run", false, "report the changes without importing them")
+	link := flags.Bool("link", false, "link the users to the existing users with the same username and email")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return ErrUsage
+	}
+
+	export, err := Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer export.Close()
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	importer := NewImporter(repository.NewGorm(tx))
+	importer.Link = *link
+	report, err := importer.Import(export)
+	if err != nil {
+		return err
+	}
+	report.Write(out)
+
+	if *dryRun {
+		fmt.Fprintln(out, "Dry run, nothing was imported")
+		return tx.Rollback().Error
+	}
+	return tx.Commit().Error
+}
+
+// Write writes the changes of the report, "+" for new users, rooms and
+// messages and "=" for users linked to existing ones
+func (r Report) Write(out io.Writer) {
+	for _, u := range r.Users {
+		mark := "+"
+		if u.Linked {
+			mark = "="
+		}
+		fmt.Fprintf(out, "%s user %s (%s)%s\n", mark, u.Name, u.ID, note(u.Note))
+	}
+	for _, room := range r.Rooms {
+		fmt.Fprintf(out, "+ room %s (%s)%s\n", room.Name, room.ID, note(room.Note))
+	}
+	for _, m := range r.Messages {
+		if m.Messages > 0 {
+			fmt.Fprintf(out, "+ %d messages in %s, %d thread replies\n", m.Messages, m.Name, m.Replies)
+		}
+	}
+
+	var subtypes []string
+	for subtype := range r.Skipped {
+		subtypes = append(subtypes, subtype)
+	}
+	sort.Strings(subtypes)
+	for _, subtype := range subtypes {
+		fmt.Fprintf(out, "Skipped %d %s events\n", r.Skipped[subtype], subtype)
+	}
+	if r.Reactions > 0 {
+		fmt.Fprintf(out, "Skipped %d reactions, not supported\n", r.Reactions)
+	}
+
+	unchanged := 0
+	for _, m := range r.Messages {
+		unchanged += m.Unchanged
+	}
+	fmt.Fprintf(out, "Already imported: %d users, %d rooms, %d messages\n",
+		r.UnchangedUsers, len(r.Messages)-len(r.Rooms), unchanged)
+}
+
+func note(n string) string {
+	if n == "" {
+		return ""
+	}
+	return ": " + n
+}
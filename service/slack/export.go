@@ -0,0 +1,228 @@
+// Package slack imports the history of Slack workspace exports.
+//
+// Exports are directories or zip archives with users.json, channels.json
+// and a directory per channel with a file of messages per day (e.g.
+// general/2019-12-20.json). Users, channels and messages are imported as
+// users, rooms and messages, keeping their authors and times, and are
+// recorded with their Slack IDs so imports can be run again to add new
+// history.
+package slack
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// User of a Slack workspace
+type User struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Deleted bool   `json:"deleted"`
+	IsBot   bool   `json:"is_bot"`
+	Profile struct {
+		Email     string `json:"email"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+	} `json:"profile"`
+}
+
+// Channel of a Slack workspace
+type Channel struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Unix time of the creation
+	Created    int64 `json:"created"`
+	IsArchived bool  `json:"is_archived"`
+}
+
+// Message of a channel
+type Message struct {
+	Type    string `json:"type"`
+	Subtype string `json:"subtype"`
+	// Author, empty for bot messages
+	User string `json:"user"`
+	// Bot posting bot messages, with its name
+	BotID    string `json:"bot_id"`
+	Username string `json:"username"`
+	Text     string `json:"text"`
+	// Unique time of the message in its channel, like "1576843200.000100"
+	TS string `json:"ts"`
+	// Time of the parent message of thread replies and parents
+	ThreadTS  string     `json:"thread_ts"`
+	Reactions []Reaction `json:"reactions"`
+}
+
+// Reaction to a message
+type Reaction struct {
+	Name  string   `json:"name"`
+	Users []string `json:"users"`
+	Count int      `json:"count"`
+}
+
+// Time returns the time of the message
+func (m Message) Time() (time.Time, error) {
+	return parseTS(m.TS)
+}
+
+// IsReply returns true for thread replies
+func (m Message) IsReply() bool {
+	return m.ThreadTS != "" && m.ThreadTS != m.TS
+}
+
+// parseTS parses a Slack message time, seconds and microseconds since the
+// Unix epoch
+func parseTS(ts string) (time.Time, error) {
+	parts := strings.SplitN(ts, ".", 2)
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("slack: invalid ts %q", ts)
+	}
+	var usec int64
+	if len(parts) == 2 {
+		if usec, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return time.Time{}, fmt.Errorf("slack: invalid ts %q", ts)
+		}
+	}
+	return time.Unix(sec, usec*int64(time.Microsecond)).UTC(), nil
+}
+
+// Export is a Slack workspace export
+type Export struct {
+	Users    []User
+	Channels []Channel
+	// Files of the export by path (e.g. "general/2019-12-20.json")
+	files  map[string]func() (io.ReadCloser, error)
+	closer io.Closer
+}
+
+// Open reads the users and channels of an export directory or zip archive
+func Open(name string) (*Export, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Export{files: make(map[string]func() (io.ReadCloser, error))}
+	if info.IsDir() {
+		err = e.openDir(name)
+	} else {
+		err = e.openZip(name)
+	}
+	if err != nil {
+		e.Close()
+		return nil, err
+	}
+
+	if err := e.readJSON("users.json", &e.Users); err != nil {
+		e.Close()
+		return nil, err
+	}
+	if err := e.readJSON("channels.json", &e.Channels); err != nil {
+		e.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Export) openDir(dir string) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		e.files[filepath.ToSlash(rel)] = func() (io.ReadCloser, error) {
+			return os.Open(p)
+		}
+		return nil
+	})
+}
+
+func (e *Export) openZip(name string) error {
+	r, err := zip.OpenReader(name)
+	if err != nil {
+		return err
+	}
+	e.closer = r
+
+	for _, f := range r.File {
+		e.files[f.Name] = f.Open
+	}
+	return nil
+}
+
+// Close releases the archive of the export
+func (e *Export) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
+
+func (e *Export) readJSON(name string, v interface{}) error {
+	open, ok := e.files[name]
+	if !ok {
+		return fmt.Errorf("slack: %s not found in export", name)
+	}
+	f, err := open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("slack: reading %s: %s", name, err)
+	}
+	return nil
+}
+
+// Messages returns the messages of a channel, oldest first
+func (e *Export) Messages(channel Channel) ([]Message, error) {
+	var days []string
+	for name := range e.files {
+		if path.Dir(name) == channel.Name && path.Ext(name) == ".json" {
+			days = append(days, name)
+		}
+	}
+	sort.Strings(days)
+
+	var messages []Message
+	for _, day := range days {
+		var dayMessages []Message
+		if err := e.readJSON(day, &dayMessages); err != nil {
+			return nil, err
+		}
+		messages = append(messages, dayMessages...)
+	}
+
+	// Messages are ordered by time, but times may not have all their digits
+	var err error
+	sort.SliceStable(messages, func(i, j int) bool {
+		ti, erri := messages[i].Time()
+		tj, errj := messages[j].Time()
+		if erri != nil {
+			err = erri
+		}
+		if errj != nil {
+			err = errj
+		}
+		return ti.Before(tj)
+	})
+	return messages, err
+}
@@ -0,0 +1,419 @@
+package slack
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+)
+
+// Sources of the imported records
+const (
+	sourceUser    = "slack:user"
+	sourceBot     = "slack:bot"
+	sourceChannel = "slack:channel"
+	sourceMessage = "slack:message"
+)
+
+// Subtypes of the messages imported, the others are channel events (e.g.
+// channel_join)
+var importedSubtypes = map[string]bool{
+	"":                 true,
+	"bot_message":      true,
+	"me_message":       true,
+	"thread_broadcast": true,
+	"file_share":       true,
+}
+
+// Domain of the emails of users without one, reserved so it is never
+// delivered
+const noEmailDomain = "slack.invalid"
+
+// Change of an imported user or room
+type Change struct {
+	// Slack ID
+	ID   string
+	Name string
+	// ID of the user or room
+	LocalID uint
+	// Linked to an existing user
+	Linked bool
+	// Note on the change (e.g. the username was taken)
+	Note string
+}
+
+// RoomReport is the import of the messages of a channel
+type RoomReport struct {
+	Channel string
+	Name    string
+	// Messages imported, thread replies included
+	Messages int
+	Replies  int
+	// Messages imported before
+	Unchanged int
+}
+
+// Report is the outcome of an import
+type Report struct {
+	// New and linked users and bots
+	Users []Change
+	// Users imported before
+	UnchangedUsers int
+	// New rooms
+	Rooms []Change
+	// Messages by channel
+	Messages []RoomReport
+	// Channel events not imported, by subtype
+	Skipped map[string]int
+	// Reactions to the messages imported, not supported by the schema
+	Reactions int
+}
+
+// Importer imports Slack exports on the repositories
+type Importer struct {
+	// Link the Slack users to the existing users with the same username and
+	// email. Otherwise they are imported as new users.
+	Link  bool
+	repos repository.Repositories
+	// Imported users and bots by source and Slack ID
+	users map[string]models.User
+	// Slack channel names by ID, for references
+	channels map[string]string
+}
+
+// NewImporter returns an importer on the repositories
+func NewImporter(repos repository.Repositories) *Importer {
+	return &Importer{
+		repos:    repos,
+		users:    make(map[string]models.User),
+		channels: make(map[string]string),
+	}
+}
+
+// Import imports the users, channels and messages of an export not
+// imported yet. Failed imports may be partial, and are expected to run in a
+// transaction.
+func (i *Importer) Import(e *Export) (Report, error) {
+	report := Report{Skipped: make(map[string]int)}
+
+	for _, user := range e.Users {
+		if err := i.importUser(user, &report); err != nil {
+			return report, err
+		}
+	}
+
+	for _, channel := range e.Channels {
+		i.channels[channel.ID] = channel.Name
+	}
+	for _, channel := range e.Channels {
+		roomID, err := i.importChannel(channel, &report)
+		if err != nil {
+			return report, err
+		}
+
+		messages, err := e.Messages(channel)
+		if err != nil {
+			return report, err
+		}
+		r := RoomReport{Channel: channel.ID, Name: channel.Name}
+		for _, m := range messages {
+			if err := i.importMessage(channel, roomID, m, &r, &report); err != nil {
+				return report, err
+			}
+		}
+		report.Messages = append(report.Messages, r)
+	}
+
+	return report, nil
+}
+
+// imported returns the ID of the model imported from a record, zero if it
+// was not imported
+func (i *Importer) imported(source, id string) (uint, error) {
+	localID, err := i.repos.Imports.Find(source, id)
+	if err == repository.ErrNotFound {
+		return 0, nil
+	}
+	return localID, err
+}
+
+func (i *Importer) importUser(user User, report *Report) error {
+	localID, err := i.imported(sourceUser, user.ID)
+	if err != nil {
+		return err
+	}
+	if localID != 0 {
+		u, err := i.findUser(localID, user.Name, user.Name+"-"+strings.ToLower(user.ID))
+		if err != nil {
+			return err
+		}
+		i.users[sourceUser+user.ID] = u
+		report.UnchangedUsers++
+		return nil
+	}
+
+	email := strings.ToLower(user.Profile.Email)
+	if email == "" {
+		email = strings.ToLower(user.ID) + "@" + noEmailDomain
+	}
+	change := Change{ID: user.ID, Name: user.Name}
+
+	// Users registered with the same username and email are linked when
+	// asked to, as neither of them is verified on registration
+	existing, err := i.repos.Users.FindByUsername(user.Name)
+	switch {
+	case err == repository.ErrNotFound:
+	case err != nil:
+		return err
+	case i.Link && strings.EqualFold(existing.Email, email):
+		change.LocalID, change.Linked = existing.ID, true
+		i.users[sourceUser+user.ID] = existing
+	default:
+		change.Name = user.Name + "-" + strings.ToLower(user.ID)
+		change.Note = fmt.Sprintf("username %s is taken", user.Name)
+	}
+
+	if !change.Linked {
+		// Emails are not verified on registration, so a matching email
+		// alone does not link the users
+		taken, err := i.repos.Users.FindByEmail(email)
+		switch {
+		case err == repository.ErrNotFound:
+		case err != nil:
+			return err
+		default:
+			note := fmt.Sprintf("email %s is taken by %s", email, taken.Username)
+			if change.Note != "" {
+				note = change.Note + ", " + note
+			}
+			change.Note = note
+			email = strings.ToLower(user.ID) + "@" + noEmailDomain
+		}
+
+		// Imported users have no password, so they cannot log in
+		u := models.User{
+			Username:  change.Name,
+			Email:     email,
+			FirstName: user.Profile.FirstName,
+			LastName:  user.Profile.LastName,
+			Bot:       user.IsBot,
+		}
+		if user.IsBot {
+			u.Role = models.RoleBot
+		}
+		if err := i.repos.Users.Create(&u); err != nil {
+			return fmt.Errorf("slack: importing user %s (%s): %s", user.ID, user.Name, err)
+		}
+		change.LocalID = u.ID
+		i.users[sourceUser+user.ID] = u
+	}
+
+	report.Users = append(report.Users, change)
+	return i.repos.Imports.Save(sourceUser, user.ID, change.LocalID)
+}
+
+// findUser returns an imported user by its ID and possible usernames
+func (i *Importer) findUser(id uint, usernames ...string) (models.User, error) {
+	for _, username := range usernames {
+		user, err := i.repos.Users.FindByUsername(username)
+		if err == nil && user.ID == id {
+			return user, nil
+		}
+		if err != nil && err != repository.ErrNotFound {
+			return user, err
+		}
+	}
+	// Linked users may have been renamed since
+	return models.User{Model: gorm.Model{ID: id}, Username: usernames[0]}, nil
+}
+
+// author returns the user posting a message, importing bots and users
+// missing from the export on their first message
+func (i *Importer) author(m Message, report *Report) (models.User, error) {
+	// Users of shared channels are not in users.json
+	source, id := sourceUser, m.User
+	usernames := []string{"slack-" + strings.ToLower(m.User)}
+	note := "not in users.json"
+	if m.User == "" {
+		source, id, note = sourceBot, m.BotID, "bot"
+		name := m.Username
+		if name == "" {
+			name = m.BotID
+		}
+		usernames = []string{name, name + "-" + strings.ToLower(m.BotID)}
+	}
+	if id == "" {
+		return models.User{}, fmt.Errorf("slack: message %s has no author", m.TS)
+	}
+	if user, ok := i.users[source+id]; ok {
+		return user, nil
+	}
+
+	localID, err := i.imported(source, id)
+	if err != nil {
+		return models.User{}, err
+	}
+	if localID != 0 {
+		user, err := i.findUser(localID, usernames...)
+		i.users[source+id] = user
+		return user, err
+	}
+
+	// Failed inserts abort Postgres transactions, so usernames are checked
+	user := models.User{
+		Email: strings.ToLower(id) + "@" + noEmailDomain,
+		Bot:   source == sourceBot,
+	}
+	if user.Bot {
+		user.Role = models.RoleBot
+	}
+	for _, username := range usernames {
+		_, err := i.repos.Users.FindByUsername(username)
+		if err == repository.ErrNotFound {
+			user.Username = username
+			break
+		}
+		if err != nil {
+			return user, err
+		}
+	}
+	if user.Username == "" {
+		return user, fmt.Errorf("slack: importing author %s: username %s is taken", id, usernames[0])
+	}
+	if err := i.repos.Users.Create(&user); err != nil {
+		return user, fmt.Errorf("slack: importing author %s (%s): %s", id, user.Username, err)
+	}
+	if err := i.repos.Imports.Save(source, id, user.ID); err != nil {
+		return user, err
+	}
+
+	i.users[source+id] = user
+	report.Users = append(report.Users, Change{ID: id, Name: user.Username, LocalID: user.ID, Note: note})
+	return user, nil
+}
+
+func (i *Importer) importChannel(channel Channel, report *Report) (uint, error) {
+	localID, err := i.imported(sourceChannel, channel.ID)
+	if err != nil || localID != 0 {
+		return localID, err
+	}
+
+	room := models.Room{Name: channel.Name}
+	if channel.Created > 0 {
+		room.CreatedAt = time.Unix(channel.Created, 0).UTC()
+	}
+	if err := i.repos.Rooms.Create(&room); err != nil {
+		return 0, err
+	}
+
+	change := Change{ID: channel.ID, Name: channel.Name, LocalID: room.ID}
+	if channel.IsArchived {
+		change.Note = "archived"
+	}
+	report.Rooms = append(report.Rooms, change)
+	return room.ID, i.repos.Imports.Save(sourceChannel, channel.ID, room.ID)
+}
+
+func (i *Importer) importMessage(channel Channel, roomID uint, m Message, r *RoomReport, report *Report) error {
+	if m.Type != "message" || !importedSubtypes[m.Subtype] {
+		event := m.Subtype
+		if event == "" {
+			event = m.Type
+		}
+		report.Skipped[event]++
+		return nil
+	}
+
+	// Message times are unique in their channel
+	id := channel.ID + "/" + m.TS
+	localID, err := i.imported(sourceMessage, id)
+	if err != nil {
+		return err
+	}
+	if localID != 0 {
+		r.Unchanged++
+		return nil
+	}
+
+	createdAt, err := m.Time()
+	if err != nil {
+		return err
+	}
+	author, err := i.author(m, report)
+	if err != nil {
+		return err
+	}
+
+	message := models.Message{
+		Model:  gorm.Model{CreatedAt: createdAt, UpdatedAt: createdAt},
+		Text:   i.text(m.Text),
+		UserID: author.ID,
+		RoomID: roomID,
+	}
+	if err := i.repos.Messages.Create(&message); err != nil {
+		return err
+	}
+
+	r.Messages++
+	if m.IsReply() {
+		r.Replies++
+	}
+	for _, reaction := range m.Reactions {
+		report.Reactions += reaction.Count
+	}
+	return i.repos.Imports.Save(sourceMessage, id, message.ID)
+}
+
+// Slack references, like <@U123>, <#C123|general> or <https://x.com|x>
+var reference = regexp.MustCompile(`<([^<>]*)>`)
+
+// text converts the Slack markup of a message to plain text
+func (i *Importer) text(text string) string {
+	text = reference.ReplaceAllStringFunc(text, func(ref string) string {
+		ref = ref[1 : len(ref)-1]
+		target, label := ref, ""
+		if j := strings.Index(ref, "|"); j >= 0 {
+			target, label = ref[:j], ref[j+1:]
+		}
+
+		if target == "" {
+			return label
+		}
+
+		switch target[0] {
+		case '@':
+			if user, ok := i.users[sourceUser+target[1:]]; ok {
+				return "@" + user.Username
+			}
+		case '#':
+			if name, ok := i.channels[target[1:]]; ok {
+				return "#" + name
+			}
+		case '!':
+			// Special mentions, like <!here> or <!subteam^S123|@support>
+			if label != "" {
+				return label
+			}
+			return "@" + target[1:]
+		default:
+			// Links
+			if label != "" {
+				return label + " (" + target + ")"
+			}
+			return target
+		}
+
+		// Users and channels not in the export
+		if label != "" {
+			return target[:1] + label
+		}
+		return target
+	})
+	return html.UnescapeString(text)
+}
@@ -0,0 +1,257 @@
+package slack
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/models"
+	"github.com/hernanrocha/fin-chat/service/repository"
+	"github.com/hernanrocha/fin-chat/service/storage/storagetest"
+)
+
+const testExport = "testdata/export"
+
+// newSQLite returns a database with the users "jane" and "bob", registered
+// before the import
+func newSQLite(t *testing.T) *gorm.DB {
+	db := storagetest.SQLite(t)
+
+	users := repository.NewGorm(db).Users
+	require.NoError(t, users.Create(&models.User{Username: "jane", Email: "jane@mail.com"}))
+	require.NoError(t, users.Create(&models.User{Username: "bob", Email: "bob@mail.com"}))
+	return db
+}
+
+func openExport(t *testing.T) *Export {
+	e, err := Open(testExport)
+	require.NoError(t, err)
+	return e
+}
+
+func TestImport(t *testing.T) {
+	db := newSQLite(t)
+	defer db.Close()
+	repos := repository.NewGorm(db)
+	e := openExport(t)
+	defer e.Close()
+
+	report, err := NewImporter(repos).Import(e)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Change{
+		{ID: "U01", Name: "jdoe", LocalID: 3},
+		{ID: "U02", Name: "jane-u02", LocalID: 4, Note: "username jane is taken"},
+		{ID: "U03", Name: "bob-u03", LocalID: 5, Note: "username bob is taken, email bob@mail.com is taken by bob"},
+		{ID: "U04", Name: "beeper", LocalID: 6},
+		{ID: "B01", Name: "quotes", LocalID: 7, Note: "bot"},
+		{ID: "U09", Name: "slack-u09", LocalID: 8, Note: "not in users.json"},
+	}, report.Users)
+	assert.Equal(t, []Change{
+		{ID: "C01", Name: "general", LocalID: 1},
+		{ID: "C02", Name: "random", LocalID: 2, Note: "archived"},
+	}, report.Rooms)
+	assert.Equal(t, []RoomReport{
+		{Channel: "C01", Name: "general", Messages: 5, Replies: 1},
+		{Channel: "C02", Name: "random", Messages: 1},
+	}, report.Messages)
+	assert.Equal(t, map[string]int{"channel_join": 1}, report.Skipped)
+	assert.Equal(t, 2, report.Reactions)
+
+	// Authors and times are kept
+	messages, err := repos.Messages.ListByRoom(1, 10)
+	require.NoError(t, err)
+	require.Len(t, messages, 5)
+	assert.Equal(t, "Hello from a shared channel @here", messages[0].Text)
+	assert.Equal(t, "quotes", messages[1].User.Username)
+	assert.True(t, messages[1].User.Bot)
+	assert.Equal(t, "jane-u02", messages[3].User.Username)
+	assert.Equal(t, "Hi @jane-u02 & @bob-u03, see #random and the docs (https://example.com)", messages[4].Text)
+	assert.Equal(t, time.Date(2019, 12, 19, 0, 1, 0, 200000, time.UTC), messages[4].CreatedAt.UTC())
+
+	room, err := repos.Rooms.Find(2)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2019, 12, 18, 0, 0, 0, 0, time.UTC), room.CreatedAt.UTC())
+
+	beeper, err := repos.Users.FindByUsername("beeper")
+	require.NoError(t, err)
+	assert.True(t, beeper.Bot)
+	assert.Equal(t, "u04@slack.invalid", beeper.Email)
+}
+
+func TestImportLink(t *testing.T) {
+	db := newSQLite(t)
+	defer db.Close()
+	repos := repository.NewGorm(db)
+	e := openExport(t)
+	defer e.Close()
+
+	// Users with the same username and email are linked when asked to
+	importer := NewImporter(repos)
+	importer.Link = true
+	report, err := importer.Import(e)
+	require.NoError(t, err)
+	assert.Equal(t, Change{ID: "U02", Name: "jane-u02", LocalID: 4, Note: "username jane is taken"}, report.Users[1])
+	assert.Equal(t, Change{ID: "U03", Name: "bob", LocalID: 2, Linked: true}, report.Users[2])
+
+	messages, err := repos.Messages.ListByRoom(1, 10)
+	require.NoError(t, err)
+	require.Len(t, messages, 5)
+	assert.Equal(t, "Hi @jane-u02 & @bob, see #random and the docs (https://example.com)", messages[4].Text)
+}
+
+func TestImportEmailTaken(t *testing.T) {
+	db := newSQLite(t)
+	defer db.Close()
+	repos := repository.NewGorm(db)
+	require.NoError(t, repos.Users.Create(&models.User{Username: "john", Email: "JDoe@mail.com"}))
+	e := openExport(t)
+	defer e.Close()
+
+	// The email is not enough to link the users
+	report, err := NewImporter(repos).Import(e)
+	require.NoError(t, err)
+	assert.Equal(t, Change{ID: "U01", Name: "jdoe", LocalID: 4, Note: "email jdoe@mail.com is taken by john"}, report.Users[0])
+
+	jdoe, err := repos.Users.FindByUsername("jdoe")
+	require.NoError(t, err)
+	assert.Equal(t, "u01@slack.invalid", jdoe.Email)
+}
+
+func TestImportAgain(t *testing.T) {
+	db := newSQLite(t)
+	defer db.Close()
+	repos := repository.NewGorm(db)
+	e := openExport(t)
+	defer e.Close()
+
+	_, err := NewImporter(repos).Import(e)
+	require.NoError(t, err)
+
+	// Only new history is imported
+	require.NoError(t, db.Exec(`DELETE FROM imported_records WHERE external_id = 'C02/1576800000.000500'`).Error)
+
+	report, err := NewImporter(repos).Import(e)
+	require.NoError(t, err)
+	assert.Empty(t, report.Users)
+	assert.Equal(t, 4, report.UnchangedUsers)
+	assert.Empty(t, report.Rooms)
+	assert.Equal(t, []RoomReport{
+		{Channel: "C01", Name: "general", Unchanged: 5},
+		{Channel: "C02", Name: "random", Messages: 1},
+	}, report.Messages)
+
+	var count int
+	require.NoError(t, db.Model(&models.Message{}).Count(&count).Error)
+	assert.Equal(t, 7, count)
+	require.NoError(t, db.Model(&models.User{}).Count(&count).Error)
+	assert.Equal(t, 8, count)
+}
+
+func TestCommand(t *testing.T) {
+	db := newSQLite(t)
+	defer db.Close()
+
+	var out bytes.Buffer
+	require.NoError(t, Command(db, []string{"-dry-run", testExport}, &out))
+	assert.Equal(t, ""+
+		"+ user jdoe (U01)\n"+
+		"+ user jane-u02 (U02): username jane is taken\n"+
+		"+ user bob-u03 (U03): username bob is taken, email bob@mail.com is taken by bob\n"+
+		"+ user beeper (U04)\n"+
+		"+ user quotes (B01): bot\n"+
+		"+ user slack-u09 (U09): not in users.json\n"+
+		"+ room general (C01)\n"+
+		"+ room random (C02): archived\n"+
+		"+ 5 messages in general, 1 thread replies\n"+
+		"+ 1 messages in random, 0 thread replies\n"+
+		"Skipped 1 channel_join events\n"+
+		"Skipped 2 reactions, not supported\n"+
+		"Already imported: 0 users, 0 rooms, 0 messages\n"+
+		"Dry run, nothing was imported\n", out.String())
+
+	var count int
+	require.NoError(t, db.Model(&models.Room{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	out.Reset()
+	require.NoError(t, Command(db, []string{"-link", testExport}, &out))
+	assert.Contains(t, out.String(), "= user bob (U03)\n")
+	require.NoError(t, db.Model(&models.Room{}).Count(&count).Error)
+	assert.Equal(t, 2, count)
+
+	out.Reset()
+	require.NoError(t, Command(db, []string{testExport}, &out))
+	assert.Equal(t, ""+
+		"Skipped 1 channel_join events\n"+
+		"Already imported: 4 users, 2 rooms, 6 messages\n", out.String())
+}
+
+func TestCommandUsage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"-force", testExport},
+		{testExport, "other"},
+	} {
+		assert.Equal(t, ErrUsage, Command(nil, args, ioutil.Discard), "%v", args)
+	}
+	assert.Error(t, Command(nil, []string{"testdata/missing"}, ioutil.Discard))
+}
+
+func TestOpenZip(t *testing.T) {
+	f, err := ioutil.TempFile("", "slack-export-*.zip")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	w := zip.NewWriter(f)
+	require.NoError(t, filepath.Walk(testExport, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(testExport, path)
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		zf, err := w.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		_, err = zf.Write(b)
+		return err
+	}))
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	e, err := Open(f.Name())
+	require.NoError(t, err)
+	defer e.Close()
+
+	assert.Len(t, e.Users, 4)
+	require.Len(t, e.Channels, 2)
+	messages, err := e.Messages(e.Channels[0])
+	require.NoError(t, err)
+	require.Len(t, messages, 6)
+	assert.Equal(t, "channel_join", messages[0].Subtype)
+	assert.True(t, messages[2].IsReply())
+	assert.False(t, messages[1].IsReply())
+}
+
+func TestParseTS(t *testing.T) {
+	ts, err := parseTS("1576800000.000100")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2019, 12, 20, 0, 0, 0, 100000, time.UTC), ts)
+
+	_, err = parseTS("yesterday")
+	assert.Error(t, err)
+	_, err = parseTS("1576800000.x")
+	assert.Error(t, err)
+}
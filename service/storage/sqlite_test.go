@@ -0,0 +1,27 @@
+//go:build cgo
+// +build cgo
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The SQLite driver needs cgo
+func TestOpenSQLiteMemory(t *testing.T) {
+	db, err := Open("sqlite::memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Equal(t, SQLite, db.Dialect().GetName())
+
+	// Every query uses the same in-memory database
+	require.NoError(t, db.Exec(`CREATE TABLE a (id INTEGER)`).Error)
+	assert.NoError(t, db.Exec(`INSERT INTO a VALUES (1)`).Error)
+
+	var foreignKeys int
+	require.NoError(t, db.DB().QueryRow(`PRAGMA foreign_keys`).Scan(&foreignKeys))
+	assert.Equal(t, 1, foreignKeys)
+}
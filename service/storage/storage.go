@@ -0,0 +1,63 @@
+// Package storage opens the database of the service, selecting its driver
+// from the DSN scheme.
+package storage
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	// Database drivers
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// Dialects, as named by gorm
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite3"
+)
+
+// SQLite pragmas: enforce the foreign keys like Postgres, and wait for
+// locks instead of failing
+const sqliteParams = "_foreign_keys=1&_busy_timeout=5000"
+
+// Parse returns the dialect of a DSN and the connection string of its
+// driver. SQLite DSNs are "sqlite:<file>" ("sqlite:///var/lib/finchat.db",
+// "sqlite://finchat.db") or "sqlite::memory:"; any other DSN is a Postgres
+// URL or connection string.
+func Parse(dsn string) (string, string) {
+	for _, scheme := range []string{"sqlite3:", "sqlite:"} {
+		if strings.HasPrefix(dsn, scheme) {
+			return SQLite, sqliteConn(strings.TrimPrefix(dsn, scheme))
+		}
+	}
+	return Postgres, dsn
+}
+
+func sqliteConn(path string) string {
+	path = strings.TrimPrefix(path, "//")
+	if path == "" {
+		path = ":memory:"
+	}
+	if strings.Contains(path, "?") {
+		return path + "&" + sqliteParams
+	}
+	return path + "?" + sqliteParams
+}
+
+// Open connects to the database of a DSN
+func Open(dsn string) (*gorm.DB, error) {
+	dialect, conn := Parse(dsn)
+	db, err := gorm.Open(dialect, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if dialect == SQLite {
+		// SQLite has a single writer, and every connection to :memory:
+		// would open a new database
+		db.DB().SetMaxOpenConns(1)
+	}
+
+	return db, nil
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		dsn     string
+		dialect string
+		conn    string
+	}{
+		{"host=localhost port=5432 dbname=finchat", Postgres, "host=localhost port=5432 dbname=finchat"},
+		{"postgres://postgres@localhost/finchat?sslmode=disable", Postgres, "postgres://postgres@localhost/finchat?sslmode=disable"},
+		{"sqlite::memory:", SQLite, ":memory:?_foreign_keys=1&_busy_timeout=5000"},
+		{"sqlite:", SQLite, ":memory:?_foreign_keys=1&_busy_timeout=5000"},
+		{"sqlite://finchat.db", SQLite, "finchat.db?_foreign_keys=1&_busy_timeout=5000"},
+		{"sqlite:///var/lib/finchat.db", SQLite, "/var/lib/finchat.db?_foreign_keys=1&_busy_timeout=5000"},
+		{"sqlite3:finchat.db?_journal_mode=WAL", SQLite, "finchat.db?_journal_mode=WAL&_foreign_keys=1&_busy_timeout=5000"},
+	}
+
+	for _, test := range tests {
+		dialect, conn := Parse(test.dsn)
+		assert.Equal(t, test.dialect, dialect, test.dsn)
+		assert.Equal(t, test.conn, conn, test.dsn)
+	}
+}
@@ -0,0 +1,26 @@
+// Package storagetest provides the databases used by the tests of other
+// packages.
+package storagetest
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hernanrocha/fin-chat/service/migrations"
+	"github.com/hernanrocha/fin-chat/service/storage"
+)
+
+// SQLite returns an in-memory SQLite database with every migration applied.
+// The caller closes it.
+func SQLite(t *testing.T) *gorm.DB {
+	db, err := storage.Open("sqlite::memory:")
+	require.NoError(t, err)
+	_, err = migrations.New(db.DB(), storage.SQLite).Up()
+	if err != nil {
+		db.Close()
+	}
+	require.NoError(t, err)
+	return db
+}
@@ -0,0 +1,32 @@
+package viewmodels
+
+import (
+	"time"
+)
+
+type AuditEntryView struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Details   string    `json:"details"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+}
+
+type ListAuditResponse struct {
+	Entries []AuditEntryView `json:"entries"`
+}
+
+type VerifyAuditResponse struct {
+	Valid bool `json:"valid"`
+	// Entries verified, up to the first broken one
+	Entries int `json:"entries"`
+	// First entry not matching its hash or its previous entry
+	BrokenID uint `json:"broken_id,omitempty"`
+	// Hash of the newest entry
+	Head string `json:"head"`
+}
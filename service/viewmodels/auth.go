@@ -10,6 +10,8 @@ type UserView struct {
 	Email     string `json:"email" binding:"required"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
+	// Ignored on registration, users are registered with the user role
+	Role string `json:"role"`
 }
 
 type LoginResponse struct {
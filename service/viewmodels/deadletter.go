@@ -0,0 +1,27 @@
+package viewmodels
+
+import (
+	"time"
+)
+
+type DeadLetterView struct {
+	ID       string    `json:"id"`
+	Body     string    `json:"body"`
+	Reason   string    `json:"reason"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+type ListDeadLetterResponse struct {
+	DeadLetters []DeadLetterView `json:"dead_letters"`
+}
+
+type RedriveDeadLetterRequest struct {
+	// Dead letters to redrive, all of them if empty
+	IDs []string `json:"ids"`
+}
+
+type RedriveDeadLetterResponse struct {
+	Redriven int `json:"redriven"`
+}
@@ -0,0 +1,44 @@
+package viewmodels
+
+import (
+	"time"
+)
+
+type CreateExportRequest struct {
+	RoomIDs []uint `json:"room_ids" binding:"required"`
+	// Messages created at or after since, all of them if null
+	Since *time.Time `json:"since"`
+	// Messages created before until, up to now if null
+	Until *time.Time `json:"until"`
+	// "jsonl" and/or "csv", both if empty
+	Formats []string `json:"formats"`
+}
+
+type ExportJobView struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	RoomIDs     []uint     `json:"room_ids"`
+	Since       *time.Time `json:"since"`
+	Until       time.Time  `json:"until"`
+	Formats     []string   `json:"formats"`
+	RequestedBy string     `json:"requested_by"`
+	// Messages exported, out of total
+	Exported int `json:"exported"`
+	Total    int `json:"total"`
+	// Failure reason of failed exports
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	// SHA-256 checksum and size of the archive, once done
+	Checksum    string `json:"checksum,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+type ExportJobResponse struct {
+	ExportJobView
+}
+
+type ListExportResponse struct {
+	Exports []ExportJobView `json:"exports"`
+}
@@ -0,0 +1,19 @@
+package viewmodels
+
+import (
+	"time"
+)
+
+type ProcessStatusView struct {
+	Name      string    `json:"name"`
+	Running   bool      `json:"running"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+type HealthResponse struct {
+	// ok if every process is running, degraded otherwise
+	Status    string              `json:"status"`
+	Processes []ProcessStatusView `json:"processes"`
+}
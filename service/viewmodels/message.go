@@ -1,6 +1,9 @@
 package viewmodels
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type MessageView struct {
 	ID        uint      `json:"id"`
@@ -8,6 +11,8 @@ type MessageView struct {
 	Username  string    `json:"username"`
 	CreatedAt time.Time `json:"created_at"`
 	RoomID    uint      `json:"room_id"`
+	// Structured bot payload, only set on messages broadcast by a bot
+	Quotes json.RawMessage `json:"quotes,omitempty" swaggertype:"object"`
 }
 
 type CreateMessageRequest struct {
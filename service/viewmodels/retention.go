@@ -0,0 +1,42 @@
+package viewmodels
+
+type RetentionPolicyView struct {
+	// Days messages are kept, zero for forever
+	Days int `json:"days"`
+	// Newest messages kept, zero for all
+	Messages int `json:"messages"`
+}
+
+type RoomRetentionReportView struct {
+	RoomID    uint                `json:"room_id"`
+	Name      string              `json:"name"`
+	Policy    RetentionPolicyView `json:"policy"`
+	LegalHold bool                `json:"legal_hold"`
+	// Messages purged, or that would be purged on dry runs
+	Expired int `json:"expired"`
+}
+
+type RetentionReportResponse struct {
+	DryRun  bool                      `json:"dry_run"`
+	Archive bool                      `json:"archive"`
+	Rooms   []RoomRetentionReportView `json:"rooms"`
+	Total   int                       `json:"total"`
+}
+
+type UpdateRoomRetentionRequest struct {
+	// Days messages are kept, overriding the global policy. Null to
+	// inherit it, zero for forever.
+	Days *int `json:"days"`
+	// Newest messages kept, overriding the global policy. Null to inherit
+	// it, zero for all.
+	Messages *int `json:"messages"`
+	// Rooms on legal hold are never purged
+	LegalHold bool `json:"legal_hold"`
+}
+
+type RoomRetentionResponse struct {
+	RoomID    uint `json:"room_id"`
+	Days      *int `json:"days"`
+	Messages  *int `json:"messages"`
+	LegalHold bool `json:"legal_hold"`
+}
@@ -1,8 +1,9 @@
 package viewmodels
 
 type RoomView struct {
-	ID   uint   `json:"id"`
-	Name string `json:"name"`
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	Archived bool   `json:"archived"`
 }
 
 type ListRoomResponse struct {
@@ -0,0 +1,15 @@
+package viewmodels
+
+import (
+	"time"
+)
+
+type SessionView struct {
+	ID          string    `json:"id"`
+	UserAgent   string    `json:"user_agent"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+type ListSessionResponse struct {
+	Sessions []SessionView `json:"sessions"`
+}
@@ -0,0 +1,34 @@
+package viewmodels
+
+import (
+	"time"
+)
+
+type AdminUserView struct {
+	ID        uint      `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Role      string    `json:"role"`
+	Bot       bool      `json:"bot"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ListUserResponse struct {
+	Users []AdminUserView `json:"users"`
+}
+
+type UpdateUserRoleRequest struct {
+	// admin, moderator, user or bot
+	Role string `json:"role" binding:"required"`
+}
+
+type UpdateUserDisabledRequest struct {
+	Disabled *bool `json:"disabled" binding:"required"`
+}
+
+type UpdateUserResponse struct {
+	AdminUserView
+}
@@ -0,0 +1,164 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrStopped is reported when a process returns before its context is done
+var ErrStopped = errors.New("supervisor: process stopped unexpectedly")
+
+// Status of a supervised process
+type Status struct {
+	Name      string
+	Running   bool
+	Restarts  int
+	LastError string
+	// Time of the last start or failure
+	Since time.Time
+}
+
+type process struct {
+	name   string
+	run    func(ctx context.Context) error
+	status Status
+}
+
+// Supervisor keeps long-running processes (e.g. message consumers) alive,
+// restarting them with exponential backoff when they fail
+type Supervisor struct {
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu        sync.Mutex
+	processes []*process
+	wg        sync.WaitGroup
+}
+
+// New returns a supervisor waiting from minBackoff up to maxBackoff
+// between restarts
+func New(minBackoff, maxBackoff time.Duration) *Supervisor {
+	return &Supervisor{
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+	}
+}
+
+// Add a process. It must block until ctx is done, finishing its in-flight
+// work before returning. Processes are started by Start.
+func (s *Supervisor) Add(name string, run func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.processes = append(s.processes, &process{
+		name:   name,
+		run:    run,
+		status: Status{Name: name},
+	})
+}
+
+// Start runs all processes until ctx is done
+func (s *Supervisor) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.processes {
+		s.wg.Add(1)
+		go s.supervise(ctx, p)
+	}
+}
+
+// Wait blocks until all processes are stopped
+func (s *Supervisor) Wait() {
+	s.wg.Wait()
+}
+
+// Health returns the status of every process
+func (s *Supervisor) Health() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]Status, len(s.processes))
+	for i, p := range s.processes {
+		statuses[i] = p.status
+	}
+	return statuses
+}
+
+// Healthy is true when every process is running
+func (s *Supervisor) Healthy() bool {
+	for _, status := range s.Health() {
+		if !status.Running {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Supervisor) supervise(ctx context.Context, p *process) {
+	defer s.wg.Done()
+
+	backoff := s.minBackoff
+	for {
+		s.update(p, true, nil)
+		started := time.Now()
+		err := call(ctx, p.run)
+
+		if ctx.Err() != nil {
+			s.update(p, false, err)
+			log.Printf("Process %s stopped\n", p.name)
+			return
+		}
+
+		if err == nil {
+			err = ErrStopped
+		}
+		// Processes that ran for a while start over with the shortest backoff
+		if time.Since(started) > s.maxBackoff {
+			backoff = s.minBackoff
+		}
+
+		s.update(p, false, err)
+		log.Printf("Process %s failed, restarting in %s: %s\n", p.name, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+
+		s.mu.Lock()
+		p.status.Restarts++
+		s.mu.Unlock()
+
+		if backoff *= 2; backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+func (s *Supervisor) update(p *process, running bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p.status.Running = running
+	p.status.Since = time.Now()
+	if err != nil {
+		p.status.LastError = err.Error()
+	}
+}
+
+// call runs a process, turning panics into errors
+func call(ctx context.Context, run func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return run(ctx)
+}
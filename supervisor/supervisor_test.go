@@ -0,0 +1,90 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisorRestarts(t *testing.T) {
+	s := New(time.Millisecond, 10*time.Millisecond)
+
+	var calls int64
+	started := make(chan struct{})
+	s.Add("flaky", func(ctx context.Context) error {
+		switch atomic.AddInt64(&calls, 1) {
+		case 1:
+			return errors.New("connection lost")
+		case 2:
+			panic("boom")
+		case 3:
+			return nil
+		}
+		close(started)
+		<-ctx.Done()
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("process not restarted")
+	}
+
+	health := s.Health()
+	require.Len(t, health, 1)
+	assert.Equal(t, "flaky", health[0].Name)
+	assert.True(t, health[0].Running)
+	assert.Equal(t, 3, health[0].Restarts)
+	assert.Equal(t, ErrStopped.Error(), health[0].LastError)
+	assert.True(t, s.Healthy())
+
+	cancel()
+	s.Wait()
+	assert.False(t, s.Healthy())
+}
+
+func TestSupervisorDrains(t *testing.T) {
+	s := New(time.Millisecond, 10*time.Millisecond)
+
+	var drained int64
+	s.Add("consumer", func(ctx context.Context) error {
+		<-ctx.Done()
+		// Finish the in-flight message
+		time.Sleep(20 * time.Millisecond)
+		atomic.StoreInt64(&drained, 1)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	cancel()
+	s.Wait()
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&drained))
+}
+
+func TestSupervisorStopsDuringBackoff(t *testing.T) {
+	s := New(time.Hour, time.Hour)
+	s.Add("failing", func(ctx context.Context) error {
+		return errors.New("failed")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	time.Sleep(10 * time.Millisecond)
+
+	assert.False(t, s.Healthy())
+	assert.Equal(t, "failed", s.Health()[0].LastError)
+
+	cancel()
+	s.Wait()
+}